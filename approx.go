@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrApproxRankDisabled 表示服务未通过 WithApproxRank 开启分数桶计数
+var ErrApproxRankDisabled = errors.New("approximate rank is not enabled")
+
+// 近似排名通过哈希 <key>:buckets 维护每个分数桶中的玩家数, 桶 i 覆盖原始分数 [i*width, (i+1)*width)
+// 计算排名只需读取桶计数而不依赖有序集合的大小, 代价与桶数成正比
+// 桶计数由 UpdateScore、TryUpdateScore、UpdateScoresBatch、SetScore、RecordBest、UpdateMetrics、RecomputeAll、DeletePlayer、DeletePlayers 和 ResetLeaderboard 维护,
+// 这些写入在同一个 Lua 脚本中同时更新有序集合和桶计数; 其他写入 (ImportJSON、ApplyDecay 等) 之后需要调用 RebuildRankBuckets
+
+// bucketWriteScript 写入或删除成员, 同时调整分数桶计数
+// KEYS[1]: 排行榜 key, KEYS[2]: 分数桶哈希
+// ARGV: playerID, scoreMultiplier, bucketWidth, newCombinedScore, newRawScore; ARGV[4] 为空字符串表示删除成员
+// 返回 ZADD 或 ZREM 的结果
+var bucketWriteScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[2])
+local width = tonumber(ARGV[3])
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old then
+	old = tonumber(old)
+	local oldScore = math.floor(old / multiplier)
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+	end
+	redis.call('HINCRBY', KEYS[2], math.floor(oldScore / width), -1)
+end
+if ARGV[4] == '' then
+	return redis.call('ZREM', KEYS[1], ARGV[1])
+end
+redis.call('HINCRBY', KEYS[2], math.floor(tonumber(ARGV[5]) / width), 1)
+return redis.call('ZADD', KEYS[1], ARGV[4], ARGV[1])
+`)
+
+// bucketRemoveScript 批量删除成员, 同时减少各自所在分数桶的计数
+// KEYS[1]: 排行榜 key, KEYS[2]: 分数桶哈希, ARGV: scoreMultiplier, bucketWidth, 之后为要删除的成员
+// 返回实际删除的成员数
+var bucketRemoveScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[1])
+local width = tonumber(ARGV[2])
+local removed = 0
+for i = 3, #ARGV do
+	local old = redis.call('ZSCORE', KEYS[1], ARGV[i])
+	if old then
+		old = tonumber(old)
+		local oldScore = math.floor(old / multiplier)
+		local part = old - oldScore * multiplier
+		if part < 0 then
+			oldScore = oldScore - 1
+		elseif part >= multiplier then
+			oldScore = oldScore + 1
+		end
+		redis.call('HINCRBY', KEYS[2], math.floor(oldScore / width), -1)
+		removed = removed + redis.call('ZREM', KEYS[1], ARGV[i])
+	end
+end
+return removed
+`)
+
+// WithApproxRank 开启分数桶计数, 每个桶覆盖 bucketWidth 个原始分数, 之后可以使用 GetPlayerRankApprox
+// 桶越宽, 维护的桶越少, 近似排名的误差也越大; bucketWidth <= 0 时不开启
+// 桶计数依赖 Lua 脚本, 只适用于 NewLeaderboardService 创建的服务
+func WithApproxRank(bucketWidth int64) Option {
+	return func(s *LeaderboardService) {
+		s.bucketWidth = max(bucketWidth, 0)
+	}
+}
+
+// bucketKey 返回当前排行榜的分数桶哈希 key
+func (s *LeaderboardService) bucketKey() string {
+	return s.key() + ":buckets"
+}
+
+// scriptKeys 返回写入排行榜 key 的脚本所用的 KEYS, 开启 WithApproxRank 时附带分数桶哈希
+func (s *LeaderboardService) scriptKeys(key string) []string {
+	if s.bucketWidth > 0 {
+		return []string{key, key + ":buckets"}
+	}
+	return []string{key}
+}
+
+// bucketOf 返回原始分数所在的桶, 负分数同样向下取整
+func (s *LeaderboardService) bucketOf(score int64) int64 {
+	bucket := score / s.bucketWidth
+	if score%s.bucketWidth < 0 {
+		bucket--
+	}
+	return bucket
+}
+
+// GetPlayerRankApprox 根据分数桶计数估算玩家排名, 需要先通过 WithApproxRank 开启
+// 排名在更好的桶中的玩家一定排在前面, 同桶玩家的先后未知, 因此估算值取同桶范围的中点:
+// 与精确排名的误差不超过该玩家所在桶人数的一半, 即桶越窄越精确
+func (s *LeaderboardService) GetPlayerRankApprox(ctx context.Context, playerID string) (_ int64, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankApprox", playerID)(&err)
+	if s.bucketWidth <= 0 {
+		return 0, ErrApproxRankDisabled
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return 0, err
+	}
+	key := s.key()
+	pipe := s.reader.Pipeline()
+	scoreCmd := pipe.ZScore(ctx, key, member)
+	bucketsCmd := pipe.HGetAll(ctx, s.bucketKey())
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	combinedScore, err := scoreCmd.Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return 0, err
+	}
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return 0, err
+	}
+	score, _ := s.decodeScore(combinedScore)
+	own := s.bucketOf(score)
+
+	var better, same int64
+	for field, value := range bucketsCmd.Val() {
+		bucket, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket %q: %w", field, err)
+		}
+		count, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid bucket count %q: %w", value, err)
+		}
+		switch {
+		case bucket == own:
+			same = count
+		case (bucket > own) != (s.order == Ascending):
+			better += count
+		}
+	}
+	return better + (same+1)/2, nil
+}
+
+// RebuildRankBuckets 根据当前排行榜重新计算所有分数桶计数, 用于开启 WithApproxRank 之前已有的数据
+// 或未维护桶计数的写入之后; 重建期间的并发写入可能不会反映在结果中
+func (s *LeaderboardService) RebuildRankBuckets(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "RebuildRankBuckets")(&err)
+	if err := s.requireRedis("RebuildRankBuckets"); err != nil {
+		return err
+	}
+	if s.bucketWidth <= 0 {
+		return ErrApproxRankDisabled
+	}
+	return s.rebuildRankBuckets(ctx)
+}
+
+// rebuildRankBuckets 是 RebuildRankBuckets 的实现, 供其他方法复用而不重复上报指标
+func (s *LeaderboardService) rebuildRankBuckets(ctx context.Context) error {
+	counts := make(map[int64]int64)
+	entries, errc := s.iterate(ctx, exportBatchSize, false)
+	for info := range entries {
+		counts[s.bucketOf(info.Score)]++
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	bucketKey := s.bucketKey()
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, bucketKey)
+		if len(counts) == 0 {
+			return nil
+		}
+		values := make([]interface{}, 0, len(counts)*2)
+		for bucket, count := range counts {
+			values = append(values, bucket, count)
+		}
+		pipe.HSet(ctx, bucketKey, values...)
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestGetPlayerRankApproxWithinBucket(t *testing.T) {
+	ctx := context.Background()
+	const width = 10
+	s := newRedisService(t, WithApproxRank(width))
+
+	scores := make(map[string]int64)
+	for i := range 60 {
+		playerID := fmt.Sprintf("p%02d", i)
+		scores[playerID] = int64(i*37%100 - 20)
+		if err := s.SetScore(ctx, playerID, scores[playerID], testTimestamp+int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 增量更新和删除同样要维护桶计数
+	for i := 0; i < 60; i += 7 {
+		playerID := fmt.Sprintf("p%02d", i)
+		if err := s.UpdateScore(ctx, playerID, 15, testTimestamp); err != nil {
+			t.Fatal(err)
+		}
+		scores[playerID] += 15
+	}
+	for _, playerID := range []string{"p03", "p04"} {
+		if _, err := s.DeletePlayer(ctx, playerID); err != nil {
+			t.Fatal(err)
+		}
+		delete(scores, playerID)
+	}
+
+	perBucket := make(map[int64]int64)
+	for _, score := range scores {
+		perBucket[s.bucketOf(score)]++
+	}
+	for playerID, score := range scores {
+		exact := mustRank(t, s, playerID).Rank
+		approx, err := s.GetPlayerRankApprox(ctx, playerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 估算值取同桶范围的中点, 误差不超过同桶人数的一半
+		if diff, limit := max(approx-exact, exact-approx), perBucket[s.bucketOf(score)]/2; diff > limit {
+			t.Errorf("%s: approx rank %d, exact %d, off by %d > %d", playerID, approx, exact, diff, limit)
+		}
+	}
+}
+
+func TestGetPlayerRankApproxDisabled(t *testing.T) {
+	ctx := context.Background()
+	// RankStore 创建的服务无法维护分数桶, WithApproxRank 不生效
+	for _, s := range []*LeaderboardService{newMemService(t), newMemService(t, WithApproxRank(10))} {
+		if err := s.SetScore(ctx, "player", 1, testTimestamp); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetPlayerRankApprox(ctx, "player"); !errors.Is(err, ErrApproxRankDisabled) {
+			t.Errorf("err = %v, want ErrApproxRankDisabled", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// archiveFormat 和 archiveVersion 标识 ExportCompressed 的归档格式
+const (
+	archiveFormat  = "ranking-archive"
+	archiveVersion = 1
+)
+
+// archiveHeader 是归档中位于导出数据之前的一行 JSON, 记录导出时的编码参数
+type archiveHeader struct {
+	Format               string        `json:"format"`
+	Version              int           `json:"version"`
+	ScoreMultiplier      int64         `json:"scoreMultiplier"`
+	MaxTimestampReversed int64         `json:"maxTimestampReversed"`
+	TimestampUnit        TimestampUnit `json:"timestampUnit"` // 0 为秒, 1 为毫秒
+	Order                SortOrder     `json:"order"`
+	TiebreakMode         TiebreakMode  `json:"tiebreakMode"`
+}
+
+// ExportCompressed 将排行榜写为 gzip 压缩的归档, 用于赛季结束后的冷存储
+// 解压后第一行是记录编码参数 (scoreMultiplier、maxTimestampReversed、时间戳单位、排序方向和同分规则) 的 JSON 头,
+// 之后是与 ExportJSON 相同的 JSON 数组; 数据经 gzip.Writer 流式写出, 不会在内存中缓存整个排行榜
+func (s *LeaderboardService) ExportCompressed(ctx context.Context, w io.Writer) (err error) {
+	defer s.observe(&ctx, "ExportCompressed")(&err)
+	gz := gzip.NewWriter(w)
+	header, err := json.Marshal(archiveHeader{
+		Format:               archiveFormat,
+		Version:              archiveVersion,
+		ScoreMultiplier:      scoreMultiplier,
+		MaxTimestampReversed: maxTimestampReversed,
+		TimestampUnit:        s.timestampUnit,
+		Order:                s.order,
+		TiebreakMode:         s.tiebreakMode,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(append(header, '\n')); err != nil {
+		return err
+	}
+	if err := s.exportJSON(ctx, gz); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportCompressed 读取 ExportCompressed 写出的归档, 写入规则与 ImportJSON 相同
+// 归档中保存的是原始分数和时间戳, 导入时按当前服务的配置重新计算组合分数; 归档的时间戳单位与当前服务不同时先换算,
+// 毫秒换算为秒时截去不足一秒的部分; 格式或版本无法识别, 或 scoreMultiplier 与当前不同时返回错误
+func (s *LeaderboardService) ImportCompressed(ctx context.Context, r io.Reader, mode ImportMode) (err error) {
+	defer s.observe(&ctx, "ImportCompressed")(&err)
+	if err := s.requireRedis("ImportCompressed"); err != nil {
+		return err
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("decode archive: %w", err)
+	}
+	defer gz.Close()
+
+	dec := json.NewDecoder(gz)
+	var header archiveHeader
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("decode archive header: %w", err)
+	}
+	if header.Format != archiveFormat || header.Version != archiveVersion {
+		return fmt.Errorf("unsupported archive %q version %d", header.Format, header.Version)
+	}
+	// 原始分数的安全范围由 scoreMultiplier 决定, 不同时无法保证归档中的分数能被精确还原
+	if header.ScoreMultiplier != scoreMultiplier {
+		return fmt.Errorf("archive score multiplier %d does not match %d", header.ScoreMultiplier, int64(scoreMultiplier))
+	}
+	var entries []exportEntry
+	if err := dec.Decode(&entries); err != nil {
+		return fmt.Errorf("decode import data: %w", err)
+	}
+	if header.TimestampUnit != s.timestampUnit {
+		for i := range entries {
+			if header.TimestampUnit == TimestampMilliseconds {
+				entries[i].Timestamp /= 1000
+			} else {
+				entries[i].Timestamp *= 1000
+			}
+		}
+	}
+	return s.importEntries(ctx, entries, mode)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// recordBestScript 只在新的原始分数严格优于已存储的原始分数时写入, 相当于按原始分数执行 ZADD GT (升序时为 LT)
+// 组合分数直接比较时, 同分不同时间戳的提交也会被当作更好的成绩, 因此先解码出原始分数再比较
+// KEYS[1]: 排行榜 key, KEYS[2] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: playerID, newCombinedScore, newRawScore, scoreMultiplier, 升序时为 '1', bucketWidth (仅在有 KEYS[2] 时使用)
+// 写入返回 1, 未写入返回 0
+var recordBestScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[4])
+local newScore = tonumber(ARGV[3])
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+local oldScore
+if old then
+	old = tonumber(old)
+	oldScore = math.floor(old / multiplier)
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+	end
+	if ARGV[5] == '1' then
+		if newScore >= oldScore then
+			return 0
+		end
+	elseif newScore <= oldScore then
+		return 0
+	end
+end
+if KEYS[2] then
+	local width = tonumber(ARGV[6])
+	if old then
+		redis.call('HINCRBY', KEYS[2], math.floor(oldScore / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[2], math.floor(newScore / width), 1)
+end
+redis.call('ZADD', KEYS[1], ARGV[2], ARGV[1])
+return 1
+`)
+
+// RecordBest 记录玩家的个人最佳成绩: 只有 score 优于已存储的原始分数时才写入 score 和 timestamp, 例如用于成就系统
+// "优于" 按排序方向判断, 降序时为更高, 升序时为更低; 与已存储分数相同的提交不会改写时间戳
+// 玩家不在排行榜上时总是写入; 返回是否确实写入, 分数区间的处理与 SetScore 相同
+func (s *LeaderboardService) RecordBest(ctx context.Context, playerID string, score int64, timestamp int64) (_ bool, err error) {
+	defer s.observePlayer(&ctx, "RecordBest", playerID)(&err)
+	if err := s.requireRedis("RecordBest"); err != nil {
+		return false, err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+	if score < s.minScore || score > s.maxScore {
+		if !s.clampScores {
+			return false, fmt.Errorf("%w: player %s score %d", ErrScoreOutOfRange, playerID, score)
+		}
+		score = min(max(score, s.minScore), s.maxScore)
+	}
+	if timestamp, err = s.resolveTimestamp(ctx, timestamp); err != nil {
+		return false, err
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return false, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return false, err
+	}
+	ascending := "0"
+	if s.order == Ascending {
+		ascending = "1"
+	}
+
+	key := s.key()
+	release, err := s.flushPending(ctx, key, []string{playerID})
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	notify := s.watchRank(ctx, key, member)
+	var cmd *redis.Cmd
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		cmd = recordBestScript.Run(ctx, c, s.scriptKeys(key), member,
+			formatScore(s.combineScore(score, timestamp)), score, scoreMultiplier, ascending, s.bucketWidth)
+		return cmd
+	})
+	written, err := cmd.Int()
+	if err != nil {
+		return false, err
+	}
+	if written == 0 {
+		return false, nil
+	}
+	s.invalidateCached(key, playerID)
+	notify()
+	return true, nil
+}
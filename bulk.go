@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BulkLoad 以 SetScore 的语义快速写入大量玩家, 用于压测和初始化数据, entries 中的 IncrScore 视为绝对分数而不是增量
+// 每 pipelineSize 条记录为一批, 在一次往返中写入 (未开启 WithApproxRank 时为一条 ZADD), 不读取旧值;
+// 每批写入后调用 progress(已写入条数, 总条数), progress 可以为 nil; pipelineSize <= 0 时返回 ErrInvalidLimit
+// 分数区间、时间戳和玩家 ID 的校验与 SetScore 相同, 第一条不合法的记录所在批次及之后的批次不会写入, 之前的批次已经写入;
+// 不记录 WithScoreHistory、不触发 WithRankCrossing 回调; 需要 Redis, 对 RankStore 创建的服务无效
+func (s *LeaderboardService) BulkLoad(ctx context.Context, entries []ScoreUpdate, pipelineSize int, progress func(done, total int)) (err error) {
+	defer s.observe(&ctx, "BulkLoad")(&err)
+	if err := s.requireRedis("BulkLoad"); err != nil {
+		return err
+	}
+	if pipelineSize <= 0 {
+		return fmt.Errorf("%w: pipeline size %d", ErrInvalidLimit, pipelineSize)
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// 整批共用一次读取的服务器时间, 见 WithServerTimestamps
+	var serverNow int64
+	for _, e := range entries {
+		if e.Timestamp == 0 {
+			if serverNow, err = s.resolveTimestamp(ctx, 0); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	key := s.key()
+	for start := 0; start < len(entries); start += pipelineSize {
+		batch := entries[start:min(start+pipelineSize, len(entries))]
+		members := make([]redis.Z, len(batch))
+		scores := make([]int64, len(batch))
+		playerIDs := make([]string, len(batch))
+		for i, e := range batch {
+			score := e.IncrScore
+			if score < s.minScore || score > s.maxScore {
+				if !s.clampScores {
+					return fmt.Errorf("%w: player %s score %d", ErrScoreOutOfRange, e.PlayerID, score)
+				}
+				score = min(max(score, s.minScore), s.maxScore)
+			}
+			timestamp := e.Timestamp
+			if timestamp == 0 {
+				timestamp = serverNow
+			}
+			if err := s.checkTimestamp(timestamp); err != nil {
+				return fmt.Errorf("player %s: %w", e.PlayerID, err)
+			}
+			member, err := s.member(e.PlayerID)
+			if err != nil {
+				return err
+			}
+			members[i] = redis.Z{Score: s.combineScore(score, timestamp), Member: member}
+			scores[i] = score
+			playerIDs[i] = e.PlayerID
+		}
+
+		pipe := s.rdb.Pipeline()
+		if s.bucketWidth > 0 {
+			// 分数桶需要知道旧分数, 每条记录由 bucketWriteScript 单独写入
+			bucketWriteScript.Load(ctx, pipe)
+			for i, z := range members {
+				bucketWriteScript.EvalSha(ctx, pipe, s.scriptKeys(key),
+					z.Member, scoreMultiplier, s.bucketWidth, formatScore(z.Score), scores[i])
+			}
+		} else {
+			pipe.ZAdd(ctx, key, members...)
+		}
+		s.touchExpiry(ctx, pipe, key)
+		_, err := pipe.Exec(ctx)
+		s.invalidateCached(key, playerIDs...)
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(start+len(batch), len(entries))
+		}
+	}
+	return nil
+}
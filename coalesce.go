@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithUpdateCoalescing 在进程内合并同一玩家的 UpdateScore, 每 interval 最多向 Redis 写入一次, interval <= 0 时不开启
+// 开启后 UpdateScore 只校验参数并把增量累加到待写入队列中, 同一玩家的增量求和、时间戳取最后一次传入的值,
+// 后台 goroutine 每隔 interval 用与 UpdateScoresBatch 相同的方式按批写入; 可以随时调用 Flush 立即写入, Close 会先 Flush 再退出
+//
+// 合并后的增量作为一次更新执行, 因此分数区间截断和 WithRejectStaleTimestamps 作用于合并结果而不是每次调用, 也不会触发
+// WithRankCrossing 回调和 WithScoreHistory 记录; TryUpdateScore 等需要立即得到结果的变体不经过合并
+// 写入因 Redis 错误失败的增量会放回队列在下次 Flush 时重试, 校验类错误 (例如 ErrScoreOutOfRange) 则丢弃并通过 Flush 返回或日志报告;
+// SetScore、UpdateScoreWithOpts、ResetPlayerScore、RecordBest、DeletePlayer、DeletePlayers、MergePlayers 在写入前先写入所涉及玩家的合并增量,
+// ResetLeaderboard 和 ResetAndArchive 先写入整个排行榜的合并增量, 因此之前的 UpdateScore 不会在这些写入之后才生效;
+// Close 开始之后 UpdateScore 返回 ErrServiceClosed; 需要 Redis, 对 RankStore 创建的服务无效
+func WithUpdateCoalescing(interval time.Duration) Option {
+	return func(s *LeaderboardService) {
+		if interval > 0 {
+			s.coalescer = &updateCoalescer{
+				interval: interval,
+				pending:  make(map[coalesceKey]*ScoreUpdate),
+				stop:     make(chan struct{}),
+				done:     make(chan struct{}),
+			}
+		}
+	}
+}
+
+// updateCoalescer 保存等待写入的合并增量, 可被并发使用
+type updateCoalescer struct {
+	interval time.Duration
+	mu       sync.Mutex
+	pending  map[coalesceKey]*ScoreUpdate
+	// flushMu 保证同一时间只有一次 Flush 在写入, 使失败重新入队的增量不会与后续写入乱序
+	flushMu  sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	// closed 为 true 时不再接受新的更新, 由 mu 保护
+	closed bool
+}
+
+// coalesceKey 区分更新所属的排行榜 key (时间窗口) 和玩家
+type coalesceKey struct {
+	key      string
+	playerID string
+}
+
+// add 把一次更新合并进队列, close 之后返回 ErrServiceClosed
+func (c *updateCoalescer) add(key string, u ScoreUpdate) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrServiceClosed
+	}
+	k := coalesceKey{key, u.PlayerID}
+	if p, ok := c.pending[k]; ok {
+		p.IncrScore += u.IncrScore
+		p.Timestamp = u.Timestamp
+		return nil
+	}
+	c.pending[k] = &u
+	return nil
+}
+
+// close 使之后的 add 返回 ErrServiceClosed, 已在队列中的更新不受影响
+func (c *updateCoalescer) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+// requeue 把写入失败的增量放回队列, 期间新加入的更新保留自己的时间戳
+func (c *updateCoalescer) requeue(key string, u ScoreUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := coalesceKey{key, u.PlayerID}
+	if p, ok := c.pending[k]; ok {
+		p.IncrScore += u.IncrScore
+		return
+	}
+	c.pending[k] = &u
+}
+
+// take 取出队列中的全部更新并按排行榜 key 分组
+func (c *updateCoalescer) take() map[string][]ScoreUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	batches := make(map[string][]ScoreUpdate)
+	for k, u := range c.pending {
+		batches[k.key] = append(batches[k.key], *u)
+	}
+	clear(c.pending)
+	return batches
+}
+
+// takeKey 取出排行榜 key 上 playerIDs 的更新, playerIDs 为 nil 时取出该 key 上的全部更新
+func (c *updateCoalescer) takeKey(key string, playerIDs []string) []ScoreUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var updates []ScoreUpdate
+	if playerIDs == nil {
+		for k, u := range c.pending {
+			if k.key == key {
+				updates = append(updates, *u)
+				delete(c.pending, k)
+			}
+		}
+		return updates
+	}
+	for _, playerID := range playerIDs {
+		k := coalesceKey{key, playerID}
+		if u, ok := c.pending[k]; ok {
+			updates = append(updates, *u)
+			delete(c.pending, k)
+		}
+	}
+	return updates
+}
+
+// startCoalescing 在开启 WithUpdateCoalescing 时启动后台写入的 goroutine
+func (s *LeaderboardService) startCoalescing() {
+	c := s.coalescer
+	if c == nil || s.rdb == nil {
+		return
+	}
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				if err := s.flushCoalesced(context.Background()); err != nil {
+					s.logger.Error("flush coalesced updates failed", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// stopCoalescing 停止后台写入并等待其退出, 可以重复调用
+func (s *LeaderboardService) stopCoalescing() {
+	c := s.coalescer
+	if c == nil || s.rdb == nil {
+		return
+	}
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
+
+// coalesceUpdate 校验 UpdateScore 的参数并把更新加入合并队列
+func (s *LeaderboardService) coalesceUpdate(ctx context.Context, playerID string, incrScore int64, timestamp int64) error {
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if !s.clampScores {
+		if err := checkIncr(incrScore); err != nil {
+			return fmt.Errorf("player %s: %w", playerID, err)
+		}
+	}
+	// 为 0 的时间戳在写入时才换成服务器时间, 见 WithServerTimestamps
+	if !s.serverTimestamps || timestamp != 0 {
+		if err := s.checkTimestamp(timestamp); err != nil {
+			return err
+		}
+	}
+	if _, err := s.member(playerID); err != nil {
+		return err
+	}
+	return s.coalescer.add(s.key(), ScoreUpdate{PlayerID: playerID, IncrScore: incrScore, Timestamp: timestamp})
+}
+
+// Flush 立即写入所有合并中的更新, 未开启 WithUpdateCoalescing 时不做任何事
+// 返回的 error 由写入失败的 *ScoreUpdateError 组成; 因 Redis 错误失败的增量已放回队列, 之后的 Flush 会重试
+func (s *LeaderboardService) Flush(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "Flush")(&err)
+	return s.flushCoalesced(ctx)
+}
+
+// flushCoalesced 是 Flush 的实现
+func (s *LeaderboardService) flushCoalesced(ctx context.Context) error {
+	c := s.coalescer
+	if c == nil || s.rdb == nil {
+		return nil
+	}
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	var errs []error
+	for key, updates := range c.take() {
+		if err := s.updateScoresBatch(ctx, key, updates); err != nil {
+			errs = append(errs, err)
+			c.requeueFailed(key, updates, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// requeueFailed 把 updates 中因 Redis 错误失败的更新放回队列, 返回是否有更新被放回; err 为 updateScoresBatch 返回的错误
+func (c *updateCoalescer) requeueFailed(key string, updates []ScoreUpdate, err error) bool {
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		// 整批都没有写入, 例如读取服务器时间失败
+		for _, u := range updates {
+			c.requeue(key, u)
+		}
+		return true
+	}
+	byPlayer := make(map[string]ScoreUpdate, len(updates))
+	for _, u := range updates {
+		byPlayer[u.PlayerID] = u
+	}
+	requeued := false
+	for _, e := range joined.Unwrap() {
+		var updateErr *ScoreUpdateError
+		if errors.As(e, &updateErr) && !isCallerError(updateErr.Err) {
+			c.requeue(key, byPlayer[updateErr.PlayerID])
+			requeued = true
+		}
+	}
+	return requeued
+}
+
+// flushPending 在覆盖或删除玩家分数的写入之前调用, 先写入排行榜 key 上 playerIDs (为 nil 时为全部玩家) 的合并增量,
+// 并在返回的函数被调用之前阻止其他 Flush, 使已取出的增量不会在这次写入之后才生效; 写入结束时必须调用返回的函数
+// 增量因 Redis 错误写入失败时放回队列并返回错误, 此时不应继续写入; 因校验错误被丢弃的增量只记录日志
+func (s *LeaderboardService) flushPending(ctx context.Context, key string, playerIDs []string) (func(), error) {
+	c := s.coalescer
+	if c == nil || s.rdb == nil {
+		return func() {}, nil
+	}
+	c.flushMu.Lock()
+	updates := c.takeKey(key, playerIDs)
+	if err := s.updateScoresBatch(ctx, key, updates); err != nil {
+		if c.requeueFailed(key, updates, err) {
+			c.flushMu.Unlock()
+			return nil, fmt.Errorf("flush coalesced updates: %w", err)
+		}
+		s.logger.Error("flush coalesced updates failed", "error", err)
+	}
+	return c.flushMu.Unlock, nil
+}
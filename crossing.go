@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RankCrossing 描述一名玩家的排名跨过了阈值, 例如进入或跌出前 10 名
+type RankCrossing struct {
+	PlayerID  string `json:"playerId"`
+	Threshold int64  `json:"threshold"`
+	// OldRank 为更新前的排名, 0 表示更新前不在排行榜上
+	OldRank int64 `json:"oldRank"`
+	NewRank int64 `json:"newRank"`
+	// Entered 为 true 表示进入前 Threshold 名, 为 false 表示跌出
+	Entered bool `json:"entered"`
+}
+
+// rankWatcher 是通过 WithRankCrossing 注册的一个阈值及其回调
+type rankWatcher struct {
+	threshold int64
+	fn        func(RankCrossing)
+}
+
+// WithRankCrossing 注册一个回调, 当 UpdateScore (及其变体)、SetScore 或 RecordBest 让玩家进入或跌出前 threshold 名时调用
+// 除了被更新的玩家, 因此被挤出 (或补入) 前 threshold 名的玩家也会触发回调
+// 回调在新的 goroutine 中执行, 不会阻塞写入; 多次使用该选项可以注册多个阈值
+// 更新前后的排名各需要一次额外读取, 二者与写入之间不是原子的, 并发写入很多时可能漏报或多报; UpdateScoresBatch 不触发回调
+func WithRankCrossing(threshold int64, fn func(RankCrossing)) Option {
+	return func(s *LeaderboardService) {
+		if threshold > 0 && fn != nil {
+			s.rankWatchers = append(s.rankWatchers, rankWatcher{threshold: threshold, fn: fn})
+		}
+	}
+}
+
+// noopNotify 是未注册 RankCrossing 回调时 watchRank 返回的空函数
+func noopNotify() {}
+
+// watchRank 在写入前记录玩家的排名, 返回的函数应在写入成功后调用, 它读取新排名并异步触发跨过阈值的回调
+// member 为编码后的成员; 未注册回调时不做任何读取; 读取排名失败只会跳过通知, 不影响写入结果
+func (s *LeaderboardService) watchRank(ctx context.Context, key string, member string) func() {
+	if len(s.rankWatchers) == 0 {
+		return noopNotify
+	}
+	oldRank, err := s.rankOrZero(ctx, key, member)
+	if err != nil {
+		s.logger.Warn("skip rank crossing check", "key", key, "error", err)
+		return noopNotify
+	}
+	return func() {
+		newRank, err := s.rankOrZero(ctx, key, member)
+		if err != nil {
+			s.logger.Warn("skip rank crossing check", "key", key, "error", err)
+			return
+		}
+		if newRank == oldRank {
+			return
+		}
+		playerID, err := s.decodeMember(member)
+		if err != nil {
+			return
+		}
+		for _, w := range s.rankWatchers {
+			wasIn := oldRank > 0 && oldRank <= w.threshold
+			isIn := newRank > 0 && newRank <= w.threshold
+			if wasIn == isIn {
+				continue
+			}
+			go w.fn(RankCrossing{PlayerID: playerID, Threshold: w.threshold, OldRank: oldRank, NewRank: newRank, Entered: isIn})
+
+			// 被更新的玩家进入时, 原来的第 threshold 名被挤到第 threshold+1 名; 跌出时则相反
+			boundary := w.threshold
+			if !isIn {
+				boundary = w.threshold - 1
+			}
+			results, err := s.rangeWithScores(ctx, s.store, key, boundary, boundary).Result()
+			if err != nil || len(results) == 0 {
+				continue
+			}
+			other, err := memberID(results[0])
+			if err != nil || other == member {
+				continue
+			}
+			if other, err = s.decodeMember(other); err != nil {
+				continue
+			}
+			crossing := RankCrossing{PlayerID: other, Threshold: w.threshold, OldRank: w.threshold, NewRank: w.threshold + 1}
+			if !isIn {
+				crossing = RankCrossing{PlayerID: other, Threshold: w.threshold, OldRank: w.threshold + 1, NewRank: w.threshold, Entered: true}
+			}
+			go w.fn(crossing)
+		}
+	}
+}
+
+// rankOrZero 返回成员的 1-based 排名, 不在排行榜上时返回 0
+func (s *LeaderboardService) rankOrZero(ctx context.Context, key string, member string) (int64, error) {
+	rank, err := s.rank(ctx, s.store, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return rank + 1, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// decayBatchSize 为 ApplyDecay 每次扫描和写回的成员数
+const decayBatchSize = 500
+
+// decayScript 仅当成员的组合分数仍等于读取时的值才写入衰减后的分数,
+// 避免覆盖扫描期间发生的并发更新
+// KEYS[1]: 排行榜 key
+// ARGV: member1, oldCombinedScore1, newCombinedScore1, member2, ...
+// 返回实际写入的成员数
+var decayScript = redis.NewScript(`
+local written = 0
+for i = 1, #ARGV, 3 do
+	local current = redis.call('ZSCORE', KEYS[1], ARGV[i])
+	if current and tonumber(current) == tonumber(ARGV[i + 1]) then
+		redis.call('ZADD', KEYS[1], ARGV[i + 2], ARGV[i])
+		written = written + 1
+	end
+end
+return written
+`)
+
+// decayedAtKey 返回记录排行榜 key 上一次执行 ApplyDecay 的时间 (unix 毫秒) 的 key
+func (s *LeaderboardService) decayedAtKey(key string) string {
+	return key + ":decayed_at"
+}
+
+// ApplyDecay 按半衰期对所有玩家的原始分数做指数衰减:
+// newScore = score * 0.5^(age / halfLife), 其中 age 为距该玩家最后一次更新和距上一次 ApplyDecay 两者中较短的时长
+// 每次执行 (dryRun 除外) 都会在 <key>:decayed_at 中记录本次的时间, 因此定期执行时每段时间只衰减一次, 不会重复叠加
+// 时间戳 (以及同分排序) 保持不变, 衰减后分数不变的成员不会被写入
+// dryRun 为 true 时只统计会变化的成员数而不写入; 否则返回实际写入的成员数,
+// 扫描期间被并发更新的成员会被跳过; 写入后清空查询缓存, 开启 WithApproxRank 时与 RecomputeAll 一样重建分数桶
+func (s *LeaderboardService) ApplyDecay(ctx context.Context, halfLife time.Duration, dryRun bool) (_ int64, err error) {
+	defer s.observe(&ctx, "ApplyDecay")(&err)
+	if err := s.requireRedis("ApplyDecay"); err != nil {
+		return 0, err
+	}
+	if halfLife <= 0 {
+		return 0, fmt.Errorf("invalid half life %s", halfLife)
+	}
+	if !dryRun {
+		done, err := s.beginWrite(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer done()
+	}
+	key := s.key()
+	now := time.Now()
+	// 上一次衰减之前的时间已经衰减过, age 最多从那时算起
+	var decayedAt time.Time
+	ms, err := s.rdb.Get(ctx, s.decayedAtKey(key)).Int64()
+	switch {
+	case err == nil:
+		decayedAt = time.UnixMilli(ms)
+	case !errors.Is(err, redis.Nil):
+		return 0, err
+	}
+
+	// 先完整扫描再写回: ZSCAN 可能重复返回成员, 用 map 去重避免重复衰减
+	pending := make(map[string][2]float64)
+	var cursor uint64
+	for {
+		members, next, err := s.rdb.ZScan(ctx, key, cursor, "", decayBatchSize).Result()
+		if err != nil {
+			return 0, err
+		}
+		// ZSCAN 的结果为 member, score 交替排列
+		for i := 0; i+1 < len(members); i += 2 {
+			combinedScore, err := strconv.ParseFloat(members[i+1], 64)
+			if err != nil {
+				return 0, err
+			}
+			if err := checkFinite(members[i], combinedScore); err != nil {
+				return 0, err
+			}
+			score, timestamp := s.decodeScore(combinedScore)
+			age := now.Sub(s.timeOf(timestamp))
+			if !decayedAt.IsZero() {
+				age = min(age, now.Sub(decayedAt))
+			}
+			if age <= 0 {
+				continue
+			}
+			decayed := int64(float64(score) * math.Pow(0.5, age.Seconds()/halfLife.Seconds()))
+			if decayed == score {
+				continue
+			}
+			pending[members[i]] = [2]float64{combinedScore, s.combineScore(decayed, timestamp)}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	if dryRun {
+		return int64(len(pending)), nil
+	}
+
+	var written int64
+	args := make([]interface{}, 0, decayBatchSize*3)
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		n, err := decayScript.Run(ctx, s.rdb, []string{key}, args...).Int64()
+		if err != nil {
+			return err
+		}
+		written += n
+		args = args[:0]
+		return nil
+	}
+	for member, scores := range pending {
+		args = append(args, member, scores[0], scores[1])
+		if len(args) >= decayBatchSize*3 {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	err = flush()
+	if written > 0 {
+		s.topCache.clear()
+		s.rankCache.clear()
+	}
+	if err != nil {
+		return written, err
+	}
+	if s.bucketWidth > 0 && written > 0 {
+		if err := s.rebuildRankBuckets(ctx); err != nil {
+			return written, err
+		}
+	}
+	// 标记与周期 key 一同过期, ResetLeaderboard 也会删除它
+	pipe := s.rdb.Pipeline()
+	pipe.Set(ctx, s.decayedAtKey(key), now.UnixMilli(), 0)
+	if deadline, _, ok := s.writeDeadline(); ok {
+		pipe.ExpireAt(ctx, s.decayedAtKey(key), deadline)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return written, err
+	}
+	return written, nil
+}
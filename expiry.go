@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SetExpiry 让当前排行榜在 d 之后过期, 排行榜不存在时返回 ErrLeaderboardKeyMissing
+// 过期后 key 被 Redis 删除, 之后的 UpdateScore 等写入会重新创建一个不带过期时间的空排行榜,
+// 需要再次调用 SetExpiry 才会重新过期; 再次调用会以新的 d 覆盖原来的过期时间
+func (s *LeaderboardService) SetExpiry(ctx context.Context, d time.Duration) (err error) {
+	defer s.observe(&ctx, "SetExpiry")(&err)
+	if err := s.requireRedis("SetExpiry"); err != nil {
+		return err
+	}
+	keys := s.scriptKeys(s.key())
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.BoolCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Expire(ctx, key, d)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	if !cmds[0].Val() {
+		return fmt.Errorf("%w: %s", ErrLeaderboardKeyMissing, keys[0])
+	}
+	return nil
+}
+
+// WithWindowExpiry 让时间窗口排行榜在周期结束 grace 之后自动过期, 对总榜无效
+// 每次 UpdateScore、TryUpdateScore、SetScore 和 UpdateScoresBatch 写入后都会重新设置过期时间,
+// 因此即使周期 key 被提前删除后又重新写入, 新建的 key 同样会按时过期; 需要 Redis, 对 RankStore 创建的服务无效
+func WithWindowExpiry(grace time.Duration) Option {
+	return func(s *LeaderboardService) {
+		s.windowGrace = grace
+	}
+}
+
+// expiryDeadline 返回当前周期 key 的过期时间, 未开启 WithWindowExpiry 或为总榜时 ok 为 false
+func (s *LeaderboardService) expiryDeadline() (_ time.Time, ok bool) {
+	if s.windowGrace <= 0 || s.window == WindowAllTime {
+		return time.Time{}, false
+	}
+	return windowEnd(s.window, time.Now(), s.weekStart).Add(s.windowGrace), true
+}
+
+// WithSlidingTTL 让排行榜 key 在最后一次写入 ttl 之后过期, 用于 "最近 24 小时活跃" 这类持续有写入就一直保留的榜单, ttl <= 0 时不开启
+// 每次写入都用 PEXPIRE 把 key 的剩余时间重新设置为 ttl; UpdateScore 及其变体、UpdateScoreWithOpts、SetScore、RecordBest 和 UpdateMetrics
+// 把 PEXPIRE 与写入放在同一个 pipeline 中, UpdateScoresBatch 和 BulkLoad 加入批量写入的 pipeline, 都不增加往返;
+// 放在同一个 pipeline 中意味着条件不满足或分数超出区间而没有写入时也会刷新过期时间
+// 与 WithWindowExpiry 同时开启时取两者中较早的过期时间; 需要 Redis, 对 RankStore 创建的服务无效
+func WithSlidingTTL(ttl time.Duration) Option {
+	return func(s *LeaderboardService) {
+		s.slidingTTL = max(ttl, 0)
+	}
+}
+
+// writeDeadline 返回刚写入的 key 应该过期的时间, sliding 为 true 时该时间由 WithSlidingTTL 决定, 应以 PEXPIRE 设置
+// 未开启 WithWindowExpiry 和 WithSlidingTTL 时 ok 为 false
+func (s *LeaderboardService) writeDeadline() (deadline time.Time, sliding, ok bool) {
+	deadline, ok = s.expiryDeadline()
+	if s.slidingTTL > 0 {
+		if slide := time.Now().Add(s.slidingTTL); !ok || slide.Before(deadline) {
+			return slide, true, true
+		}
+	}
+	return deadline, false, ok
+}
+
+// touchExpiry 在开启 WithWindowExpiry 或 WithSlidingTTL 时为刚写入的 key 设置过期时间, 命令加入 c 中执行
+func (s *LeaderboardService) touchExpiry(ctx context.Context, c redis.Cmdable, key string) {
+	deadline, sliding, ok := s.writeDeadline()
+	if !ok || s.rdb == nil {
+		return
+	}
+	for _, k := range s.scriptKeys(key) {
+		if sliding {
+			c.PExpire(ctx, k, s.slidingTTL)
+		} else {
+			c.ExpireAt(ctx, k, deadline)
+		}
+	}
+}
+
+// writeWithExpiry 执行 write 中的一条写入命令, write 应把命令发往 c 并返回该命令, c 为 nil 时 (RankStore 创建的服务) 改用 s.store
+// 需要设置过期时间时 c 是一个 pipeline, touchExpiry 的命令跟在写入之后一起执行, 不增加往返; 否则 c 为 s.rdb
+// 脚本应通过 Script.Run 发送: 在 pipeline 中它只会发送 EVALSHA, 返回 NOSCRIPT 时直接在 s.rdb 上重新执行一次 write 并重新设置过期时间
+func (s *LeaderboardService) writeWithExpiry(ctx context.Context, key string, write func(c redis.Cmdable) redis.Cmder) {
+	if s.rdb == nil {
+		write(nil)
+		return
+	}
+	if _, _, ok := s.writeDeadline(); !ok {
+		write(s.rdb)
+		return
+	}
+	pipe := s.rdb.Pipeline()
+	cmd := write(pipe)
+	s.touchExpiry(ctx, pipe, key)
+	// 写入命令的错误由调用方从 cmd 中读取, 过期时间设置失败与之前一样忽略
+	_, _ = pipe.Exec(ctx)
+	if redis.HasErrorPrefix(cmd.Err(), "NOSCRIPT") {
+		// pipeline 中的过期时间命令在写入之前作用于可能还不存在的 key, 重新写入后需要再设置一次
+		write(s.rdb)
+		s.touchExpiry(ctx, s.rdb, key)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// exportBatchSize 为 ExportJSON 每次从 Redis 读取的成员数
+const exportBatchSize = 1000
+
+// ImportMode 决定 ImportJSON 如何处理排行榜上已有的数据
+type ImportMode int
+
+const (
+	// ImportMerge 保留已有玩家, 导入数据中出现的玩家以导入的分数为准
+	ImportMerge ImportMode = iota
+	// ImportReplace 先清空排行榜再写入导入数据
+	ImportReplace
+)
+
+// exportEntry 是导出文件中的一条记录, 只保存还原组合分数所需的字段
+type exportEntry struct {
+	PlayerID  string `json:"playerId"`
+	Score     int64  `json:"score"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// ExportJSON 将整个排行榜按排名顺序写为 JSON 数组 [{playerId, score, timestamp}, ...]
+// 通过 IterateAll 分批读取并逐条写出, 不会一次性载入全部成员
+func (s *LeaderboardService) ExportJSON(ctx context.Context, w io.Writer) (err error) {
+	defer s.observe(&ctx, "ExportJSON")(&err)
+	return s.exportJSON(ctx, w)
+}
+
+// exportJSON 是 ExportJSON 的实现
+func (s *LeaderboardService) exportJSON(ctx context.Context, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString("["); err != nil {
+		return err
+	}
+	entries, errc := s.iterate(ctx, exportBatchSize, false)
+	first := true
+	for info := range entries {
+		data, err := json.Marshal(exportEntry{PlayerID: info.PlayerID, Score: info.Score, Timestamp: info.Timestamp})
+		if err != nil {
+			return err
+		}
+		if !first {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+	if _, err := bw.WriteString("]\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// ImportJSON 读取 ExportJSON 的输出并按当前排序方向重新计算组合分数写回排行榜
+// 所有写入在一个 MULTI/EXEC 事务中提交, 任意一条记录不合法时不会写入任何数据
+// 分数和时间戳原样保留, 因此导入后的排名顺序 (包括同分的先后) 与导出时一致
+// 与其他写入一样受 Shutdown 和 Freeze 限制, 并按 WithWindowExpiry、WithSlidingTTL 设置过期时间
+func (s *LeaderboardService) ImportJSON(ctx context.Context, r io.Reader, mode ImportMode) (err error) {
+	defer s.observe(&ctx, "ImportJSON")(&err)
+	if err := s.requireRedis("ImportJSON"); err != nil {
+		return err
+	}
+	var entries []exportEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return fmt.Errorf("decode import data: %w", err)
+	}
+	return s.importEntries(ctx, entries, mode)
+}
+
+// importEntries 在一个事务中把导出记录写回排行榜, 见 ImportJSON
+// 导入可能改变任意玩家的排名, 成功后清空本服务的缓存, 并在开启 WithApproxRank 时重建分数桶
+func (s *LeaderboardService) importEntries(ctx context.Context, entries []exportEntry, mode ImportMode) error {
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	members := make([]redis.Z, len(entries))
+	for i, e := range entries {
+		if err := checkScore(e.Score); err != nil {
+			return fmt.Errorf("player %s: %w", e.PlayerID, err)
+		}
+		if err := s.checkTimestamp(e.Timestamp); err != nil {
+			return fmt.Errorf("player %s: %w", e.PlayerID, err)
+		}
+		member, err := s.member(e.PlayerID)
+		if err != nil {
+			return err
+		}
+		members[i] = redis.Z{Score: s.combineScore(e.Score, e.Timestamp), Member: member}
+	}
+
+	key := s.key()
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if mode == ImportReplace {
+			pipe.Del(ctx, key)
+		}
+		for start := 0; start < len(members); start += exportBatchSize {
+			end := min(start+exportBatchSize, len(members))
+			pipe.ZAdd(ctx, key, members[start:end]...)
+		}
+		s.touchExpiry(ctx, pipe, key)
+		return nil
+	})
+	s.topCache.clear()
+	s.rankCache.clear()
+	if err != nil {
+		return err
+	}
+	if s.bucketWidth > 0 {
+		return s.rebuildRankBuckets(ctx)
+	}
+	return nil
+}
+
+// WriteTopNCSV 将前 n 名写为 CSV, 第一行为表头 rank,playerId,score,timestamp, n <= 0 时返回 ErrInvalidLimit
+// 每次读取 exportBatchSize 名并在写完后 Flush, 不会在内存中缓存整个结果; 玩家 ID 中的逗号、引号和换行按 RFC 4180 转义
+// 排名与 GetTopN 相同, 时间戳未知时 (TiebreakPlayerID 模式) 该列为空
+func (s *LeaderboardService) WriteTopNCSV(ctx context.Context, w io.Writer, n int64) (err error) {
+	defer s.observe(&ctx, "WriteTopNCSV")(&err)
+	if n <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"rank", "playerId", "score", "timestamp"}); err != nil {
+		return err
+	}
+	key := s.key()
+	for start := int64(0); start < n; start += exportBatchSize {
+		stop := min(start+exportBatchSize, n) - 1
+		results, err := s.rangeResolved(ctx, key, start, stop)
+		if err != nil {
+			return err
+		}
+		infos, err := s.toRankInfos(results, start+1)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			timestamp := ""
+			if info.Timestamp != 0 {
+				timestamp = strconv.FormatInt(info.Timestamp, 10)
+			}
+			row := []string{strconv.FormatInt(info.Rank, 10), info.PlayerID, strconv.FormatInt(info.Score, 10), timestamp}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if int64(len(results)) < stop-start+1 {
+			break
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
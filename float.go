@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FloatRankInfo 存储小数分数排行榜中玩家的排名信息
+type FloatRankInfo struct {
+	PlayerID  string  `json:"playerId"`
+	Score     float64 `json:"score"`
+	Rank      int64   `json:"rank"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// 小数分数无法与时间戳组合进同一个 float64 而不损失精度, 因此分开存储:
+// <key>:float 有序集合的 score 为原始小数分数, <key>:float:ts 哈希记录每个玩家最后一次更新的时间戳
+// 分数完全相同时按时间戳 (越早越靠前) 再按玩家 ID 排序, 与整数排行榜的同分规则一致
+
+// updateScoreFloatScript 原子地增加小数分数并记录时间戳
+// KEYS[1]: 分数有序集合, KEYS[2]: 时间戳哈希
+// ARGV: playerID, incrScore, timestamp
+var updateScoreFloatScript = redis.NewScript(`
+redis.call('ZINCRBY', KEYS[1], ARGV[2], ARGV[1])
+redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+return 1
+`)
+
+// floatRankScript 计算玩家在小数分数排行榜中的排名: 分数更好的人数, 加上同分中时间戳更早的人数, 再加一
+// KEYS[1]: 分数有序集合, KEYS[2]: 时间戳哈希
+// ARGV: playerID, 升序时为 '1'
+// 返回 {rank, score, timestamp}, 玩家不存在时返回 nil
+var floatRankScript = redis.NewScript(`
+local score = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not score then
+	return false
+end
+local ts = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+local better
+if ARGV[2] == '1' then
+	better = redis.call('ZCOUNT', KEYS[1], '-inf', '(' .. score)
+else
+	better = redis.call('ZCOUNT', KEYS[1], '(' .. score, '+inf')
+end
+for _, member in ipairs(redis.call('ZRANGEBYSCORE', KEYS[1], score, score)) do
+	if member ~= ARGV[1] then
+		local other = tonumber(redis.call('HGET', KEYS[2], member) or '0')
+		if other < ts or (other == ts and member < ARGV[1]) then
+			better = better + 1
+		end
+	end
+end
+return {better + 1, score, tostring(ts)}
+`)
+
+// floatKeys 返回当前小数分数排行榜的有序集合 key 和时间戳哈希 key
+func (s *LeaderboardService) floatKeys() (string, string) {
+	key := s.key() + ":float"
+	return key, key + ":ts"
+}
+
+// UpdateScoreFloat 为玩家增加小数分数 incrScore, 保留小数部分, 同分时时间戳越早排名越靠前
+// 小数分数存储在独立的排行榜中, 通过 GetPlayerRankFloat 和 GetTopNFloat 查询
+func (s *LeaderboardService) UpdateScoreFloat(ctx context.Context, playerID string, incrScore float64, timestamp int64) (err error) {
+	defer s.observePlayer(&ctx, "UpdateScoreFloat", playerID)(&err)
+	if err := s.requireRedis("UpdateScoreFloat"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	member, err := s.member(playerID)
+	if err != nil {
+		return err
+	}
+	key, tsKey := s.floatKeys()
+	return updateScoreFloatScript.Run(ctx, s.rdb, []string{key, tsKey}, member, incrScore, timestamp).Err()
+}
+
+// GetPlayerRankFloat 查询玩家在小数分数排行榜中的排名
+func (s *LeaderboardService) GetPlayerRankFloat(ctx context.Context, playerID string) (_ *FloatRankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankFloat", playerID)(&err)
+	if err := s.requireRedis("GetPlayerRankFloat"); err != nil {
+		return nil, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	key, tsKey := s.floatKeys()
+	ascending := "0"
+	if s.order == Ascending {
+		ascending = "1"
+	}
+	values, err := floatRankScript.Run(ctx, s.rdb, []string{key, tsKey}, member, ascending).Slice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	if len(values) != 3 {
+		return nil, fmt.Errorf("unexpected rank script reply: %v", values)
+	}
+	rank, _ := values[0].(int64)
+	scoreStr, _ := values[1].(string)
+	tsStr, _ := values[2].(string)
+	score, err := strconv.ParseFloat(scoreStr, 64)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := strconv.ParseInt(tsStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &FloatRankInfo{PlayerID: playerID, Score: score, Rank: rank, Timestamp: timestamp}, nil
+}
+
+// GetTopNFloat 获取小数分数排行榜的前 N 名玩家
+// 第 N 名所在的同分组可能跨越窗口边界, 因此会额外读取整个同分组后再按时间戳排序截断
+func (s *LeaderboardService) GetTopNFloat(ctx context.Context, n int64) (_ []FloatRankInfo, err error) {
+	defer s.observe(&ctx, "GetTopNFloat")(&err)
+	if err := s.requireRedis("GetTopNFloat"); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	key, tsKey := s.floatKeys()
+	results, err := s.rangeWithScores(ctx, s.reader, key, 0, n-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(results)) == n {
+		last := formatScore(results[len(results)-1].Score)
+		ties, err := s.rangeBetweenScores(ctx, s.reader, key, last, last).Result()
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[interface{}]bool, len(results))
+		for _, z := range results {
+			seen[z.Member] = true
+		}
+		for _, z := range ties {
+			if !seen[z.Member] {
+				results = append(results, z)
+			}
+		}
+	}
+	if len(results) == 0 {
+		return []FloatRankInfo{}, nil
+	}
+
+	members := make([]string, len(results))
+	for i, z := range results {
+		if members[i], err = memberID(z); err != nil {
+			return nil, err
+		}
+	}
+	timestamps, err := s.reader.HMGet(ctx, tsKey, members...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	rankings := make([]FloatRankInfo, len(results))
+	for i, z := range results {
+		playerID, err := s.decodeMember(members[i])
+		if err != nil {
+			return nil, err
+		}
+		rankings[i] = FloatRankInfo{PlayerID: playerID, Score: z.Score}
+		if tsStr, ok := timestamps[i].(string); ok {
+			rankings[i].Timestamp, _ = strconv.ParseInt(tsStr, 10, 64)
+		}
+	}
+	sort.SliceStable(rankings, func(i, j int) bool {
+		a, b := rankings[i], rankings[j]
+		if a.Score != b.Score {
+			return (a.Score > b.Score) != (s.order == Ascending)
+		}
+		if a.Timestamp != b.Timestamp {
+			return a.Timestamp < b.Timestamp
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	if int64(len(rankings)) > n {
+		rankings = rankings[:n]
+	}
+	for i := range rankings {
+		rankings[i].Rank = int64(i + 1)
+	}
+	return rankings, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// gcBatchSize 为 GC 每次 SCAN 建议返回的 key 数, 也是一次检查并删除的 key 数上限
+const gcBatchSize = 500
+
+// gcScript 删除所属成员已不在排行榜上的 key, 检查和删除在同一个脚本中完成, 期间重新上榜的玩家的 key 不会被删除
+// KEYS[1]: 排行榜 key, KEYS[2..]: 待检查的 key; ARGV[i]: KEYS[i+1] 所属的成员
+// 返回实际删除的 key 数
+var gcScript = redis.NewScript(`
+local removed = 0
+for i = 1, #ARGV do
+	if not redis.call('ZSCORE', KEYS[1], ARGV[i]) then
+		removed = removed + redis.call('DEL', KEYS[i + 1])
+	end
+end
+return removed
+`)
+
+// GC 删除所属玩家已不在排行榜上的附属 key, 返回删除的 key 数, 用于清理直接 ZREM 或过期等方式移除玩家后遗留的数据
+// 清理当前排行榜 key 下的分数历史、附加排序字段和原始指标 (无论对应功能现在是否开启), 以及总榜的元数据哈希;
+// 时间窗口排行榜的元数据在各周期之间共用, 不在当前周期榜上的玩家不代表已被移除, 因此不清理元数据;
+// WithMetadataPrefix 设置的前缀可能与其他数据共用, 同样不清理元数据
+// 用 SCAN 分批遍历, 每批的检查和删除在一个 Lua 脚本中原子地完成, 仍在榜上的玩家的数据不会被删除, 可以定期执行;
+// 尚未上榜就写入了元数据的玩家会被视为已移除; 需要 Redis, 对 RankStore 创建的服务返回 ErrRedisRequired
+func (s *LeaderboardService) GC(ctx context.Context) (removed int64, err error) {
+	defer s.observe(&ctx, "GC")(&err)
+	if err := s.requireRedis("GC"); err != nil {
+		return 0, err
+	}
+	key := s.key()
+	// 这些 key 以编码后的成员结尾
+	keyMember := func(suffix string) (string, bool) { return suffix, true }
+	for _, prefix := range []string{s.historyKey(key, ""), s.tiebreakValuesKey(key, ""), s.metricsKey(key, "")} {
+		n, err := s.gcPrefix(ctx, key, prefix, keyMember)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	if s.window != WindowAllTime || s.metaPrefix != "" {
+		return removed, nil
+	}
+	// 元数据哈希以玩家 ID 结尾, 无法编码的 ID 不属于任何成员, 保留不动
+	n, err := s.gcPrefix(ctx, key, s.metadataKey(""), func(playerID string) (string, bool) {
+		member, err := s.member(playerID)
+		return member, err == nil
+	})
+	return removed + n, err
+}
+
+// gcPrefix 扫描以 prefix 开头的 key, toMember 把 prefix 之后的部分换算为所属成员, ok 为 false 的 key 保留
+func (s *LeaderboardService) gcPrefix(ctx context.Context, key, prefix string, toMember func(suffix string) (member string, ok bool)) (int64, error) {
+	var (
+		removed int64
+		cursor  uint64
+	)
+	match := escapeGlob(prefix) + "*"
+	for {
+		found, next, err := s.rdb.Scan(ctx, cursor, match, gcBatchSize).Result()
+		if err != nil {
+			return removed, err
+		}
+		keys := make([]string, 1, len(found)+1)
+		keys[0] = key
+		args := make([]interface{}, 0, len(found))
+		for _, k := range found {
+			if member, ok := toMember(strings.TrimPrefix(k, prefix)); ok {
+				keys = append(keys, k)
+				args = append(args, member)
+			}
+		}
+		if len(args) > 0 {
+			n, err := gcScript.Run(ctx, s.rdb, keys, args...).Int64()
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+		cursor = next
+		if cursor == 0 {
+			return removed, nil
+		}
+	}
+}
+
+// escapeGlob 转义 s 中 SCAN MATCH 的通配符, 使其按字面匹配
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
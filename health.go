@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrRedisUnreachable 表示无法连接到 Redis
+	ErrRedisUnreachable = errors.New("redis unreachable")
+	// ErrLeaderboardKeyMissing 表示 Redis 可用但排行榜 key 不存在
+	ErrLeaderboardKeyMissing = errors.New("leaderboard key missing")
+	// ErrLeaderboardKeyWrongType 表示排行榜 key 存在但不是有序集合
+	ErrLeaderboardKeyWrongType = errors.New("leaderboard key is not a sorted set")
+)
+
+// HealthCheck 检查 Redis 连接和排行榜 key 是否可用, 可用于就绪探针
+// 返回的错误可通过 errors.Is 区分 ErrRedisUnreachable、ErrLeaderboardKeyMissing 和 ErrLeaderboardKeyWrongType
+func (s *LeaderboardService) HealthCheck(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "HealthCheck")(&err)
+	if err := s.requireRedis("HealthCheck"); err != nil {
+		return err
+	}
+	if err := s.rdb.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisUnreachable, err)
+	}
+
+	key := s.key()
+	keyType, err := s.rdb.Type(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisUnreachable, err)
+	}
+	switch keyType {
+	case "zset":
+		return nil
+	case "none":
+		return fmt.Errorf("%w: %s", ErrLeaderboardKeyMissing, key)
+	default:
+		return fmt.Errorf("%w: %s is %s", ErrLeaderboardKeyWrongType, key, keyType)
+	}
+}
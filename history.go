@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrHistoryDisabled 表示服务未通过 WithScoreHistory 开启分数历史
+var ErrHistoryDisabled = errors.New("score history is not enabled")
+
+// ScorePoint 是玩家分数历史中的一条记录
+type ScorePoint struct {
+	Score     int64 `json:"score"`
+	Timestamp int64 `json:"timestamp"` // 写入这次分数时传入的时间戳
+}
+
+// recordHistoryScript 读取玩家当前的原始分数, 以 "score:timestamp" 的形式加入历史列表头部并裁剪到 limit 条
+// 读取分数和写入历史在同一个脚本中完成, 记录的总是写入时排行榜上的分数
+// KEYS[1]: 排行榜 key, KEYS[2]: 玩家的历史列表, ARGV: playerID, scoreMultiplier, timestamp, limit, 过期时间 (unix 秒, 0 表示不设置)
+var recordHistoryScript = redis.NewScript(`
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not old then
+	return 0
+end
+local multiplier = tonumber(ARGV[2])
+old = tonumber(old)
+local score = math.floor(old / multiplier)
+local part = old - score * multiplier
+if part < 0 then
+	score = score - 1
+elseif part >= multiplier then
+	score = score + 1
+end
+redis.call('LPUSH', KEYS[2], string.format('%.0f', score) .. ':' .. ARGV[3])
+redis.call('LTRIM', KEYS[2], 0, tonumber(ARGV[4]) - 1)
+if ARGV[5] ~= '0' then
+	redis.call('EXPIREAT', KEYS[2], ARGV[5])
+end
+return 1
+`)
+
+// WithScoreHistory 为每个玩家保留最近 limit 次写入后的分数, 用于绘制成长曲线, limit <= 0 时不开启
+// UpdateScore (及其变体) 和 SetScore 写入成功后会把新分数和时间戳加入列表 <key>:history:<playerID>, 并用 LTRIM 限制长度;
+// 记录历史需要一次额外的往返, 失败时只输出 Warn 日志而不影响已完成的写入; 需要 Redis, 对 RankStore 创建的服务无效
+func WithScoreHistory(limit int64) Option {
+	return func(s *LeaderboardService) {
+		s.historyLimit = max(limit, 0)
+	}
+}
+
+// historyKey 返回玩家分数历史列表的 key, member 为编码后的成员
+func (s *LeaderboardService) historyKey(key, member string) string {
+	return key + ":history:" + member
+}
+
+// recordHistory 在开启 WithScoreHistory 时记录玩家写入后的分数
+func (s *LeaderboardService) recordHistory(ctx context.Context, key, member string, timestamp int64) {
+	if s.historyLimit <= 0 || s.rdb == nil {
+		return
+	}
+	var expireAt int64
+	if deadline, _, ok := s.writeDeadline(); ok {
+		expireAt = deadline.Unix()
+	}
+	err := recordHistoryScript.Run(ctx, s.rdb, []string{key, s.historyKey(key, member)},
+		member, scoreMultiplier, timestamp, s.historyLimit, expireAt).Err()
+	if err != nil {
+		s.logger.Warn("record score history failed", "member", member, "error", err)
+	}
+}
+
+// GetPlayerHistory 返回玩家最近 limit 条分数记录, 按写入时间从新到旧排列, 最多保留 WithScoreHistory 设置的条数
+// 没有历史的玩家返回空切片; limit <= 0 时返回 ErrInvalidLimit, 未开启分数历史时返回 ErrHistoryDisabled
+func (s *LeaderboardService) GetPlayerHistory(ctx context.Context, playerID string, limit int64) (_ []ScorePoint, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerHistory", playerID)(&err)
+	if s.historyLimit <= 0 || s.reader == nil {
+		return nil, ErrHistoryDisabled
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, limit)
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	values, err := s.reader.LRange(ctx, s.historyKey(s.key(), member), 0, min(limit, s.historyLimit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	points := make([]ScorePoint, 0, len(values))
+	for _, v := range values {
+		scorePart, tsPart, ok := strings.Cut(v, ":")
+		score, scoreErr := strconv.ParseInt(scorePart, 10, 64)
+		timestamp, tsErr := strconv.ParseInt(tsPart, 10, 64)
+		if !ok || scoreErr != nil || tsErr != nil {
+			return nil, fmt.Errorf("player %s: malformed history entry %q", playerID, v)
+		}
+		points = append(points, ScorePoint{Score: score, Timestamp: timestamp})
+	}
+	return points, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidPlayerID 表示玩家 ID 无法被 WithIDCodec 设置的编码器编码
+var ErrInvalidPlayerID = errors.New("invalid player id")
+
+// IDCodec 在玩家 ID 与有序集合成员之间转换, 用于压缩成员以节省内存
+// Encode 在写入和按玩家查询前调用, Decode 在从排行榜读出成员时调用, 二者必须互逆
+type IDCodec interface {
+	Encode(playerID string) (string, error)
+	Decode(member string) (string, error)
+}
+
+// WithIDCodec 设置玩家 ID 编码器, 默认不编码, 玩家 ID 原样作为成员
+// 同分时 Redis 按编码后的成员字典序排列, 使用 TiebreakPlayerID 时顺序可能与原始 ID 不同;
+// 玩家元数据 key 仍使用原始 ID. 已有数据的排行榜不能中途更换编码器
+func WithIDCodec(codec IDCodec) Option {
+	return func(s *LeaderboardService) {
+		s.idCodec = codec
+	}
+}
+
+// UUIDCodec 将 36 字符的标准 UUID 字符串编码为 16 字节, 解码时输出小写的标准格式
+type UUIDCodec struct{}
+
+// Encode 解析 xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx 格式的 UUID, 格式不符时返回 ErrInvalidPlayerID
+func (UUIDCodec) Encode(playerID string) (string, error) {
+	if len(playerID) != 36 || playerID[8] != '-' || playerID[13] != '-' || playerID[18] != '-' || playerID[23] != '-' {
+		return "", fmt.Errorf("%w: %q is not a uuid", ErrInvalidPlayerID, playerID)
+	}
+	raw, err := hex.DecodeString(playerID[0:8] + playerID[9:13] + playerID[14:18] + playerID[19:23] + playerID[24:36])
+	if err != nil {
+		return "", fmt.Errorf("%w: %q is not a uuid", ErrInvalidPlayerID, playerID)
+	}
+	return string(raw), nil
+}
+
+// Decode 将 16 字节成员还原为 UUID 字符串, 长度不符时返回 ErrInvalidMember
+func (UUIDCodec) Decode(member string) (string, error) {
+	if len(member) != 16 {
+		return "", fmt.Errorf("%w: %d bytes is not an encoded uuid", ErrInvalidMember, len(member))
+	}
+	h := hex.EncodeToString([]byte(member))
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32], nil
+}
+
+// member 返回玩家 ID 对应的有序集合成员
+func (s *LeaderboardService) member(playerID string) (string, error) {
+	if s.idCodec == nil {
+		return playerID, nil
+	}
+	return s.idCodec.Encode(playerID)
+}
+
+// playerID 取出成员并还原为玩家 ID
+func (s *LeaderboardService) playerID(z redis.Z) (string, error) {
+	member, err := memberID(z)
+	if err != nil {
+		return "", err
+	}
+	return s.decodeMember(member)
+}
+
+// decodeMember 将有序集合成员还原为玩家 ID
+func (s *LeaderboardService) decodeMember(member string) (string, error) {
+	if s.idCodec == nil {
+		return member, nil
+	}
+	return s.idCodec.Decode(member)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultEventTTL 是未调用 WithEventDedupeTTL 时事件 ID 的保留时间
+const defaultEventTTL = 10 * time.Minute
+
+// incrDuplicate 表示事件 ID 在保留时间内已经处理过, 本次更新被跳过, 只由 updateScoreOnceScript 返回
+const incrDuplicate = 8
+
+// updateScoreOnceScript 与 updateScoreScript 相同, 但先检查事件 ID, 检查、写入分数和记录事件 ID 在同一个脚本中完成
+// KEYS[1]: 排行榜 key, KEYS[2]: 事件 ID 的 key, KEYS[3] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: 与 updateScoreScript 相同, 之后为事件 ID 的保留时间 (毫秒)
+// 事件 ID 已存在时返回 8 且不做任何修改; 分数超出区间且不截断时返回 nil 并且不记录事件 ID, 其余返回值与 updateScoreScript 相同
+var updateScoreOnceScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 8
+end
+local multiplier = tonumber(ARGV[4])
+local tiebreak = tonumber(ARGV[3])
+local oldScore = 0
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old then
+	old = tonumber(old)
+	oldScore = math.floor(old / multiplier)
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+		part = part + multiplier
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+		part = part - multiplier
+	end
+	local staleCheck = tonumber(ARGV[7])
+	if staleCheck ~= 0 and (part - tiebreak) * staleCheck <= 0 then
+		redis.call('SET', KEYS[2], 1, 'PX', ARGV[10])
+		return 0
+	end
+end
+local newScore = oldScore + tonumber(ARGV[2])
+local minScore = tonumber(ARGV[5])
+local maxScore = tonumber(ARGV[6])
+local clamped = 0
+if newScore < minScore or newScore > maxScore then
+	if ARGV[8] ~= '1' then
+		return false
+	end
+	newScore = math.min(math.max(newScore, minScore), maxScore)
+	clamped = 4
+end
+redis.call('ZADD', KEYS[1], newScore * multiplier + tiebreak, ARGV[1])
+if KEYS[3] then
+	local width = tonumber(ARGV[9])
+	if old then
+		redis.call('HINCRBY', KEYS[3], math.floor(oldScore / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[3], math.floor(newScore / width), 1)
+end
+redis.call('SET', KEYS[2], 1, 'PX', ARGV[10])
+if not old then
+	return 2 + clamped
+end
+return 1 + clamped
+`)
+
+// WithEventDedupeTTL 设置 UpdateScoreOnce 记住已处理事件 ID 的时间, 默认为 10 分钟, ttl <= 0 时保持默认值
+// 应大于上游重新投递同一事件的最长间隔, 超过这段时间后重复到达的事件会再次生效
+func WithEventDedupeTTL(ttl time.Duration) Option {
+	return func(s *LeaderboardService) {
+		if ttl > 0 {
+			s.eventTTL = ttl
+		}
+	}
+}
+
+// eventKey 返回事件 ID 的去重 key; 以 baseKey 而不是当前窗口的 key 为前缀, 窗口切换前后重复投递的事件同样会被识别
+func (s *LeaderboardService) eventKey(eventID string) string {
+	return s.baseKey + ":event:" + eventID
+}
+
+// UpdateScoreOnce 与 UpdateScore 相同, 但用 eventID 对至少一次投递的事件去重, 返回本次更新是否被应用
+// 同一个 eventID 在 WithEventDedupeTTL 的时间内再次到达时不做任何修改并返回 false; 检查、写入和记录 eventID 在同一个
+// Lua 脚本中完成, 不会出现记录了 eventID 而分数未写入 (或相反) 的情况; 因 ErrScoreOutOfRange 失败的事件不会被记录,
+// 因时间戳过旧被 WithRejectStaleTimestamps 跳过的事件会被记录; eventID 为空时等同于 TryUpdateScore
+// 不经过 WithUpdateCoalescing 的合并队列; 需要 Redis, 对 RankStore 创建的服务返回 ErrRedisRequired
+func (s *LeaderboardService) UpdateScoreOnce(ctx context.Context, playerID string, incrScore int64, timestamp int64, eventID string) (applied bool, err error) {
+	defer s.observePlayer(&ctx, "UpdateScoreOnce", playerID)(&err)
+	if eventID != "" {
+		if err := s.requireRedis("UpdateScoreOnce"); err != nil {
+			return false, err
+		}
+	}
+	result, err := s.incrScoreOnce(ctx, playerID, incrScore, timestamp, eventID)
+	return result != incrSkipped && result != incrDuplicate, err
+}
+
+// runUpdateOnce 执行 updateScoreOnceScript, member 为编码后的成员
+func (s *LeaderboardService) runUpdateOnce(ctx context.Context, c redis.Scripter, key, member string, incrScore int64, timestamp int64, eventID string) *redis.Cmd {
+	keys := append([]string{key, s.eventKey(eventID)}, s.scriptKeys(key)[1:]...)
+	args := append(s.updateScoreArgs(member, incrScore, timestamp), s.eventTTL.Milliseconds())
+	return updateScoreOnceScript.Run(ctx, c, keys, args...)
+}
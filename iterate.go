@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// sinceBatchSize 是 GetTopNSince 每次从排行榜读取的成员数
+const sinceBatchSize = 1000
+
+// IterateAll 按排名顺序分批读取整个排行榜, 逐条通过 channel 返回, 不会一次性载入全部成员
+// 每批读取 batchSize 个成员; 组合分数完全相同的成员共享同一排名 (1, 2, 2, 4 式的标准竞争排名)
+// 遍历结束、出错或 ctx 取消时两个 channel 都会被关闭, 错误 channel 至多返回一个错误
+// 遍历期间若有写入, 按位置分批读取可能出现重复或遗漏, 需要一致视图时先用 SnapshotRanks 固定数据
+func (s *LeaderboardService) IterateAll(ctx context.Context, batchSize int64) (<-chan RankInfo, <-chan error) {
+	return s.iterate(ctx, batchSize, true)
+}
+
+// iterate 是 IterateAll 的实现, display 为 false 时返回原始分数而不按 WithScoreNormalization 换算, 供导出等内部遍历使用
+func (s *LeaderboardService) iterate(ctx context.Context, batchSize int64, display bool) (<-chan RankInfo, <-chan error) {
+	out := make(chan RankInfo)
+	errc := make(chan error, 1)
+
+	if batchSize <= 0 {
+		errc <- fmt.Errorf("%w: batch size %d", ErrInvalidLimit, batchSize)
+		close(out)
+		close(errc)
+		return out, errc
+	}
+
+	go func() {
+		defer close(errc)
+		defer close(out)
+		if err := s.iterateAll(ctx, s.key(), batchSize, display, out); err != nil {
+			errc <- err
+		}
+	}()
+	return out, errc
+}
+
+// iterateAll 是 IterateAll 的实际遍历逻辑
+func (s *LeaderboardService) iterateAll(ctx context.Context, key string, batchSize int64, display bool, out chan<- RankInfo) error {
+	var (
+		lastScore float64
+		lastRank  int64
+	)
+	for start := int64(0); ; start += batchSize {
+		results, err := s.rangeWithScores(ctx, s.readStore, key, start, start+batchSize-1).Result()
+		if err != nil {
+			return err
+		}
+		infos, err := s.toRankInfos(results, start+1)
+		if err != nil {
+			return err
+		}
+		if display {
+			s.displayRankings(infos, nil)
+		}
+		for i, info := range infos {
+			if info.Rank == 1 || results[i].Score != lastScore {
+				lastRank = info.Rank
+				lastScore = results[i].Score
+			}
+			info.Rank = lastRank
+
+			select {
+			case out <- info:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if int64(len(results)) < batchSize {
+			return nil
+		}
+	}
+}
+
+// GetTopNSince 返回时间戳不早于 since 的玩家中排名最靠前的 n 名, 例如用于"近期活跃"榜, n <= 0 时返回 ErrInvalidLimit
+// 结果是精确的: 按排名顺序分批读取并解码时间戳, 直到找到 n 名或读完整个排行榜, Rank 为在整个排行榜中的排名;
+// 时间戳只在组合分数的低位中, 无法用区间查询过滤, 排在前面的玩家大多早于 since 时需要扫描的成员数接近排行榜人数
+// TiebreakPlayerID 模式不存储时间戳, 此时返回错误
+func (s *LeaderboardService) GetTopNSince(ctx context.Context, n int64, since int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetTopNSince")(&err)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	if s.tiebreakMode == TiebreakPlayerID {
+		return nil, errors.New("timestamps are not stored with TiebreakPlayerID")
+	}
+	key := s.key()
+	rankings := make([]RankInfo, 0, min(n, sinceBatchSize))
+	for start := int64(0); ; start += sinceBatchSize {
+		results, err := s.rangeWithScores(ctx, s.readStore, key, start, start+sinceBatchSize-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		infos, err := s.displayRankings(s.toRankInfos(results, start+1))
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.Timestamp < since {
+				continue
+			}
+			rankings = append(rankings, info)
+			if int64(len(rankings)) == n {
+				return rankings, nil
+			}
+		}
+		if int64(len(results)) < sinceBatchSize {
+			return rankings, nil
+		}
+	}
+}
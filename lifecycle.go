@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrShuttingDown 表示服务已调用 Shutdown, 不再接受新的写入
+var ErrShuttingDown = errors.New("leaderboard service is shutting down")
+
+// ErrServiceClosed 表示服务已调用 Close, 开启 WithUpdateCoalescing 时 UpdateScore 不再接受新的更新
+var ErrServiceClosed = errors.New("leaderboard service is closed")
+
+// writeGate 记录进行中的写入, 使 Shutdown 能拒绝新的写入并等待已开始的写入完成
+type writeGate struct {
+	mu     sync.Mutex
+	closed bool
+	writes sync.WaitGroup
+}
+
+// beginWrite 登记一次写入, Shutdown 之后返回 ErrShuttingDown, 排行榜被冻结时返回 ErrLeaderboardFrozen; 写入结束时必须调用返回的函数
+func (s *LeaderboardService) beginWrite(ctx context.Context) (func(), error) {
+	if err := s.checkFrozen(ctx); err != nil {
+		return nil, err
+	}
+	g := &s.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil, ErrShuttingDown
+	}
+	g.writes.Add(1)
+	return g.writes.Done, nil
+}
+
+// NewLeaderboardServiceFromOptions 按 redisOpts 创建一个专属的 Redis 客户端并基于它创建排行榜服务
+// 该客户端归服务所有, 不再使用时应调用 Close 释放连接
+func NewLeaderboardServiceFromOptions(redisOpts *redis.Options, opts ...Option) *LeaderboardService {
+	s := NewLeaderboardService(redis.NewClient(redisOpts), opts...)
+	s.ownsClient = true
+	return s
+}
+
+// Close 释放服务持有的资源
+// 开启 WithUpdateCoalescing 时先停止接受新的更新 (之后的 UpdateScore 返回 ErrServiceClosed), 再停止后台写入并 Flush 剩余的更新,
+// 写入失败的错误与关闭客户端的错误一并返回
+// 只有 NewLeaderboardServiceFromOptions 创建的客户端会被关闭, 且只关闭一次, 重复调用不会返回客户端已关闭的错误;
+// 通过 NewLeaderboardService 注入的客户端可能被其他服务共享, 仍由调用方负责关闭
+func (s *LeaderboardService) Close() error {
+	if s.coalescer != nil {
+		s.coalescer.close()
+	}
+	s.stopCoalescing()
+	flushErr := s.flushCoalesced(context.Background())
+	return errors.Join(flushErr, s.closeClient())
+}
+
+// closeClient 关闭服务所有的客户端, 只有第一次调用会真正关闭, 之后的调用返回 nil
+func (s *LeaderboardService) closeClient() (err error) {
+	if !s.ownsClient || s.rdb == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() { err = s.rdb.Close() })
+	return err
+}
+
+// Shutdown 优雅地关闭服务, 例如在 http.Server.Shutdown 之后调用
+// 之后修改排行榜的写入 (UpdateScore 及其变体、UpdateScoreWithOpts、UpdateScoresBatch、UpdateScoreFloat、SetScore、ResetPlayerScore、RecordBest、
+// UpdateMetrics、RecomputeAll、SetTiebreakValues、BulkLoad、MergePlayers、DeletePlayer、DeletePlayers、ResetLeaderboard、ResetAndArchive、
+// ApplyDecay (dryRun 除外)、Migrate、ImportJSON、ImportCompressed) 返回 ErrShuttingDown; 然后等待进行中的写入完成, 停止 WithUpdateCoalescing 的后台写入并 Flush 剩余的更新,
+// 最后像 Close 一样关闭服务所有的客户端; ctx 到期时不再等待, 返回 ctx 的错误, 未写入的合并更新会丢失
+// 可以重复调用, 之后的调用只会再次 Flush
+func (s *LeaderboardService) Shutdown(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "Shutdown")(&err)
+	s.gate.mu.Lock()
+	s.gate.closed = true
+	s.gate.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		s.gate.writes.Wait()
+		s.stopCoalescing()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return fmt.Errorf("wait for pending writes: %w", ctx.Err())
+	}
+	if err := s.flushCoalesced(ctx); err != nil {
+		return err
+	}
+	return s.closeClient()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// defaultSlowOpThreshold 是未调用 WithSlowOpThreshold 时判定慢操作的耗时
+const defaultSlowOpThreshold = 100 * time.Millisecond
+
+// Logger 是服务输出结构化日志的接口, keysAndValues 为交替排列的键和值, 例如 "op", "GetTopN", "duration", d
+// 可以很容易地适配到 zap 的 SugaredLogger 或 log/slog; 实现需要可被并发调用
+type Logger interface {
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+// noopLogger 是默认的 Logger, 丢弃所有日志
+type noopLogger struct{}
+
+func (noopLogger) Debug(string, ...interface{}) {}
+func (noopLogger) Info(string, ...interface{})  {}
+func (noopLogger) Warn(string, ...interface{})  {}
+func (noopLogger) Error(string, ...interface{}) {}
+
+// WithLogger 设置服务使用的 Logger, 默认不输出任何日志
+// 每个公开方法结束时: Redis 等基础设施错误以 Error 级别输出, ctx 取消或超时以 Warn 级别输出,
+// 调用方参数导致的错误 (例如 ErrPlayerNotFound、ErrInvalidLimit) 以 Debug 级别输出, 耗时超过慢操作阈值时以 Warn 级别输出
+func WithLogger(logger Logger) Option {
+	return func(s *LeaderboardService) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+// WithSlowOpThreshold 设置慢操作日志的阈值, 默认为 100ms, d <= 0 时不输出慢操作日志
+func WithSlowOpThreshold(d time.Duration) Option {
+	return func(s *LeaderboardService) {
+		s.slowOpThreshold = d
+	}
+}
+
+// callerErrors 是由调用方输入或数据状态导致、不代表 Redis 故障的错误
+var callerErrors = []error{
+	ErrPlayerNotFound, ErrInvalidLimit, ErrScoreOutOfRange, ErrTimestampOutOfRange, ErrInvalidPlayerID,
+	ErrRankOutOfRange, ErrNotInSnapshot, ErrApproxRankDisabled, ErrLeaderboardKeyMissing, ErrInvalidConfig, ErrInvalidUpdateOpts,
+	ErrHistoryDisabled, ErrShuttingDown, ErrServiceClosed, ErrLeaderboardFrozen, ErrRedisRequired,
+}
+
+// logOp 按 WithLogger 描述的规则输出一次操作的日志
+func (s *LeaderboardService) logOp(op string, dur time.Duration, err error) {
+	if s.slowOpThreshold > 0 && dur >= s.slowOpThreshold {
+		s.logger.Warn("slow leaderboard operation", "op", op, "duration", dur, "threshold", s.slowOpThreshold)
+	}
+	if err == nil {
+		return
+	}
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		s.logger.Warn("leaderboard operation canceled", "op", op, "duration", dur, "error", err)
+	case isCallerError(err):
+		s.logger.Debug("leaderboard operation rejected", "op", op, "error", err)
+	default:
+		s.logger.Error("leaderboard operation failed", "op", op, "duration", dur, "error", err)
+	}
+}
+
+// isCallerError 报告 err 是否属于 callerErrors
+func isCallerError(err error) bool {
+	for _, target := range callerErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
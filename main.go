@@ -1,235 +1,1496 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
+
+	"ranking/memstore"
 )
 
 const (
 	leaderboardKey = "game:leaderboard:main_test" // 使用一个独立的key，避免污染数据
-	// 用于组合 score 和 timestamp，假设时间戳是秒级的
+	// 用于组合 score 和 timestamp，默认时间戳是秒级的, 毫秒级时间戳见 WithTimestampUnit
 	// 分数乘以一个大数是为了让分数在组合后的 score 中占据主导地位
 	scoreMultiplier      = 1e12
 	maxTimestampReversed = 1e12
+	// float64 只能精确表示 2^53 以内的整数, 组合分数超出该范围后时间戳的比较会失真
+	// 因此原始分数必须落在 [-maxSafeScore, maxSafeScore] 内
+	maxSafeScore = 1<<53/int64(scoreMultiplier) - 1
 )
 
+// ErrScoreOutOfRange 表示原始分数超出了组合分数可精确表示的范围
+var ErrScoreOutOfRange = errors.New("score out of safe range")
+
+// ErrTimestampOutOfRange 表示时间戳无法放入组合分数的时间戳部分, 写入后会破坏原始分数
+var ErrTimestampOutOfRange = errors.New("timestamp out of range")
+
+// ErrPlayerNotFound 表示玩家不在排行榜上
+var ErrPlayerNotFound = errors.New("player not found")
+
+// ErrInvalidMember 表示 Redis 返回的成员不是字符串, 通常是数据被错误写入导致
+var ErrInvalidMember = errors.New("leaderboard member is not a string")
+
+// ErrInvalidLimit 表示请求的玩家数量 (N) 不是正数
+var ErrInvalidLimit = errors.New("limit must be positive")
+
+// ErrNonFiniteScore 表示 Redis 中成员的组合分数为 inf 或 nan, 通常是数据被手动错误写入导致
+var ErrNonFiniteScore = errors.New("combined score is not finite")
+
+// updateScoreScript 原子地完成 UpdateScore 的读-改-写
+// KEYS[1]: 排行榜 key, KEYS[2] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: playerID, incrScore, tiebreak, scoreMultiplier, minScore, maxScore, staleCheck, clamp, bucketWidth (仅在有 KEYS[2] 时使用)
+// tiebreak 由调用方根据排序方向和 TiebreakMode 计算, 见 LeaderboardService.tiebreak
+// staleCheck 见 LeaderboardService.staleCheck, 非 0 时拒绝时间戳不比已存储时间戳新的更新
+// 旧分数按向下取整解码, 与 decodeScore 保持一致
+// 新分数超出 [minScore, maxScore] 时, clamp 为 1 则截断到区间内, 否则不写入并返回 nil
+// 更新已有玩家返回 1, 新建玩家返回 2, 因时间戳过旧而跳过返回 0; 发生截断时返回值再加 4
+var updateScoreScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[4])
+local tiebreak = tonumber(ARGV[3])
+local oldScore = 0
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old then
+	old = tonumber(old)
+	oldScore = math.floor(old / multiplier)
+	-- 除法的舍入误差可能让结果偏差 1, 用精确的减法校正
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+		part = part + multiplier
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+		part = part - multiplier
+	end
+	local staleCheck = tonumber(ARGV[7])
+	if staleCheck ~= 0 and (part - tiebreak) * staleCheck <= 0 then
+		return 0
+	end
+end
+local newScore = oldScore + tonumber(ARGV[2])
+local minScore = tonumber(ARGV[5])
+local maxScore = tonumber(ARGV[6])
+local clamped = 0
+if newScore < minScore or newScore > maxScore then
+	if ARGV[8] ~= '1' then
+		return false
+	end
+	newScore = math.min(math.max(newScore, minScore), maxScore)
+	clamped = 4
+end
+redis.call('ZADD', KEYS[1], newScore * multiplier + tiebreak, ARGV[1])
+if KEYS[2] then
+	local width = tonumber(ARGV[9])
+	if old then
+		redis.call('HINCRBY', KEYS[2], math.floor(oldScore / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[2], math.floor(newScore / width), 1)
+end
+if not old then
+	return 2 + clamped
+end
+return 1 + clamped
+`)
+
 // RankInfo 存储玩家的排名信息
+// Found 表示玩家是否在排行榜上: 批量查询中不在榜上的玩家同样返回一项, 其 Found 为 false, 其余字段除 PlayerID 外均为 0
+//
+// JSON 格式是稳定的对外约定, 字段名不会改变, 之后只会增加可省略的字段:
+//   - playerId、score、rank、found 总是出现; rank 从 1 开始, found 为 false 时 score 和 rank 为 0 且没有意义
+//   - timestamp 只在已知时出现: TiebreakPlayerID 模式不存储时间戳, 不在榜上的玩家也没有时间戳, 此时省略该字段
+//
+// 密集排名和百分位只由 GetPlayerStats 计算, 见 PlayerStats; 编码后再解码得到的值与原值相同
 type RankInfo struct {
-	PlayerID string `json:"playerId"`
-	Score    int64  `json:"score"`
-	Rank     int64  `json:"rank"`
+	PlayerID  string `json:"playerId"`
+	Score     int64  `json:"score"` // 原始分数, 开启 WithScoreNormalization 时为 0~100 的展示分
+	Rank      int64  `json:"rank"`
+	Timestamp int64  `json:"timestamp,omitempty"` // 最后一次更新分数的时间戳, 0 表示未知
+	Found     bool   `json:"found"`
+}
+
+// RankWithTotal 同时包含玩家排名信息和排行榜总人数
+type RankWithTotal struct {
+	RankInfo
+	Total int64 `json:"total"`
+}
+
+// RankWindow 是以某个玩家为中心的一段连续名次, EndRank 为最后一个条目的名次
+// HasAbove 和 HasBelow 表示窗口之前或之后是否还有玩家, 由排行榜总人数推算
+type RankWindow struct {
+	Entries   []RankInfo `json:"entries"`
+	StartRank int64      `json:"startRank"`
+	EndRank   int64      `json:"endRank"`
+	HasAbove  bool       `json:"hasAbove"`
+	HasBelow  bool       `json:"hasBelow"`
+}
+
+// ScoreUpdate 描述一次玩家积分更新, 用于批量更新
+type ScoreUpdate struct {
+	PlayerID  string
+	IncrScore int64
+	Timestamp int64
+}
+
+// ScoreUpdateError 记录批量更新中某个玩家更新失败的原因
+type ScoreUpdateError struct {
+	PlayerID string
+	Err      error
 }
 
+func (e *ScoreUpdateError) Error() string {
+	return fmt.Sprintf("update score for player %s: %v", e.PlayerID, e.Err)
+}
+
+func (e *ScoreUpdateError) Unwrap() error {
+	return e.Err
+}
+
+// SortOrder 表示排行榜的排序方向
+type SortOrder int
+
+const (
+	// Descending 分数越高排名越靠前 (默认)
+	Descending SortOrder = iota
+	// Ascending 分数越低排名越靠前, 例如按最快用时排名
+	Ascending
+)
+
+// TiebreakMode 决定原始分数相同时玩家的先后顺序
+// 组合分数中的时间戳部分按模式计算, 切换模式不会改写已存储的数据:
+// 已有成员保留写入时的编码, 在新模式下解码出的时间戳和同分顺序都会出错, 因此切换模式时应清空或重新导入排行榜
+type TiebreakMode int
+
+const (
+	// TiebreakEarliest 同分时时间戳越早排名越靠前 (默认)
+	TiebreakEarliest TiebreakMode = iota
+	// TiebreakLatest 同分时时间戳越晚排名越靠前
+	TiebreakLatest
+	// TiebreakPlayerID 同分时按玩家 ID 字典序排列, 组合分数不包含时间戳,
+	// 读取到的 Timestamp 恒为 0, WithRejectStaleTimestamps 也不再生效
+	// 顺序由 Redis 对同分成员的字典序决定: 升序排行榜中 ID 越小越靠前, 降序排行榜中相反
+	TiebreakPlayerID
+)
+
 // LeaderboardService 是排行榜系统的核心服务
 type LeaderboardService struct {
-	rdb *redis.Client
-	ctx context.Context
+	rdb   *redis.Client
+	store RankStore
+	// reader 和 readStore 用于只读查询, 未通过 WithReadClient 设置时与 rdb 和 store 相同
+	reader        *redis.Client
+	readStore     RankStore
+	order         SortOrder
+	baseKey       string
+	window        WindowType
+	weekStart     time.Weekday
+	tiebreakMode  TiebreakMode
+	timestampUnit TimestampUnit
+	metrics       MetricsObserver
+	// logger 默认为 noopLogger, slowOpThreshold 为慢操作日志的阈值, 见 WithLogger
+	logger          Logger
+	slowOpThreshold time.Duration
+	// windowGrace 大于 0 时周期 key 在周期结束 windowGrace 之后过期, 见 WithWindowExpiry
+	windowGrace time.Duration
+	// slidingTTL 大于 0 时每次写入都把排行榜 key 的过期时间重新设置为 slidingTTL, 见 WithSlidingTTL
+	slidingTTL time.Duration
+	// scoreScale 不为 nil 时返回的 Score 换算为 0~100 的展示分, 见 WithScoreNormalization
+	scoreScale *scoreScale
+	// rankWatchers 为 WithRankCrossing 注册的回调
+	rankWatchers []rankWatcher
+	// metaPrefix 为玩家元数据哈希 key 的前缀, 为空时使用 <baseKey>:meta:, 见 WithMetadataPrefix
+	metaPrefix string
+	// idCodec 不为 nil 时玩家 ID 编码后才作为有序集合成员, 见 WithIDCodec
+	idCodec IDCodec
+	// bucketWidth 大于 0 时同时维护分数桶计数, 见 WithApproxRank
+	bucketWidth int64
+	// minScore 和 maxScore 是允许的原始分数区间, clampScores 为 true 时超出的分数被截断而不是拒绝
+	minScore    int64
+	maxScore    int64
+	clampScores bool
+	// rejectStale 为 true 时, 时间戳不比已存储时间戳新的更新会被忽略
+	rejectStale bool
+	// metricWeights 为 UpdateMetrics 使用的指标权重, 可在运行中替换, 见 WithMetricWeights
+	metricWeights atomic.Pointer[map[string]int64]
+	// serverTimestamps 为 true 时 0 时间戳由 Redis 的 TIME 代替, 见 WithServerTimestamps
+	serverTimestamps bool
+	// tracer 不为 nil 时每个公开方法开始一个 span, 见 WithTracer
+	tracer Tracer
+	// topCache 不为 nil 时缓存 GetTopN 的结果, 见 WithTopNCache
+	topCache *topNCache
+	// rankCache 不为 nil 时缓存 GetPlayerRank 的结果, 见 WithPlayerRankCache
+	rankCache *playerRankCache
+	// coalescer 不为 nil 时 UpdateScore 先在进程内合并, 见 WithUpdateCoalescing
+	coalescer *updateCoalescer
+	// tiebreakKeys 为原始分数相同时依次比较的附加字段, 见 WithTiebreakKeys
+	tiebreakKeys []TiebreakKey
+	// historyLimit 大于 0 时每个玩家保留最近 historyLimit 条分数记录, 见 WithScoreHistory
+	historyLimit int64
+	// eventTTL 是 UpdateScoreOnce 记住已处理事件 ID 的时间, 见 WithEventDedupeTTL
+	eventTTL time.Duration
+	// frozen 为 true 时拒绝写入, sharedFreeze 为 true 时改用 Redis 中的标志, 见 Freeze
+	frozen       atomic.Bool
+	sharedFreeze bool
+	// gate 记录进行中的写入, 见 Shutdown
+	gate writeGate
+	// ownsClient 为 true 时 rdb 由服务创建, Close 会关闭它, 见 NewLeaderboardServiceFromOptions
+	ownsClient bool
+	// closeOnce 保证 Close 和 Shutdown 多次调用时只关闭一次客户端
+	closeOnce sync.Once
+}
+
+// Option 用于在创建 LeaderboardService 时修改默认配置
+type Option func(*LeaderboardService)
+
+// WithSortOrder 设置排行榜的排序方向
+func WithSortOrder(order SortOrder) Option {
+	return func(s *LeaderboardService) {
+		s.order = order
+	}
+}
+
+// WithTiebreakMode 设置同分时的排序规则, 默认为 TiebreakEarliest
+// 只影响整数分数排行榜, 小数分数排行榜始终按时间戳越早越靠前排列
+func WithTiebreakMode(mode TiebreakMode) Option {
+	return func(s *LeaderboardService) {
+		s.tiebreakMode = mode
+	}
+}
+
+// WithScoreBounds 将原始分数限制在 [minScore, maxScore] 内, 例如 WithScoreBounds(0, 100000) 禁止负分
+// UpdateScore (及其变体、UpdateScoresBatch) 和 SetScore 写入前会把超出区间的分数截断到边界而不是返回错误,
+// 可通过 UpdateScoreClamped 和 SetScoreClamped 得知是否发生了截断
+// 区间会再与 [-maxSafeScore, maxSafeScore] 取交集, 以保证组合分数精确
+func WithScoreBounds(minScore, maxScore int64) Option {
+	return func(s *LeaderboardService) {
+		s.minScore = max(minScore, -maxSafeScore)
+		s.maxScore = min(maxScore, maxSafeScore)
+		s.clampScores = true
+	}
+}
+
+// WithKey 设置排行榜使用的 Redis key, 默认为 leaderboardKey
+// 配置了时间窗口时, 该 key 作为各周期 key 的前缀
+func WithKey(key string) Option {
+	return func(s *LeaderboardService) {
+		s.baseKey = key
+	}
+}
+
+// WithRejectStaleTimestamps 让 UpdateScore 忽略时间戳不比该玩家已存储时间戳新的更新,
+// 用于乱序到达的事件; 可通过 TryUpdateScore 得知更新是否被应用
+func WithRejectStaleTimestamps() Option {
+	return func(s *LeaderboardService) {
+		s.rejectStale = true
+	}
 }
 
 // NewLeaderboardService 创建一个新的排行榜服务实例
-func NewLeaderboardService(rdb *redis.Client) *LeaderboardService {
-	return &LeaderboardService{
-		rdb: rdb,
-		ctx: context.Background(),
+// rdb 由调用方所有, 可以在多个服务间共享, 服务的 Close 不会关闭它
+func NewLeaderboardService(rdb *redis.Client, opts ...Option) *LeaderboardService {
+	s := newLeaderboardService(redisStore{Client: rdb}, opts...)
+	s.rdb = rdb
+	if s.reader != nil {
+		s.readStore = redisStore{Client: s.reader}
+	} else {
+		s.reader = rdb
 	}
+	s.startCoalescing()
+	return s
 }
 
-// UpdateScore 更新玩家积分
-func (s *LeaderboardService) UpdateScore(playerID string, incrScore int64, timestamp int64) error {
-	oldCombinedScore, err := s.rdb.ZScore(s.ctx, leaderboardKey, playerID).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return err
+// NewLeaderboardServiceWithStore 使用自定义的 RankStore (例如 memstore 中的内存实现) 创建排行榜服务
+// 只有核心方法 (UpdateScore、SetScore、GetPlayerRank、GetPlayerCount、GetTopN、GetTopNPaged、GetBottomN、
+// GetPlayerRankRange、DeletePlayer、GetScoreAtRank、GetRankForScore、CountInScoreRange) 通过 RankStore 访问数据;
+// 其余依赖 pipeline、Lua 脚本等 Redis 特性的方法需要使用 NewLeaderboardService 创建的服务, 否则返回 ErrRedisRequired;
+// 分数桶需要 Lua 脚本维护, WithApproxRank 对这样创建的服务无效, GetPlayerRankApprox 返回 ErrApproxRankDisabled
+func NewLeaderboardServiceWithStore(store RankStore, opts ...Option) *LeaderboardService {
+	s := newLeaderboardService(store, opts...)
+	s.bucketWidth = 0
+	return s
+}
+
+// newLeaderboardService 创建基于 store 的服务并应用配置项
+func newLeaderboardService(store RankStore, opts ...Option) *LeaderboardService {
+	s := &LeaderboardService{
+		store:           store,
+		baseKey:         leaderboardKey,
+		window:          WindowAllTime,
+		weekStart:       time.Monday,
+		minScore:        -maxSafeScore,
+		maxScore:        maxSafeScore,
+		logger:          noopLogger{},
+		slowOpThreshold: defaultSlowOpThreshold,
+		eventTTL:        defaultEventTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
-	oldScore := int64(oldCombinedScore / scoreMultiplier)
+	s.readStore = store
+	return s
+}
 
-	newScore := oldScore + incrScore
-	newCombinedScore := float64(newScore*scoreMultiplier + (maxTimestampReversed - timestamp))
+// reversedTiebreak 报告时间戳部分是否存储为 maxTimestampReversed - timestamp
+// 降序且越早越靠前时越早的时间戳需要越大的值; 升序或越晚越靠前时方向相反, 两者同时成立则又翻转回来
+func (s *LeaderboardService) reversedTiebreak() bool {
+	return (s.order == Ascending) == (s.tiebreakMode == TiebreakLatest)
+}
 
-	_, err = s.rdb.ZAdd(s.ctx, leaderboardKey, redis.Z{
-		Score:  newCombinedScore,
-		Member: playerID,
-	}).Result()
+// tiebreak 按 TiebreakMode 计算组合分数中的时间戳部分
+func (s *LeaderboardService) tiebreak(timestamp int64) int64 {
+	timestamp -= s.timestampOffset()
+	switch {
+	case s.tiebreakMode == TiebreakPlayerID:
+		return 0
+	case s.reversedTiebreak():
+		return maxTimestampReversed - timestamp
+	default:
+		return timestamp
+	}
+}
 
-	return err
+// combineScore 将原始分数与时间戳组合为写入 Redis 的 score, 与 updateScoreScript 中的计算一致
+func (s *LeaderboardService) combineScore(score int64, timestamp int64) float64 {
+	return float64(score*scoreMultiplier + s.tiebreak(timestamp))
 }
 
-// GetPlayerRank 查询玩家当前排名
-func (s *LeaderboardService) GetPlayerRank(playerID string) (*RankInfo, error) {
-	rank, err := s.rdb.ZRevRank(s.ctx, leaderboardKey, playerID).Result()
-	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return nil, fmt.Errorf("player %s not found in leaderboard", playerID)
-		}
-		return nil, err
+// staleCheck 返回 updateScoreScript 判断过旧时间戳所用的方向:
+// 越新的时间戳 tiebreak 越小时为 1, 越大时为 -1, 未开启检查或不存储时间戳时为 0
+func (s *LeaderboardService) staleCheck() int {
+	switch {
+	case !s.rejectStale || s.tiebreakMode == TiebreakPlayerID:
+		return 0
+	case s.reversedTiebreak():
+		return 1
+	default:
+		return -1
 	}
+}
 
-	combinedScore, err := s.rdb.ZScore(s.ctx, leaderboardKey, playerID).Result()
-	if err != nil {
-		return nil, err
+// checkTimestamp 检查时间戳部分是否落在 [0, scoreMultiplier) 内, 否则会进位到原始分数上
+// 存储为 maxTimestampReversed - timestamp 时即要求 0 < timestamp <= maxTimestampReversed, 否则要求 0 <= timestamp < scoreMultiplier
+// 毫秒级时间戳先减去 millisecondEpoch 再做上述检查
+func (s *LeaderboardService) checkTimestamp(timestamp int64) error {
+	if part := s.tiebreak(timestamp); part < 0 || part >= scoreMultiplier {
+		return fmt.Errorf("%w: %d", ErrTimestampOutOfRange, timestamp)
+	}
+	return nil
+}
+
+// checkScore 检查 score 是否在 [-maxSafeScore, maxSafeScore] 内, 超出时组合分数无法被 float64 精确表示
+func checkScore(score int64) error {
+	if score > maxSafeScore || score < -maxSafeScore {
+		return fmt.Errorf("%w: %d", ErrScoreOutOfRange, score)
 	}
-	score := int64(combinedScore / scoreMultiplier)
+	return nil
+}
 
-	return &RankInfo{
-		PlayerID: playerID,
-		Score:    score,
-		Rank:     rank + 1, // 转换为 1-based 排名
-	}, nil
+// checkIncr 检查增量本身是否可能落在安全范围内
+// 绝对值超过 2*maxSafeScore 的增量无论旧分数是多少都必然越界, 无需发往 Redis
+func checkIncr(incrScore int64) error {
+	if incrScore > 2*maxSafeScore || incrScore < -2*maxSafeScore {
+		return fmt.Errorf("%w: increment %d", ErrScoreOutOfRange, incrScore)
+	}
+	return nil
 }
 
-// GetTopN 获取前 N 名玩家
-func (s *LeaderboardService) GetTopN(n int64) ([]RankInfo, error) {
-	results, err := s.rdb.ZRevRangeWithScores(s.ctx, leaderboardKey, 0, n-1).Result()
-	if err != nil {
-		return nil, err
+// decodeScore 将组合分数拆分为原始分数和时间戳, 是 combineScore 的逆运算
+// 组合分数在安全范围内是精确的整数, 因此用整数的向下取整除法拆分, 负分数同样适用
+func (s *LeaderboardService) decodeScore(combinedScore float64) (score int64, timestamp int64) {
+	combined := int64(combinedScore)
+	score = combined / scoreMultiplier
+	part := combined % scoreMultiplier
+	if part < 0 {
+		score--
+		part += scoreMultiplier
+	}
+	switch {
+	case s.tiebreakMode == TiebreakPlayerID:
+		return score, 0
+	case s.reversedTiebreak():
+		return score, maxTimestampReversed - part + s.timestampOffset()
+	default:
+		return score, part + s.timestampOffset()
+	}
+}
+
+// checkFinite 检查成员的组合分数是否为有限值, inf 或 nan 无法解码出有意义的原始分数
+func checkFinite(member string, combinedScore float64) error {
+	if math.IsInf(combinedScore, 0) || math.IsNaN(combinedScore) {
+		return fmt.Errorf("%w: member %s has score %v", ErrNonFiniteScore, member, combinedScore)
+	}
+	return nil
+}
+
+// formatScore 将组合分数格式化为 Redis 区间参数, 保留完整精度
+func formatScore(combinedScore float64) string {
+	return strconv.FormatFloat(combinedScore, 'f', -1, 64)
+}
+
+// memberID 取出成员的玩家 ID, 成员不是字符串时返回 ErrInvalidMember 而不是 panic
+func memberID(z redis.Z) (string, error) {
+	playerID, ok := z.Member.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %v (%T)", ErrInvalidMember, z.Member, z.Member)
 	}
+	return playerID, nil
+}
 
+// toRankInfos 将按排名顺序读取到的成员转换为 RankInfo, 第一个成员的排名为 firstRank
+func (s *LeaderboardService) toRankInfos(results []redis.Z, firstRank int64) ([]RankInfo, error) {
 	rankings := make([]RankInfo, len(results))
 	for i, member := range results {
+		playerID, err := s.playerID(member)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFinite(playerID, member.Score); err != nil {
+			return nil, err
+		}
+		score, timestamp := s.decodeScore(member.Score)
 		rankings[i] = RankInfo{
-			PlayerID: member.Member.(string),
-			Score:    int64(member.Score / scoreMultiplier),
-			Rank:     int64(i + 1),
+			PlayerID:  playerID,
+			Score:     score,
+			Rank:      firstRank + int64(i),
+			Timestamp: timestamp,
+			Found:     true,
 		}
 	}
 	return rankings, nil
 }
 
-// GetPlayerRankRange 查询自己名次前后共 N 名玩家
-func (s *LeaderboardService) GetPlayerRankRange(playerID string, nRange int64) ([]RankInfo, error) {
-	playerRankInfo, err := s.GetPlayerRank(playerID)
-	if err != nil {
-		return nil, err
+// key 返回当前时间对应的排行榜 key, 未配置时间窗口时即为 baseKey
+func (s *LeaderboardService) key() string {
+	return WindowKey(s.baseKey, s.window, time.Now(), s.weekStart)
+}
+
+// rank 按排序方向查询成员的 0-based 排名, member 为编码后的成员
+func (s *LeaderboardService) rank(ctx context.Context, c rankReader, key string, member string) *redis.IntCmd {
+	if s.order == Ascending {
+		return c.ZRank(ctx, key, member)
 	}
-	playerRank := playerRankInfo.Rank
+	return c.ZRevRank(ctx, key, member)
+}
 
-	startRank := playerRank - (nRange / 2)
-	if startRank < 1 {
-		startRank = 1
+// rangeWithScores 按排序方向读取 [start, stop] 区间内的成员 (0-based)
+func (s *LeaderboardService) rangeWithScores(ctx context.Context, c rankReader, key string, start, stop int64) *redis.ZSliceCmd {
+	if s.order == Ascending {
+		return c.ZRangeWithScores(ctx, key, start, stop)
 	}
-	endRank := startRank + nRange - 1
+	return c.ZRevRangeWithScores(ctx, key, start, stop)
+}
 
-	results, err := s.rdb.ZRevRangeWithScores(s.ctx, leaderboardKey, startRank-1, endRank-1).Result()
-	if err != nil {
-		return nil, err
+// updateScoreScript 返回值的含义, 截断标志与其余结果按位组合
+const (
+	incrSkipped = 0
+	incrUpdated = 1
+	incrCreated = 2
+	incrClamped = 4
+)
+
+// UpdateScore 更新玩家积分
+// 读取旧分数、计算新分数并写回在同一个 Lua 脚本中完成, 避免并发更新丢失
+// 更新后的分数超出 [-maxSafeScore, maxSafeScore] (或 WithScoreBounds 设置的区间) 时返回 ErrScoreOutOfRange,
+// 配置了截断时则改为截断到区间内; 开启 WithUpdateCoalescing 时只加入合并队列, 区间检查在写入时进行
+func (s *LeaderboardService) UpdateScore(ctx context.Context, playerID string, incrScore int64, timestamp int64) (err error) {
+	defer s.observePlayer(&ctx, "UpdateScore", playerID)(&err)
+	if s.coalescer != nil && s.rdb != nil {
+		return s.coalesceUpdate(ctx, playerID, incrScore, timestamp)
 	}
+	_, err = s.incrScore(ctx, playerID, incrScore, timestamp)
+	return err
+}
 
-	rankings := make([]RankInfo, len(results))
-	for i, member := range results {
-		rankings[i] = RankInfo{
-			PlayerID: member.Member.(string),
-			Score:    int64(member.Score / scoreMultiplier),
-			Rank:     startRank + int64(i),
+// TryUpdateScore 与 UpdateScore 相同, 但额外返回更新是否被应用
+// 只有配置了 WithRejectStaleTimestamps 且时间戳过旧时才会返回 false
+func (s *LeaderboardService) TryUpdateScore(ctx context.Context, playerID string, incrScore int64, timestamp int64) (_ bool, err error) {
+	defer s.observePlayer(&ctx, "TryUpdateScore", playerID)(&err)
+	result, err := s.incrScore(ctx, playerID, incrScore, timestamp)
+	return result != incrSkipped, err
+}
+
+// UpdateScoreCreated 与 UpdateScore 相同, 但额外返回玩家是否是本次更新新加入排行榜的
+// 只有玩家此前不在排行榜上时 created 才为 true
+func (s *LeaderboardService) UpdateScoreCreated(ctx context.Context, playerID string, incrScore int64, timestamp int64) (created bool, err error) {
+	defer s.observePlayer(&ctx, "UpdateScoreCreated", playerID)(&err)
+	result, err := s.incrScore(ctx, playerID, incrScore, timestamp)
+	return result&^incrClamped == incrCreated, err
+}
+
+// UpdateScoreClamped 与 UpdateScore 相同, 但额外返回新分数是否被 WithScoreBounds 的区间截断
+func (s *LeaderboardService) UpdateScoreClamped(ctx context.Context, playerID string, incrScore int64, timestamp int64) (clamped bool, err error) {
+	defer s.observePlayer(&ctx, "UpdateScoreClamped", playerID)(&err)
+	result, err := s.incrScore(ctx, playerID, incrScore, timestamp)
+	return result&incrClamped != 0, err
+}
+
+// incrScore 是 UpdateScore 系列方法的共同实现, 返回值与 updateScoreScript 相同
+func (s *LeaderboardService) incrScore(ctx context.Context, playerID string, incrScore int64, timestamp int64) (int, error) {
+	return s.incrScoreOnce(ctx, playerID, incrScore, timestamp, "")
+}
+
+// incrScoreOnce 与 incrScore 相同, eventID 不为空时改用 updateScoreOnceScript 去重, 见 UpdateScoreOnce
+func (s *LeaderboardService) incrScoreOnce(ctx context.Context, playerID string, incrScore int64, timestamp int64, eventID string) (int, error) {
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	if !s.clampScores {
+		if err := checkIncr(incrScore); err != nil {
+			return 0, fmt.Errorf("player %s: %w", playerID, err)
 		}
 	}
-	return rankings, nil
+	timestamp, err = s.resolveTimestamp(ctx, timestamp)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return 0, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return 0, err
+	}
+	key := s.key()
+	notify := s.watchRank(ctx, key, member)
+	var cmd *redis.Cmd
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		switch {
+		case eventID != "":
+			cmd = s.runUpdateOnce(ctx, c, key, member, incrScore, timestamp, eventID)
+		case c == nil:
+			cmd = s.store.IncrScore(ctx, key, member, incrScore, s.tiebreak(timestamp), s.staleCheck(), s.minScore, s.maxScore, s.clampScores)
+		default:
+			// 与 redisStore.IncrScore 是同一个脚本, 开启 WithApproxRank 时额外维护分数桶
+			cmd = updateScoreScript.Run(ctx, c, s.scriptKeys(key), s.updateScoreArgs(member, incrScore, timestamp)...)
+		}
+		return cmd
+	})
+	result, err := cmd.Int()
+	if errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if result == incrDuplicate {
+		return result, nil
+	}
+	if result != incrSkipped {
+		s.invalidateCached(key, playerID)
+		s.recordHistory(ctx, key, member, timestamp)
+		notify()
+	}
+	return result, nil
 }
 
-// =================================================================
-// main 函数 - 用于演示和测试
-// =================================================================
-func main() {
-	//  初始化 ---
-	// 假设本地 Redis 在默认端口 6379 上运行
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "", // no password set
-		DB:       0,  // use default DB
+// updateScoreArgs 返回直接调用 updateScoreScript 时的 ARGV, member 为编码后的成员
+func (s *LeaderboardService) updateScoreArgs(member string, incrScore int64, timestamp int64) []interface{} {
+	clamp := 0
+	if s.clampScores {
+		clamp = 1
+	}
+	return []interface{}{member, incrScore, s.tiebreak(timestamp), scoreMultiplier,
+		s.minScore, s.maxScore, s.staleCheck(), clamp, s.bucketWidth}
+}
+
+// SetScore 直接将玩家积分设置为 score, 不读取旧值
+// 组合方式与 UpdateScore 相同: 同分时时间戳越早排名越靠前
+func (s *LeaderboardService) SetScore(ctx context.Context, playerID string, score int64, timestamp int64) (err error) {
+	defer s.observePlayer(&ctx, "SetScore", playerID)(&err)
+	_, err = s.setScore(ctx, playerID, score, timestamp)
+	return err
+}
+
+// SetScoreClamped 与 SetScore 相同, 但额外返回 score 是否被 WithScoreBounds 的区间截断
+func (s *LeaderboardService) SetScoreClamped(ctx context.Context, playerID string, score int64, timestamp int64) (clamped bool, err error) {
+	defer s.observePlayer(&ctx, "SetScoreClamped", playerID)(&err)
+	return s.setScore(ctx, playerID, score, timestamp)
+}
+
+// setScore 是 SetScore 和 SetScoreClamped 的共同实现
+func (s *LeaderboardService) setScore(ctx context.Context, playerID string, score int64, timestamp int64) (bool, error) {
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+	clamped := false
+	if score < s.minScore || score > s.maxScore {
+		if !s.clampScores {
+			return false, fmt.Errorf("%w: player %s score %d", ErrScoreOutOfRange, playerID, score)
+		}
+		score = min(max(score, s.minScore), s.maxScore)
+		clamped = true
+	}
+	timestamp, err = s.resolveTimestamp(ctx, timestamp)
+	if err != nil {
+		return false, err
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return false, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return false, err
+	}
+	key := s.key()
+	release, err := s.flushPending(ctx, key, []string{playerID})
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	notify := s.watchRank(ctx, key, member)
+	var cmd redis.Cmder
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		z := redis.Z{Score: s.combineScore(score, timestamp), Member: member}
+		switch {
+		case c == nil:
+			cmd = s.store.ZAdd(ctx, key, z)
+		case s.bucketWidth > 0:
+			cmd = bucketWriteScript.Run(ctx, c, s.scriptKeys(key),
+				member, scoreMultiplier, s.bucketWidth, formatScore(z.Score), score)
+		default:
+			cmd = c.ZAdd(ctx, key, z)
+		}
+		return cmd
 	})
+	if err := cmd.Err(); err != nil {
+		return false, err
+	}
+	s.invalidateCached(key, playerID)
+	s.recordHistory(ctx, key, member, timestamp)
+	notify()
+	return clamped, nil
+}
 
-	// 检查 Redis 连接
-	_, err := rdb.Ping(context.Background()).Result()
+// UpdateScoresBatch 在一次往返中批量更新多个玩家积分
+// 每个更新与 UpdateScore 使用同一个 Lua 脚本, 组合分数的计算完全一致
+// 部分失败时返回的 error 由若干 *ScoreUpdateError 组成, 可通过 errors.As 取出失败的玩家
+func (s *LeaderboardService) UpdateScoresBatch(ctx context.Context, updates []ScoreUpdate) (err error) {
+	defer s.observe(&ctx, "UpdateScoresBatch")(&err)
+	if err := s.requireRedis("UpdateScoresBatch"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
 	if err != nil {
-		fmt.Printf("无法连接到 Redis: %v\n", err)
-		fmt.Println("请确保本地 6379 端口的 Redis 服务正在运行。")
-		return
+		return err
 	}
+	defer done()
+	return s.updateScoresBatch(ctx, s.key(), updates)
+}
 
-	service := NewLeaderboardService(rdb)
+// updateScoresBatch 是 UpdateScoresBatch 的实现, 将 updates 写入排行榜 key
+func (s *LeaderboardService) updateScoresBatch(ctx context.Context, key string, updates []ScoreUpdate) (err error) {
+	if len(updates) == 0 {
+		return nil
+	}
 
-	// 准备测试数据并清理环境 ---
-	fmt.Println("--- 准备测试数据 ---")
-	// 清理旧数据，保证测试环境干净
-	rdb.Del(context.Background(), leaderboardKey)
+	// 整批共用一次读取的服务器时间, 见 WithServerTimestamps
+	var serverNow int64
+	for _, u := range updates {
+		if u.Timestamp == 0 {
+			if serverNow, err = s.resolveTimestamp(ctx, 0); err != nil {
+				return err
+			}
+			break
+		}
+	}
 
-	// 准备玩家数据
-	players := []struct {
-		ID        string
-		Score     int64
-		Timestamp int64
-	}{
-		{"playerA", 100, time.Now().Unix() - 100}, // 100分, 时间早
-		{"playerB", 100, time.Now().Unix() - 50},  // 100分, 时间晚
-		{"playerC", 95, time.Now().Unix() - 80},
-		{"playerD", 120, time.Now().Unix() - 60}, // 最高分
-		{"playerE", 90, time.Now().Unix() - 40},
-		{"playerF", 89, time.Now().Unix() - 20},
-		{"playerG", 105, time.Now().Unix() - 30},
+	pipe := s.rdb.Pipeline()
+	// 先在同一个 pipeline 中加载脚本, 保证后续 EVALSHA 不会因 NOSCRIPT 失败
+	updateScoreScript.Load(ctx, pipe)
+	var errs []error
+	cmds := make([]*redis.Cmd, len(updates))
+	for i, u := range updates {
+		if u.Timestamp == 0 {
+			u.Timestamp = serverNow
+		}
+		if !s.clampScores {
+			if err := checkIncr(u.IncrScore); err != nil {
+				errs = append(errs, &ScoreUpdateError{PlayerID: u.PlayerID, Err: err})
+				continue
+			}
+		}
+		if err := s.checkTimestamp(u.Timestamp); err != nil {
+			errs = append(errs, &ScoreUpdateError{PlayerID: u.PlayerID, Err: err})
+			continue
+		}
+		member, err := s.member(u.PlayerID)
+		if err != nil {
+			errs = append(errs, &ScoreUpdateError{PlayerID: u.PlayerID, Err: err})
+			continue
+		}
+		cmds[i] = updateScoreScript.EvalSha(ctx, pipe, s.scriptKeys(key), s.updateScoreArgs(member, u.IncrScore, u.Timestamp)...)
+	}
+	s.touchExpiry(ctx, pipe, key)
+	// 单条命令的错误在下面逐个收集; 连接失败等错误不会设置到各条命令上, 此时整批都没有写入, 直接返回
+	var redisErr redis.Error
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) && !errors.As(err, &redisErr) {
+		return err
 	}
 
-	// 写入初始分数
-	for _, p := range players {
-		err := service.UpdateScore(p.ID, p.Score, p.Timestamp)
+	playerIDs := make([]string, len(updates))
+	for i, u := range updates {
+		playerIDs[i] = u.PlayerID
+	}
+	s.invalidateCached(key, playerIDs...)
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+		err := cmd.Err()
+		if errors.Is(err, redis.Nil) {
+			err = ErrScoreOutOfRange
+		}
 		if err != nil {
-			fmt.Printf("为玩家 %s 更新分数失败: %v\n", p.ID, err)
-			return
+			errs = append(errs, &ScoreUpdateError{PlayerID: updates[i].PlayerID, Err: err})
 		}
 	}
-	fmt.Println("测试数据写入完成。")
-	fmt.Println("========================================")
+	return errors.Join(errs...)
+}
 
-	// 执行测试并打印结果 ---
+// GetPlayerRank 查询玩家当前排名
+// 玩家不在排行榜上时返回 ErrPlayerNotFound, 同时返回一个 Found 为 false、只包含 PlayerID 的 RankInfo
+func (s *LeaderboardService) GetPlayerRank(ctx context.Context, playerID string) (_ *RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRank", playerID)(&err)
+	key := s.key()
+	if s.rankCache == nil {
+		return s.displayRank(s.playerRank(ctx, key, playerID))
+	}
+	info, generation, ok := s.rankCache.get(key, playerID)
+	if ok {
+		return s.displayRank(info, nil)
+	}
+	if info, err = s.playerRank(ctx, key, playerID); err != nil {
+		return info, err
+	}
+	s.rankCache.put(key, *info, generation)
+	return s.displayRank(info, nil)
+}
 
-	// 测试 GetTopN
-	fmt.Println("\n--- 测试 GetTopN(5) ---")
-	top5, err := service.GetTopN(5)
+// playerRank 是 GetPlayerRank 的实现, 查询玩家在排行榜 key 上的排名
+func (s *LeaderboardService) playerRank(ctx context.Context, key, playerID string) (*RankInfo, error) {
+	member, err := s.member(playerID)
 	if err != nil {
-		fmt.Printf("获取 Top 5 失败: %v\n", err)
+		return nil, err
+	}
+	var (
+		rank          int64
+		combinedScore float64
+	)
+	if s.resolvesTies() {
+		rank, combinedScore, err = s.resolvedRankAndScore(ctx, key, member)
 	} else {
-		fmt.Println("排行榜前 5 名:")
-		for _, p := range top5 {
-			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		rank, combinedScore, err = s.rankAndScore(ctx, key, member)
+	}
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return &RankInfo{PlayerID: playerID}, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
 		}
+		return nil, err
 	}
-	fmt.Println("========================================")
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, timestamp := s.decodeScore(combinedScore)
 
-	// 测试 GetPlayerRank
-	fmt.Println("\n--- 测试 GetPlayerRank ---")
-	testPlayersForRank := []string{"playerA", "playerD", "playerF"}
-	for _, playerID := range testPlayersForRank {
-		rankInfo, err := service.GetPlayerRank(playerID)
+	return &RankInfo{
+		PlayerID:  playerID,
+		Score:     score,
+		Rank:      rank + 1, // 转换为 1-based 排名
+		Timestamp: timestamp,
+		Found:     true,
+	}, nil
+}
+
+// rankAndScore 读取成员的 0-based 名次和组合分数, 成员不存在时返回 redis.Nil
+// 基于 Redis 时两条命令在同一个 pipeline 中发送, 只需一次往返; 自定义 RankStore 依次读取
+func (s *LeaderboardService) rankAndScore(ctx context.Context, key, member string) (int64, float64, error) {
+	if s.reader == nil {
+		rank, err := s.rank(ctx, s.readStore, key, member).Result()
 		if err != nil {
-			fmt.Printf("查询玩家 %s 排名失败: %v\n", playerID, err)
-		} else {
-			fmt.Printf("玩家 %s 的信息: 排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+			return 0, 0, err
 		}
+		combinedScore, err := s.readStore.ZScore(ctx, key, member).Result()
+		return rank, combinedScore, err
 	}
-	fmt.Println("========================================")
-
-	// 测试 UpdateScore
-	fmt.Println("\n--- 测试 UpdateScore (playerF 增加 20分) ---")
-	fmt.Println("playerF 初始分数 89...")
-	err = service.UpdateScore("playerF", 20, time.Now().Unix())
+	pipe := s.reader.Pipeline()
+	rankCmd := s.rank(ctx, pipe, key, member)
+	scoreCmd := pipe.ZScore(ctx, key, member)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, 0, err
+	}
+	rank, err := rankCmd.Result()
 	if err != nil {
-		fmt.Printf("为 playerF 更新分数失败: %v\n", err)
-	} else {
-		rankInfo, _ := service.GetPlayerRank("playerF")
-		fmt.Printf("玩家 playerF 的新信息: 排名=%d, 分数=%d\n", rankInfo.Rank, rankInfo.Score)
+		return 0, 0, err
 	}
-	fmt.Println("========================================")
+	combinedScore, err := scoreCmd.Result()
+	return rank, combinedScore, err
+}
 
-	// 测试 GetPlayerRankRange
-	fmt.Println("\n--- 测试 GetPlayerRankRange ---")
-	targetPlayer := "playerG"
-	var nRange int64 = 4
-	fmt.Printf("查询玩家 %s 周边共 %d 名的排名...\n", targetPlayer, nRange)
-	rangeData, err := service.GetPlayerRankRange(targetPlayer, nRange)
+// GetPlayerCount 返回排行榜上的玩家总数, 排行榜不存在时返回 0
+func (s *LeaderboardService) GetPlayerCount(ctx context.Context) (_ int64, err error) {
+	defer s.observe(&ctx, "GetPlayerCount")(&err)
+	return s.readStore.ZCard(ctx, s.key()).Result()
+}
+
+// GetPlayerRankWithTotal 在一次往返中同时查询玩家排名和排行榜总人数
+func (s *LeaderboardService) GetPlayerRankWithTotal(ctx context.Context, playerID string) (_ *RankWithTotal, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankWithTotal", playerID)(&err)
+	if err := s.requireRedis("GetPlayerRankWithTotal"); err != nil {
+		return nil, err
+	}
+	info, err := s.playerRankWithTotal(ctx, playerID)
 	if err != nil {
-		fmt.Printf("查询玩家 %s 周边排名失败: %v\n", targetPlayer, err)
-	} else {
+		return nil, err
+	}
+	s.displayRank(&info.RankInfo, nil)
+	return info, nil
+}
+
+// playerRankWithTotal 是 GetPlayerRankWithTotal 的实现, 供其他方法复用而不重复上报指标
+func (s *LeaderboardService) playerRankWithTotal(ctx context.Context, playerID string) (*RankWithTotal, error) {
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	key := s.key()
+	pipe := s.reader.Pipeline()
+	rankCmd := s.rank(ctx, pipe, key, member)
+	scoreCmd := pipe.ZScore(ctx, key, member)
+	totalCmd := pipe.ZCard(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	rank, err := rankCmd.Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	combinedScore, err := scoreCmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, timestamp := s.decodeScore(combinedScore)
+	return &RankWithTotal{
+		RankInfo: RankInfo{
+			PlayerID:  playerID,
+			Score:     score,
+			Rank:      rank + 1,
+			Timestamp: timestamp,
+			Found:     true,
+		},
+		Total: totalCmd.Val(),
+	}, nil
+}
+
+// GetPlayersRankBatch 在一次往返中批量查询多个玩家的排名
+// 结果顺序与 playerIDs 一致; 不在排行榜上的玩家同样返回一项, 其 Found 为 false, Rank 和 Score 为 0
+func (s *LeaderboardService) GetPlayersRankBatch(ctx context.Context, playerIDs []string) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetPlayersRankBatch")(&err)
+	if err := s.requireRedis("GetPlayersRankBatch"); err != nil {
+		return nil, err
+	}
+	if len(playerIDs) == 0 {
+		return []RankInfo{}, nil
+	}
+
+	key := s.key()
+	pipe := s.reader.Pipeline()
+	rankCmds := make([]*redis.IntCmd, len(playerIDs))
+	scoreCmds := make([]*redis.FloatCmd, len(playerIDs))
+	for i, playerID := range playerIDs {
+		member, err := s.member(playerID)
+		if err != nil {
+			return nil, err
+		}
+		rankCmds[i] = s.rank(ctx, pipe, key, member)
+		scoreCmds[i] = pipe.ZScore(ctx, key, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	rankings := make([]RankInfo, len(playerIDs))
+	for i, playerID := range playerIDs {
+		rankings[i].PlayerID = playerID
+		rank, err := rankCmds[i].Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		combinedScore, err := scoreCmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFinite(playerID, combinedScore); err != nil {
+			return nil, err
+		}
+		rankings[i].Score, rankings[i].Timestamp = s.decodeScore(combinedScore)
+		rankings[i].Rank = rank + 1
+		rankings[i].Found = true
+	}
+	return s.displayRankings(rankings, nil)
+}
+
+// GetPlayersByRanks 在一次往返中查询若干个指定排名 (1-based) 上的玩家, 例如奖励表中的第 1、10、100、1000 名
+// 每个排名在 pipeline 中各读取一条, 结果顺序与 ranks 一致; rank < 1 或超出排行榜人数时对应项为零值, 其 Found 为 false
+// 同分玩家按存储的顺序排列, 不按 WithTiebreakKeys 重新排序
+func (s *LeaderboardService) GetPlayersByRanks(ctx context.Context, ranks []int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetPlayersByRanks")(&err)
+	if err := s.requireRedis("GetPlayersByRanks"); err != nil {
+		return nil, err
+	}
+	if len(ranks) == 0 {
+		return []RankInfo{}, nil
+	}
+
+	key := s.key()
+	pipe := s.reader.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, len(ranks))
+	for i, rank := range ranks {
+		if rank >= 1 {
+			cmds[i] = s.rangeWithScores(ctx, pipe, key, rank-1, rank-1)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	rankings := make([]RankInfo, len(ranks))
+	for i, cmd := range cmds {
+		if cmd == nil || len(cmd.Val()) == 0 {
+			continue
+		}
+		infos, err := s.toRankInfos(cmd.Val(), ranks[i])
+		if err != nil {
+			return nil, err
+		}
+		rankings[i] = infos[0]
+	}
+	return s.displayRankings(rankings, nil)
+}
+
+// GetTopN 获取前 N 名玩家, n <= 0 时返回 ErrInvalidLimit
+func (s *LeaderboardService) GetTopN(ctx context.Context, n int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetTopN")(&err)
+	key := s.key()
+	if s.topCache == nil || n <= 0 {
+		return s.displayRankings(s.topN(ctx, key, n))
+	}
+	rankings, generation, ok := s.topCache.get(key, n)
+	if ok {
+		return s.displayRankings(rankings, nil)
+	}
+	if rankings, err = s.topN(ctx, key, n); err != nil {
+		return nil, err
+	}
+	s.topCache.put(key, n, rankings, generation)
+	return s.displayRankings(rankings, nil)
+}
+
+// topN 获取指定排行榜 key 的前 N 名玩家
+func (s *LeaderboardService) topN(ctx context.Context, key string, n int64) ([]RankInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	results, err := s.rangeResolved(ctx, key, 0, n-1)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.toRankInfos(results, 1)
+}
+
+// GetBottomN 获取排名最靠后的 n 名玩家, 从最后一名开始排列, n <= 0 时返回 ErrInvalidLimit
+// 返回的 Rank 为从榜首算起的实际排名, 即最后一名的 Rank 等于排行榜人数
+func (s *LeaderboardService) GetBottomN(ctx context.Context, n int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetBottomN")(&err)
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	key := s.key()
+	total, err := s.readStore.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	start := max(total-n, 0)
+	results, err := s.rangeWithScores(ctx, s.readStore, key, start, total-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	rankings, err := s.toRankInfos(results, start+1)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(rankings)
+	return s.displayRankings(rankings, nil)
+}
+
+// GetTopNPaged 按页获取排行榜, page 从 0 开始, 第 page 页包含排名 [page*pageSize+1, (page+1)*pageSize]
+// 页码超出排行榜范围时返回空切片
+func (s *LeaderboardService) GetTopNPaged(ctx context.Context, page, pageSize int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetTopNPaged")(&err)
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("%w: page size %d", ErrInvalidLimit, pageSize)
+	}
+	if page < 0 {
+		return nil, fmt.Errorf("invalid page %d", page)
+	}
+	start := page * pageSize
+	results, err := s.rangeResolved(ctx, s.key(), start, start+pageSize-1)
+	if err != nil {
+		return nil, err
+	}
+	return s.displayRankings(s.toRankInfos(results, start+1))
+}
+
+// GetRankRange 获取排名 [fromRank, toRank] (1-based, 包含两端) 内的玩家, 要求 1 <= fromRank <= toRank, 否则返回 ErrRankOutOfRange
+// fromRank 超出排行榜人数时返回空切片, toRank 超出时只返回到最后一名
+func (s *LeaderboardService) GetRankRange(ctx context.Context, fromRank, toRank int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetRankRange")(&err)
+	if fromRank < 1 || toRank < fromRank {
+		return nil, fmt.Errorf("%w: [%d, %d]", ErrRankOutOfRange, fromRank, toRank)
+	}
+	results, err := s.rangeResolved(ctx, s.key(), fromRank-1, toRank-1)
+	if err != nil {
+		return nil, err
+	}
+	return s.displayRankings(s.toRankInfos(results, fromRank))
+}
+
+// GetPlayerRankRange 查询自己名次前后共 N 名玩家, nRange <= 0 时返回 ErrInvalidLimit
+// 玩家之前取 (nRange-1)/2 名, nRange 为偶数时之后多取一名, 即 GetPlayerRankRangeWithOptions 的简写
+func (s *LeaderboardService) GetPlayerRankRange(ctx context.Context, playerID string, nRange int64) (_ []RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankRange", playerID)(&err)
+	opts, err := nRangeOptions(nRange)
+	if err != nil {
+		return nil, err
+	}
+	window, err := s.playerRankWindow(ctx, playerID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return window.Entries, nil
+}
+
+// RangeOptions 指定 GetPlayerRankRangeWithOptions 在玩家之前和之后各取多少名, IncludeSelf 为 false 时结果中不包含玩家自己
+type RangeOptions struct {
+	Above       int64
+	Below       int64
+	IncludeSelf bool
+}
+
+// nRangeOptions 把 GetPlayerRankRange 的 nRange 换算为 RangeOptions
+func nRangeOptions(nRange int64) (RangeOptions, error) {
+	if nRange <= 0 {
+		return RangeOptions{}, fmt.Errorf("%w: %d", ErrInvalidLimit, nRange)
+	}
+	above := (nRange - 1) / 2
+	return RangeOptions{Above: above, Below: nRange - 1 - above, IncludeSelf: true}, nil
+}
+
+// GetPlayerRankRangeWithOptions 查询玩家之前 opts.Above 名、之后 opts.Below 名玩家, Above 或 Below 为负时返回 ErrInvalidLimit
+// 与 GetPlayerRankRange 相同, 靠近榜首或榜尾时窗口整体平移, 排行榜人数足够时总是覆盖 Above+Below+1 个名次;
+// 需要在边界处截断而不是平移时使用 GetNeighbors
+func (s *LeaderboardService) GetPlayerRankRangeWithOptions(ctx context.Context, playerID string, opts RangeOptions) (_ []RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankRangeWithOptions", playerID)(&err)
+	window, err := s.playerRankWindow(ctx, playerID, opts)
+	if err != nil {
+		return nil, err
+	}
+	return window.Entries, nil
+}
+
+// GetPlayerRangeWindow 与 GetPlayerRankRange 相同, 但同时返回窗口的起止名次以及窗口之外是否还有玩家, 便于渲染 "加载更多"
+func (s *LeaderboardService) GetPlayerRangeWindow(ctx context.Context, playerID string, nRange int64) (_ *RankWindow, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRangeWindow", playerID)(&err)
+	opts, err := nRangeOptions(nRange)
+	if err != nil {
+		return nil, err
+	}
+	return s.playerRankWindow(ctx, playerID, opts)
+}
+
+// playerRankWindow 是 GetPlayerRankRange 系列方法的共同实现
+// IncludeSelf 为 false 时 Entries 中去掉玩家自己, StartRank、EndRank 等仍描述包含玩家的整个窗口
+func (s *LeaderboardService) playerRankWindow(ctx context.Context, playerID string, opts RangeOptions) (*RankWindow, error) {
+	if opts.Above < 0 || opts.Below < 0 {
+		return nil, fmt.Errorf("%w: above %d, below %d", ErrInvalidLimit, opts.Above, opts.Below)
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	key := s.key()
+	rank, err := s.rank(ctx, s.readStore, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	total, err := s.readStore.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	playerRank := rank + 1
+
+	// 靠近榜首或榜尾时窗口整体平移, 排行榜人数足够时总是覆盖 nRange 个名次
+	nRange := opts.Above + opts.Below + 1
+	startRank := playerRank - opts.Above
+	startRank = min(startRank, total-nRange+1)
+	startRank = max(startRank, 1)
+	// 人数不足 nRange 时窗口末端不超过最后一名
+	endRank := min(startRank+nRange-1, total)
+
+	results, err := s.rangeWithScores(ctx, s.readStore, key, startRank-1, endRank-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := s.displayRankings(s.toRankInfos(results, startRank))
+	if err != nil {
+		return nil, err
+	}
+	endRank = startRank + int64(len(entries)) - 1
+	if !opts.IncludeSelf {
+		entries = slices.DeleteFunc(entries, func(r RankInfo) bool { return r.PlayerID == playerID })
+	}
+	return &RankWindow{
+		Entries:   entries,
+		StartRank: startRank,
+		EndRank:   endRank,
+		HasAbove:  startRank > 1,
+		HasBelow:  endRank < total,
+	}, nil
+}
+
+// DeletePlayer 将玩家从排行榜中移除, 返回是否确实删除了成员
+// 同时删除玩家的元数据哈希, 以及开启 WithMetricWeights、WithScoreHistory、WithTiebreakKeys 时的原始指标、分数历史和附加排序字段, 与 DeletePlayers 相同
+func (s *LeaderboardService) DeletePlayer(ctx context.Context, playerID string) (_ bool, err error) {
+	defer s.observePlayer(&ctx, "DeletePlayer", playerID)(&err)
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+	member, err := s.member(playerID)
+	if err != nil {
+		return false, err
+	}
+	key := s.key()
+	release, err := s.flushPending(ctx, key, []string{playerID})
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	var removed int64
+	if s.bucketWidth > 0 {
+		removed, err = bucketWriteScript.Run(ctx, s.rdb, s.scriptKeys(s.key()), member, scoreMultiplier, s.bucketWidth, "", 0).Int64()
+	} else {
+		removed, err = s.store.ZRem(ctx, s.key(), member).Result()
+	}
+	if err != nil {
+		return false, err
+	}
+	s.invalidateCached(s.key(), playerID)
+	// 与 DeletePlayers 相同, 一并删除元数据、原始指标 (避免玩家重新上榜时旧指标被计入分数) 等附属 key
+	if err := s.deletePlayerKeys(ctx, s.key(), []string{playerID}, []string{member}); err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// deleteBatchSize 是 DeletePlayers 每条删除命令包含的最大玩家数
+const deleteBatchSize = 500
+
+// DeletePlayers 批量移除玩家, 返回实际从排行榜删除的成员数, 例如用于按 GDPR 要求批量删除数据
+// 每 deleteBatchSize 个玩家为一批, 每批用一条 ZREM (开启 WithApproxRank 时为一个 Lua 脚本) 删除;
+// 同时删除这些玩家的元数据哈希, 以及开启 WithMetricWeights、WithScoreHistory、WithTiebreakKeys 时的原始指标、分数历史和附加排序字段
+// 任意玩家 ID 无法编码时不删除任何数据; 中途失败时之前的批次已经删除
+func (s *LeaderboardService) DeletePlayers(ctx context.Context, playerIDs []string) (_ int64, err error) {
+	defer s.observe(&ctx, "DeletePlayers")(&err)
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer done()
+	members := make([]string, len(playerIDs))
+	for i, playerID := range playerIDs {
+		if members[i], err = s.member(playerID); err != nil {
+			return 0, err
+		}
+	}
+
+	key := s.key()
+	release, err := s.flushPending(ctx, key, playerIDs)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	var removed int64
+	for start := 0; start < len(members); start += deleteBatchSize {
+		end := min(start+deleteBatchSize, len(members))
+		batch := make([]interface{}, 0, end-start)
+		for _, member := range members[start:end] {
+			batch = append(batch, member)
+		}
+		var n int64
+		if s.bucketWidth > 0 {
+			n, err = bucketRemoveScript.Run(ctx, s.rdb, s.scriptKeys(key),
+				append([]interface{}{scoreMultiplier, s.bucketWidth}, batch...)...).Int64()
+		} else {
+			n, err = s.store.ZRem(ctx, key, batch...).Result()
+		}
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+		s.invalidateCached(key, playerIDs[start:end]...)
+		if err := s.deletePlayerKeys(ctx, key, playerIDs[start:end], members[start:end]); err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// deletePlayerKeys 删除一批玩家的元数据哈希, 以及已开启功能对应的原始指标、分数历史和附加排序字段
+func (s *LeaderboardService) deletePlayerKeys(ctx context.Context, key string, playerIDs, members []string) error {
+	if s.rdb == nil {
+		return nil
+	}
+	keys := make([]string, 0, len(members)*4)
+	for i, member := range members {
+		keys = append(keys, s.metadataKey(playerIDs[i]))
+		if s.weights() != nil {
+			keys = append(keys, s.metricsKey(key, member))
+		}
+		if s.historyLimit > 0 {
+			keys = append(keys, s.historyKey(key, member))
+		}
+		if len(s.tiebreakKeys) > 0 {
+			keys = append(keys, s.tiebreakValuesKey(key, member))
+		}
+	}
+	return s.rdb.Del(ctx, keys...).Err()
+}
+
+// resetAndArchiveScript 在排行榜存在时将其重命名为归档 key, 并删除属于旧赛季的附属 key
+// KEYS[1]: 排行榜 key, KEYS[2]: 归档 key, KEYS[3..]: 需要删除的附属 key (分数桶哈希、衰减时间)
+var resetAndArchiveScript = redis.NewScript(`
+if #KEYS > 2 then
+	redis.call('DEL', unpack(KEYS, 3))
+end
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	redis.call('RENAME', KEYS[1], KEYS[2])
+	return 1
+end
+return 0
+`)
+
+// ResetLeaderboard 删除当前排行榜, 用于赛季重置
+func (s *LeaderboardService) ResetLeaderboard(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "ResetLeaderboard")(&err)
+	if err := s.requireRedis("ResetLeaderboard"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	defer s.topCache.clear()
+	defer s.rankCache.clear()
+	key := s.key()
+	release, err := s.flushPending(ctx, key, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return s.rdb.Del(ctx, append(s.scriptKeys(key), s.decayedAtKey(key))...).Err()
+}
+
+// ResetAndArchive 将当前排行榜原子地重命名为 archiveKey 以保留最终排名, 原排行榜随之清空
+// archiveKey 已存在时会被覆盖; 排行榜为空时不做任何操作
+// 与 ResetLeaderboard 相同, 同时删除分数桶和 ApplyDecay 的衰减时间并清空查询缓存; 归档只保留排行榜本身
+func (s *LeaderboardService) ResetAndArchive(ctx context.Context, archiveKey string) (err error) {
+	defer s.observe(&ctx, "ResetAndArchive")(&err)
+	if err := s.requireRedis("ResetAndArchive"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	key := s.key()
+	release, err := s.flushPending(ctx, key, nil)
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer s.topCache.clear()
+	defer s.rankCache.clear()
+	keys := append([]string{key, archiveKey}, s.scriptKeys(key)[1:]...)
+	return resetAndArchiveScript.Run(ctx, s.rdb, append(keys, s.decayedAtKey(key))).Err()
+}
+
+// slogLogger 将 log/slog 适配为 Logger, 仅用于演示
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (a slogLogger) Debug(msg string, kv ...interface{}) { a.l.Debug(msg, kv...) }
+func (a slogLogger) Info(msg string, kv ...interface{})  { a.l.Info(msg, kv...) }
+func (a slogLogger) Warn(msg string, kv ...interface{})  { a.l.Warn(msg, kv...) }
+func (a slogLogger) Error(msg string, kv ...interface{}) { a.l.Error(msg, kv...) }
+
+// printTracer 把 span 的开始和结束打印到标准输出, 仅用于演示 Tracer 的接入方式
+type printTracer struct{}
+
+// printSpan 是 printTracer 创建的 span
+type printSpan struct {
+	name  string
+	start time.Time
+}
+
+func (printTracer) Start(ctx context.Context, spanName string, kv ...interface{}) (context.Context, Span) {
+	fmt.Printf("span 开始: %s %v\n", spanName, kv)
+	return ctx, printSpan{name: spanName, start: time.Now()}
+}
+
+func (p printSpan) End(err error) {
+	fmt.Printf("span 结束: %s, 耗时 %v, err=%v\n", p.name, time.Since(p.start), err)
+}
+
+// =================================================================
+// main 函数 - 用于演示, 带断言的测试见 *_test.go
+// =================================================================
+func main() {
+	//  初始化 ---
+	ctx := context.Background()
+	// 假设本地 Redis 在默认端口 6379 上运行
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     "localhost:6379",
+		Password: "", // no password set
+		DB:       0,  // use default DB
+	})
+
+	// 检查 Redis 连接
+	_, err := rdb.Ping(ctx).Result()
+	if err != nil {
+		fmt.Printf("无法连接到 Redis: %v\n", err)
+		fmt.Println("请确保本地 6379 端口的 Redis 服务正在运行。")
+		return
+	}
+
+	service := NewLeaderboardService(rdb)
+
+	// 准备测试数据并清理环境 ---
+	fmt.Println("--- 准备测试数据 ---")
+	// 清理旧数据，保证测试环境干净
+	if err := service.ResetLeaderboard(ctx); err != nil {
+		fmt.Printf("清理排行榜失败: %v\n", err)
+		return
+	}
+
+	// 准备玩家数据
+	players := []struct {
+		ID        string
+		Score     int64
+		Timestamp int64
+	}{
+		{"playerA", 100, time.Now().Unix() - 100}, // 100分, 时间早
+		{"playerB", 100, time.Now().Unix() - 50},  // 100分, 时间晚
+		{"playerC", 95, time.Now().Unix() - 80},
+		{"playerD", 120, time.Now().Unix() - 60}, // 最高分
+		{"playerE", 90, time.Now().Unix() - 40},
+		{"playerF", 89, time.Now().Unix() - 20},
+		{"playerG", 105, time.Now().Unix() - 30},
+	}
+
+	// 写入初始分数
+	for _, p := range players {
+		err := service.UpdateScore(ctx, p.ID, p.Score, p.Timestamp)
+		if err != nil {
+			fmt.Printf("为玩家 %s 更新分数失败: %v\n", p.ID, err)
+			return
+		}
+	}
+	fmt.Println("测试数据写入完成。")
+	fmt.Println("========================================")
+
+	// 执行测试并打印结果 ---
+
+	// 测试 GetTopN
+	fmt.Println("\n--- 测试 GetTopN(5) ---")
+	top5, err := service.GetTopN(ctx, 5)
+	if err != nil {
+		fmt.Printf("获取 Top 5 失败: %v\n", err)
+	} else {
+		fmt.Println("排行榜前 5 名:")
+		for _, p := range top5 {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRank
+	fmt.Println("\n--- 测试 GetPlayerRank ---")
+	testPlayersForRank := []string{"playerA", "playerD", "playerF"}
+	for _, playerID := range testPlayersForRank {
+		rankInfo, err := service.GetPlayerRank(ctx, playerID)
+		if err != nil {
+			fmt.Printf("查询玩家 %s 排名失败: %v\n", playerID, err)
+		} else {
+			fmt.Printf("玩家 %s 的信息: 排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 UpdateScore
+	fmt.Println("\n--- 测试 UpdateScore (playerF 增加 20分) ---")
+	fmt.Println("playerF 初始分数 89...")
+	err = service.UpdateScore(ctx, "playerF", 20, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("为 playerF 更新分数失败: %v\n", err)
+	} else {
+		rankInfo, _ := service.GetPlayerRank(ctx, "playerF")
+		fmt.Printf("玩家 playerF 的新信息: 排名=%d, 分数=%d\n", rankInfo.Rank, rankInfo.Score)
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankRange
+	fmt.Println("\n--- 测试 GetPlayerRankRange ---")
+	targetPlayer := "playerG"
+	var nRange int64 = 4
+	fmt.Printf("查询玩家 %s 周边共 %d 名的排名...\n", targetPlayer, nRange)
+	rangeData, err := service.GetPlayerRankRange(ctx, targetPlayer, nRange)
+	if err != nil {
+		fmt.Printf("查询玩家 %s 周边排名失败: %v\n", targetPlayer, err)
+	} else {
 		fmt.Printf("玩家 %s 周边排名结果:\n", targetPlayer)
 		for _, p := range rangeData {
 			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
@@ -237,4 +1498,1501 @@ func main() {
 	}
 	fmt.Println("========================================")
 
+	// 测试已取消的 context
+	fmt.Println("\n--- 测试已取消的 context ---")
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = service.GetTopN(cancelledCtx, 5)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("已取消的 context 立即返回 context.Canceled")
+	} else {
+		fmt.Printf("期望 context.Canceled, 实际: %v\n", err)
+	}
+	fmt.Println("========================================")
+
+	// 测试 DeletePlayer
+	fmt.Println("\n--- 测试 DeletePlayer (删除 playerE) ---")
+	removed, err := service.DeletePlayer(ctx, "playerE")
+	if err != nil {
+		fmt.Printf("删除 playerE 失败: %v\n", err)
+	} else {
+		fmt.Printf("删除 playerE: removed=%v\n", removed)
+		if _, err := service.GetPlayerRank(ctx, "playerE"); err != nil {
+			fmt.Printf("删除后查询 playerE: %v\n", err)
+		} else {
+			fmt.Println("删除后仍能查到 playerE, 不符合预期")
+		}
+	}
+	removed, err = service.DeletePlayer(ctx, "playerE")
+	fmt.Printf("重复删除 playerE: removed=%v, err=%v\n", removed, err)
+	fmt.Println("========================================")
+
+	// 测试并发 UpdateScore
+	fmt.Println("\n--- 测试并发 UpdateScore (100 个 goroutine 各为 playerA 加 1 分) ---")
+	before, err := service.GetPlayerRank(ctx, "playerA")
+	if err != nil {
+		fmt.Printf("查询 playerA 失败: %v\n", err)
+	} else {
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := service.UpdateScore(ctx, "playerA", 1, time.Now().Unix()); err != nil {
+					fmt.Printf("并发更新 playerA 失败: %v\n", err)
+				}
+			}()
+		}
+		wg.Wait()
+		after, err := service.GetPlayerRank(ctx, "playerA")
+		if err != nil {
+			fmt.Printf("查询 playerA 失败: %v\n", err)
+		} else if after.Score != before.Score+100 {
+			fmt.Printf("并发更新丢失: 期望 %d, 实际 %d\n", before.Score+100, after.Score)
+		} else {
+			fmt.Printf("并发更新正确: %d -> %d\n", before.Score, after.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 UpdateScoresBatch
+	fmt.Println("\n--- 测试 UpdateScoresBatch (playerB +5, playerC +10, playerH 新玩家 50) ---")
+	err = service.UpdateScoresBatch(ctx, []ScoreUpdate{
+		{PlayerID: "playerB", IncrScore: 5, Timestamp: time.Now().Unix()},
+		{PlayerID: "playerC", IncrScore: 10, Timestamp: time.Now().Unix()},
+		{PlayerID: "playerH", IncrScore: 50, Timestamp: time.Now().Unix()},
+	})
+	if err != nil {
+		var updateErr *ScoreUpdateError
+		if errors.As(err, &updateErr) {
+			fmt.Printf("批量更新玩家 %s 失败: %v\n", updateErr.PlayerID, updateErr.Err)
+		} else {
+			fmt.Printf("批量更新失败: %v\n", err)
+		}
+	} else {
+		for _, playerID := range []string{"playerB", "playerC", "playerH"} {
+			rankInfo, _ := service.GetPlayerRank(ctx, playerID)
+			fmt.Printf("玩家 %s 的新信息: 排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 SetScore
+	fmt.Println("\n--- 测试 SetScore (playerH 直接设置为 120 分, 时间晚于 playerD) ---")
+	err = service.SetScore(ctx, "playerH", 120, time.Now().Unix())
+	if err != nil {
+		fmt.Printf("为 playerH 设置分数失败: %v\n", err)
+	} else {
+		for _, playerID := range []string{"playerD", "playerH"} {
+			rankInfo, _ := service.GetPlayerRank(ctx, playerID)
+			fmt.Printf("玩家 %s 的信息: 排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerCount / GetPlayerRankWithTotal
+	fmt.Println("\n--- 测试 GetPlayerCount / GetPlayerRankWithTotal ---")
+	total, err := service.GetPlayerCount(ctx)
+	if err != nil {
+		fmt.Printf("获取玩家总数失败: %v\n", err)
+	} else {
+		fmt.Printf("排行榜玩家总数: %d\n", total)
+	}
+	withTotal, err := service.GetPlayerRankWithTotal(ctx, "playerF")
+	if err != nil {
+		fmt.Printf("查询 playerF 排名失败: %v\n", err)
+	} else {
+		fmt.Printf("玩家 playerF 排名 %d / %d, 分数=%d\n", withTotal.Rank, withTotal.Total, withTotal.Score)
+	}
+	fmt.Println("========================================")
+
+	// 测试大分数下的时间戳排序
+	fmt.Printf("\n--- 测试大分数 (maxSafeScore=%d) 下的时间戳排序 ---\n", maxSafeScore)
+	now := time.Now().Unix()
+	_ = service.SetScore(ctx, "bigEarly", maxSafeScore, now-10)
+	_ = service.SetScore(ctx, "bigLate", maxSafeScore, now)
+	early, errEarly := service.GetPlayerRank(ctx, "bigEarly")
+	late, errLate := service.GetPlayerRank(ctx, "bigLate")
+	if errEarly != nil || errLate != nil {
+		fmt.Printf("查询大分数玩家失败: %v, %v\n", errEarly, errLate)
+	} else if early.Rank < late.Rank {
+		fmt.Printf("同分时早提交者排名靠前: bigEarly=%d, bigLate=%d\n", early.Rank, late.Rank)
+	} else {
+		fmt.Printf("时间戳排序失真: bigEarly=%d, bigLate=%d\n", early.Rank, late.Rank)
+	}
+	err = service.SetScore(ctx, "bigOverflow", maxSafeScore+1, now)
+	fmt.Printf("超出安全范围的分数: errors.Is(err, ErrScoreOutOfRange)=%v\n", errors.Is(err, ErrScoreOutOfRange))
+	service.DeletePlayer(ctx, "bigEarly")
+	service.DeletePlayer(ctx, "bigLate")
+	fmt.Println("========================================")
+
+	// 测试 GetPlayersRankBatch
+	fmt.Println("\n--- 测试 GetPlayersRankBatch (包含不存在的 playerZ) ---")
+	batchRanks, err := service.GetPlayersRankBatch(ctx, []string{"playerD", "playerZ", "playerA"})
+	if err != nil {
+		fmt.Printf("批量查询排名失败: %v\n", err)
+	} else {
+		for _, p := range batchRanks {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 在榜上=%v\n", p.Rank, p.PlayerID, p.Score, p.Found)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试时间窗口排行榜
+	fmt.Println("\n--- 测试日榜 (WithWindow(WindowDaily)) ---")
+	dailyService := NewLeaderboardService(rdb, WithWindow(WindowDaily))
+	dailyKey := WindowKey(leaderboardKey, WindowDaily, time.Now(), time.Monday)
+	fmt.Printf("当前日榜 key: %s\n", dailyKey)
+	_ = dailyService.UpdateScore(ctx, "playerA", 30, time.Now().Unix())
+	_ = dailyService.UpdateScore(ctx, "playerB", 40, time.Now().Unix())
+	dailyTop, err := dailyService.GetTopNForWindow(ctx, WindowDaily, time.Now(), 3)
+	if err != nil {
+		fmt.Printf("获取日榜失败: %v\n", err)
+	} else {
+		for _, p := range dailyTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	rdb.Del(ctx, dailyKey)
+	fmt.Println("========================================")
+
+	// 测试 ApplyDecay
+	fmt.Println("\n--- 测试 ApplyDecay (半衰期 1 分钟, 先 dry-run) ---")
+	wouldChange, err := service.ApplyDecay(ctx, time.Minute, true)
+	if err != nil {
+		fmt.Printf("dry-run 衰减失败: %v\n", err)
+	} else {
+		fmt.Printf("dry-run: 将有 %d 名玩家的分数发生变化\n", wouldChange)
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPage
+	fmt.Println("\n--- 测试 GetPage (每页 3 名, 游标分页) ---")
+	pageCursor := ""
+	for pageNo := 1; ; pageNo++ {
+		page, err := service.GetPage(ctx, pageCursor, 3)
+		if err != nil {
+			fmt.Printf("获取第 %d 页失败: %v\n", pageNo, err)
+			break
+		}
+		fmt.Printf("第 %d 页:\n", pageNo)
+		for _, p := range page.Entries {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		pageCursor = page.NextCursor
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetScoreDistribution
+	fmt.Println("\n--- 测试 GetScoreDistribution (边界 90, 100, 110) ---")
+	distribution, err := service.GetScoreDistribution(ctx, []int64{90, 100, 110})
+	if err != nil {
+		fmt.Printf("获取分数分布失败: %v\n", err)
+	} else {
+		for _, bucket := range distribution {
+			fmt.Printf("[%d, %d): %d 人\n", bucket.Low, bucket.High, bucket.Count)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerPercentile
+	fmt.Println("\n--- 测试 GetPlayerPercentile ---")
+	for _, playerID := range []string{"playerD", "playerF"} {
+		percentile, err := service.GetPlayerPercentile(ctx, playerID)
+		if err != nil {
+			fmt.Printf("查询玩家 %s 百分位失败: %v\n", playerID, err)
+		} else {
+			fmt.Printf("玩家 %s 的百分位: %.2f\n", playerID, percentile)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetScoreAtRank
+	fmt.Println("\n--- 测试 GetScoreAtRank (第 3 名 / 第 0 名 / 第 1000 名) ---")
+	for _, rank := range []int64{3, 0, 1000} {
+		score, err := service.GetScoreAtRank(ctx, rank)
+		if err != nil {
+			fmt.Printf("查询第 %d 名分数失败: %v\n", rank, err)
+		} else {
+			fmt.Printf("第 %d 名的分数: %d\n", rank, score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetTopN / GetPlayerRankRange 的非正数 N
+	fmt.Println("\n--- 测试 GetTopN / GetPlayerRankRange 的边界 N (0, -1, 1000) ---")
+	for _, n := range []int64{0, -1, 1000} {
+		topPlayers, err := service.GetTopN(ctx, n)
+		fmt.Printf("GetTopN(%d): %d 名玩家, ErrInvalidLimit=%v\n", n, len(topPlayers), errors.Is(err, ErrInvalidLimit))
+		rangePlayers, err := service.GetPlayerRankRange(ctx, "playerA", n)
+		fmt.Printf("GetPlayerRankRange(playerA, %d): %d 名玩家, ErrInvalidLimit=%v\n", n, len(rangePlayers), errors.Is(err, ErrInvalidLimit))
+	}
+	fmt.Println("========================================")
+
+	// 测试 HealthCheck
+	fmt.Println("\n--- 测试 HealthCheck ---")
+	if err := service.HealthCheck(ctx); err != nil {
+		fmt.Printf("健康检查失败: %v\n", err)
+	} else {
+		fmt.Println("健康检查通过")
+	}
+	err = NewLeaderboardService(rdb, WithWindow(WindowMonthly)).HealthCheck(ctx)
+	fmt.Printf("不存在的月榜: ErrLeaderboardKeyMissing=%v\n", errors.Is(err, ErrLeaderboardKeyMissing))
+	fmt.Println("========================================")
+
+	// 测试 LeaderboardManager
+	fmt.Println("\n--- 测试 LeaderboardManager (game:lb:<mode>) ---")
+	manager := NewLeaderboardManager(rdb, "game:lb")
+	fmt.Printf("同一模式返回同一实例: %v\n", manager.Board("ranked") == manager.Board("ranked"))
+	_ = manager.Board("ranked").UpdateScore(ctx, "playerA", 10, time.Now().Unix())
+	_ = manager.Board("casual").UpdateScore(ctx, "playerA", 20, time.Now().Unix())
+	for _, mode := range []string{"ranked", "casual"} {
+		rankInfo, err := manager.Board(mode).GetPlayerRank(ctx, "playerA")
+		if err != nil {
+			fmt.Printf("查询模式 %s 失败: %v\n", mode, err)
+		} else {
+			fmt.Printf("模式 %s: 玩家 playerA 分数=%d\n", mode, rankInfo.Score)
+		}
+	}
+	rdb.Del(ctx, "game:lb:ranked", "game:lb:casual")
+	fmt.Println("========================================")
+
+	// 测试 ResetAndArchive
+	fmt.Println("\n--- 测试 ResetAndArchive (在独立的 season 排行榜上) ---")
+	seasonService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":season"))
+	archiveKey := leaderboardKey + ":season:archive"
+	_ = seasonService.UpdateScore(ctx, "playerA", 100, time.Now().Unix())
+	if err := seasonService.ResetAndArchive(ctx, archiveKey); err != nil {
+		fmt.Printf("归档排行榜失败: %v\n", err)
+	} else {
+		seasonCount, _ := seasonService.GetPlayerCount(ctx)
+		archived, _ := rdb.ZCard(ctx, archiveKey).Result()
+		fmt.Printf("归档后: 当前排行榜 %d 人, 归档 %d 人\n", seasonCount, archived)
+	}
+	rdb.Del(ctx, archiveKey)
+	fmt.Println("========================================")
+
+	// 测试 RankInfo.Timestamp
+	fmt.Println("\n--- 测试 RankInfo.Timestamp (还原提交时间) ---")
+	submittedAt := time.Now().Unix() - 3*3600
+	_ = service.SetScore(ctx, "playerT", -5, submittedAt)
+	if rankInfo, err := service.GetPlayerRank(ctx, "playerT"); err != nil {
+		fmt.Printf("查询 playerT 失败: %v\n", err)
+	} else {
+		fmt.Printf("玩家 playerT: 分数=%d, 时间戳正确=%v, %s前提交\n", rankInfo.Score, rankInfo.Timestamp == submittedAt,
+			time.Since(time.Unix(rankInfo.Timestamp, 0)).Round(time.Hour))
+	}
+	for _, ts := range []int64{0, -1} {
+		err := service.SetScore(ctx, "playerT", 10, ts)
+		fmt.Printf("时间戳 %d: ErrTimestampOutOfRange=%v\n", ts, errors.Is(err, ErrTimestampOutOfRange))
+	}
+	service.DeletePlayer(ctx, "playerT")
+	fmt.Println("========================================")
+
+	// 测试 GetPlayersWithinScore
+	fmt.Println("\n--- 测试 GetPlayersWithinScore (playerA ± 10 分) ---")
+	nearby, err := service.GetPlayersWithinScore(ctx, "playerA", 10)
+	if err != nil {
+		fmt.Printf("查询 playerA 附近分数的玩家失败: %v\n", err)
+	} else {
+		for _, p := range nearby {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 ErrPlayerNotFound
+	fmt.Println("\n--- 测试 ErrPlayerNotFound ---")
+	_, err = service.GetPlayerRank(ctx, "playerZ")
+	fmt.Printf("查询不存在的 playerZ: %v, errors.Is(err, ErrPlayerNotFound)=%v\n", err, errors.Is(err, ErrPlayerNotFound))
+	fmt.Println("========================================")
+
+	// 测试小数分数
+	fmt.Println("\n--- 测试 UpdateScoreFloat (95.5 分同分, 时间早者靠前) ---")
+	floatKey, floatTsKey := service.floatKeys()
+	_ = service.UpdateScoreFloat(ctx, "floatLate", 95.5, time.Now().Unix())
+	_ = service.UpdateScoreFloat(ctx, "floatEarly", 95.5, time.Now().Unix()-60)
+	_ = service.UpdateScoreFloat(ctx, "floatTop", 99.25, time.Now().Unix())
+	floatTop, err := service.GetTopNFloat(ctx, 2)
+	if err != nil {
+		fmt.Printf("获取小数分数排行榜失败: %v\n", err)
+	} else {
+		for _, p := range floatTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %.2f\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	if rankInfo, err := service.GetPlayerRankFloat(ctx, "floatLate"); err != nil {
+		fmt.Printf("查询 floatLate 失败: %v\n", err)
+	} else {
+		fmt.Printf("玩家 floatLate: 排名=%d, 分数=%.2f\n", rankInfo.Rank, rankInfo.Score)
+	}
+	rdb.Del(ctx, floatKey, floatTsKey)
+	fmt.Println("========================================")
+
+	// 测试 SnapshotRanks / GetRankChange
+	fmt.Println("\n--- 测试 SnapshotRanks / GetRankChange (playerE 加 50 分) ---")
+	snapshotKey := leaderboardKey + ":snapshot"
+	if err := service.SnapshotRanks(ctx, snapshotKey); err != nil {
+		fmt.Printf("保存排名快照失败: %v\n", err)
+	} else {
+		_ = service.UpdateScore(ctx, "playerE", 50, time.Now().Unix())
+		change, err := service.GetRankChange(ctx, "playerE", snapshotKey)
+		if errors.Is(err, ErrNotInSnapshot) {
+			fmt.Println("playerE 是快照之后新加入的玩家")
+		} else if err != nil {
+			fmt.Printf("查询 playerE 排名变化失败: %v\n", err)
+		} else {
+			fmt.Printf("玩家 playerE 排名变化: %+d\n", change)
+		}
+	}
+	rdb.Del(ctx, snapshotKey)
+	fmt.Println("========================================")
+
+	// 测试 WithRejectStaleTimestamps
+	fmt.Println("\n--- 测试 WithRejectStaleTimestamps (乱序到达的旧事件) ---")
+	strictService := NewLeaderboardService(rdb, WithRejectStaleTimestamps())
+	eventTime := time.Now().Unix()
+	applied, err := strictService.TryUpdateScore(ctx, "playerA", 1, eventTime)
+	fmt.Printf("新事件: applied=%v, err=%v\n", applied, err)
+	applied, err = strictService.TryUpdateScore(ctx, "playerA", 1, eventTime-100)
+	fmt.Printf("旧事件: applied=%v, err=%v\n", applied, err)
+	fmt.Println("========================================")
+
+	// 测试内存 RankStore
+	fmt.Println("\n--- 测试内存 RankStore (memstore, 不依赖 Redis) ---")
+	memService := NewLeaderboardServiceWithStore(memstore.New(int64(scoreMultiplier)))
+	_ = memService.UpdateScore(ctx, "memA", 100, time.Now().Unix()-10)
+	_ = memService.UpdateScore(ctx, "memB", 100, time.Now().Unix())
+	_ = memService.UpdateScore(ctx, "memC", 120, time.Now().Unix())
+	memTop, err := memService.GetTopN(ctx, 3)
+	if err != nil {
+		fmt.Printf("获取内存排行榜失败: %v\n", err)
+	} else {
+		for _, p := range memTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetTopNPaged
+	fmt.Println("\n--- 测试 GetTopNPaged (每页 3 名, 第 0 页 / 第 1 页 / 第 100 页) ---")
+	for _, pageNo := range []int64{0, 1, 100} {
+		pageData, err := service.GetTopNPaged(ctx, pageNo, 3)
+		if err != nil {
+			fmt.Printf("获取第 %d 页失败: %v\n", pageNo, err)
+			continue
+		}
+		fmt.Printf("第 %d 页共 %d 名:\n", pageNo, len(pageData))
+		for _, p := range pageData {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试安全范围边界
+	fmt.Println("\n--- 测试安全范围边界 (maxSafeScore) ---")
+	boundTs := time.Now().Unix()
+	fmt.Printf("SetScore(%d): err=%v\n", maxSafeScore, service.SetScore(ctx, "boundMax", maxSafeScore, boundTs))
+	fmt.Printf("SetScore(%d): err=%v\n", -maxSafeScore, service.SetScore(ctx, "boundMin", -maxSafeScore, boundTs))
+	fmt.Printf("SetScore(%d): err=%v\n", maxSafeScore+1, service.SetScore(ctx, "boundOver", maxSafeScore+1, boundTs))
+	_ = service.SetScore(ctx, "boundIncr", maxSafeScore-1, boundTs)
+	fmt.Printf("UpdateScore 到 %d: err=%v\n", maxSafeScore, service.UpdateScore(ctx, "boundIncr", 1, boundTs))
+	err = service.UpdateScore(ctx, "boundIncr", 1, boundTs)
+	fmt.Printf("UpdateScore 到 %d: err=%v, ErrScoreOutOfRange=%v\n", maxSafeScore+1, err, errors.Is(err, ErrScoreOutOfRange))
+	if boundInfo, err := service.GetPlayerRank(ctx, "boundIncr"); err == nil {
+		fmt.Printf("越界后分数保持不变: %d\n", boundInfo.Score)
+	}
+	fmt.Println("========================================")
+
+	// 测试 IterateAll
+	fmt.Println("\n--- 测试 IterateAll (每批 2 个, 流式遍历整个排行榜) ---")
+	iterCtx, cancelIter := context.WithCancel(ctx)
+	entries, iterErrs := service.IterateAll(iterCtx, 2)
+	iterated := 0
+	for p := range entries {
+		iterated++
+		if iterated <= 5 {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	cancelIter()
+	if err := <-iterErrs; err != nil {
+		fmt.Printf("遍历失败: %v\n", err)
+	}
+	fmt.Printf("共遍历 %d 名玩家\n", iterated)
+	fmt.Println("========================================")
+
+	// 测试 ExportJSON / ImportJSON
+	fmt.Println("\n--- 测试 ExportJSON / ImportJSON (导出后以 replace 模式导回, 排名顺序不变) ---")
+	var backup bytes.Buffer
+	if err := service.ExportJSON(ctx, &backup); err != nil {
+		fmt.Printf("导出失败: %v\n", err)
+	} else {
+		before, _ := service.GetTopN(ctx, 5)
+		if err := service.ImportJSON(ctx, bytes.NewReader(backup.Bytes()), ImportReplace); err != nil {
+			fmt.Printf("导入失败: %v\n", err)
+		}
+		after, _ := service.GetTopN(ctx, 5)
+		for i := range after {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d (导出前: %s)\n", after[i].Rank, after[i].PlayerID, after[i].Score, before[i].PlayerID)
+		}
+	}
+	err = service.ImportJSON(ctx, strings.NewReader(`[{"playerId":"importNew","score":42,"timestamp":1700000000}]`), ImportMerge)
+	fmt.Printf("merge 导入新玩家: err=%v\n", err)
+	fmt.Println("========================================")
+
+	// 测试 GetNeighbors
+	fmt.Println("\n--- 测试 GetNeighbors (前 2 名 / 后 1 名, 榜首玩家只截断上方) ---")
+	neighborIDs := []string{"playerC"}
+	if leader, err := service.GetTopN(ctx, 1); err == nil && len(leader) > 0 {
+		neighborIDs = append(neighborIDs, leader[0].PlayerID)
+	}
+	for _, id := range neighborIDs {
+		neighbors, err := service.GetNeighbors(ctx, id, 2, 1)
+		if err != nil {
+			fmt.Printf("获取 %s 附近玩家失败: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("%s 附近共 %d 名:\n", id, len(neighbors))
+		for _, p := range neighbors {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 TiebreakMode
+	fmt.Println("\n--- 测试 TiebreakMode (同分玩家 tieX 早提交, tieY 晚提交) ---")
+	tieTs := time.Now().Unix()
+	for _, mode := range []TiebreakMode{TiebreakEarliest, TiebreakLatest, TiebreakPlayerID} {
+		tieService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":tiebreak"), WithTiebreakMode(mode))
+		_ = tieService.ResetLeaderboard(ctx)
+		_ = tieService.SetScore(ctx, "tieY", 50, tieTs)
+		_ = tieService.SetScore(ctx, "tieX", 50, tieTs-60)
+		tieTop, err := tieService.GetTopN(ctx, 2)
+		if err != nil {
+			fmt.Printf("模式 %d 获取排行榜失败: %v\n", mode, err)
+			continue
+		}
+		for _, p := range tieTop {
+			fmt.Printf("模式 %d: 排名 %d, 玩家: %s, 时间戳: %d\n", mode, p.Rank, p.PlayerID, p.Timestamp)
+		}
+		_ = tieService.ResetLeaderboard(ctx)
+	}
+	fmt.Println("========================================")
+
+	// 测试 MetricsObserver
+	fmt.Println("\n--- 测试 MetricsObserver (打印每次操作的耗时和错误) ---")
+	observed := NewLeaderboardService(rdb, WithMetricsObserver(MetricsObserverFunc(func(op string, dur time.Duration, err error) {
+		fmt.Printf("op=%s dur=%v err=%v\n", op, dur.Round(time.Microsecond), err)
+	})))
+	_ = observed.UpdateScore(ctx, "playerA", 1, time.Now().Unix())
+	_, _ = observed.GetPlayerRank(ctx, "playerA")
+	_, _ = observed.GetPlayerRank(ctx, "nonexistent_player")
+	_, _ = observed.GetTopN(ctx, 0)
+	fmt.Println("========================================")
+
+	// 测试 GetBottomN
+	fmt.Println("\n--- 测试 GetBottomN (最后 3 名, Rank 为从榜首算起的实际排名) ---")
+	bottomPlayers, err := service.GetBottomN(ctx, 3)
+	if err != nil {
+		fmt.Printf("获取末尾玩家失败: %v\n", err)
+	} else {
+		for _, p := range bottomPlayers {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 ShardedLeaderboard
+	fmt.Println("\n--- 测试 ShardedLeaderboard (4 个分片, 全局排名与 k 路归并) ---")
+	sharded := NewShardedLeaderboard(rdb, 4, WithKey(leaderboardKey+":sharded"))
+	_ = sharded.ResetLeaderboard(ctx)
+	shardTs := time.Now().Unix()
+	for i, score := range []int64{70, 95, 88, 95, 60, 100, 82, 77} {
+		_ = sharded.UpdateScore(ctx, fmt.Sprintf("shardPlayer%d", i), score, shardTs-int64(i))
+	}
+	shardTop, err := sharded.GetTopN(ctx, 5)
+	if err != nil {
+		fmt.Printf("获取分片排行榜失败: %v\n", err)
+	} else {
+		for _, p := range shardTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	if info, err := sharded.GetPlayerRank(ctx, "shardPlayer3"); err == nil {
+		fmt.Printf("shardPlayer3 全局排名: %d, 分数: %d\n", info.Rank, info.Score)
+	}
+	shardCount, _ := sharded.GetPlayerCount(ctx)
+	fmt.Printf("分片玩家总数: %d\n", shardCount)
+	_ = sharded.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankApprox
+	fmt.Println("\n--- 测试 GetPlayerRankApprox (桶宽 10, 误差不超过所在桶人数的一半) ---")
+	approxService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":approx"), WithApproxRank(10))
+	_ = approxService.ResetLeaderboard(ctx)
+	approxTs := time.Now().Unix()
+	for i := 0; i < 200; i++ {
+		_ = approxService.UpdateScore(ctx, fmt.Sprintf("approx%03d", i), int64(i*37%500)-100, approxTs-int64(i))
+	}
+	_ = approxService.SetScore(ctx, "approx000", 450, approxTs)
+	_, _ = approxService.DeletePlayer(ctx, "approx001")
+	withinBound := true
+	for _, id := range []string{"approx000", "approx050", "approx123", "approx199"} {
+		exact, err := approxService.GetPlayerRank(ctx, id)
+		if err != nil {
+			fmt.Printf("查询 %s 精确排名失败: %v\n", id, err)
+			continue
+		}
+		approx, err := approxService.GetPlayerRankApprox(ctx, id)
+		if err != nil {
+			fmt.Printf("查询 %s 近似排名失败: %v\n", id, err)
+			continue
+		}
+		bucketLow := approxService.bucketOf(exact.Score) * 10
+		sameBucket, _ := rdb.ZCount(ctx, leaderboardKey+":approx",
+			formatScore(float64(bucketLow)*scoreMultiplier), "("+formatScore(float64(bucketLow+10)*scoreMultiplier)).Result()
+		diff := approx - exact.Rank
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > sameBucket {
+			withinBound = false
+		}
+		fmt.Printf("%s: 分数 %d, 精确排名 %d, 近似排名 %d, 同桶人数 %d\n", id, exact.Score, exact.Rank, approx, sameBucket)
+	}
+	fmt.Printf("误差都在桶人数以内: %v\n", withinBound)
+	_ = approxService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 SetExpiry / WithWindowExpiry
+	fmt.Println("\n--- 测试 SetExpiry 和日榜自动过期 ---")
+	expiring := NewLeaderboardService(rdb, WithKey(leaderboardKey+":expiring"))
+	_ = expiring.ResetLeaderboard(ctx)
+	err = expiring.SetExpiry(ctx, time.Minute)
+	fmt.Printf("排行榜不存在时 SetExpiry: ErrLeaderboardKeyMissing=%v\n", errors.Is(err, ErrLeaderboardKeyMissing))
+	_ = expiring.UpdateScore(ctx, "playerA", 10, time.Now().Unix())
+	fmt.Printf("SetExpiry(1m): err=%v, TTL=%v\n", expiring.SetExpiry(ctx, time.Minute), rdb.TTL(ctx, expiring.key()).Val())
+	_ = expiring.ResetLeaderboard(ctx)
+	_ = expiring.UpdateScore(ctx, "playerA", 10, time.Now().Unix())
+	fmt.Printf("重新创建后的 TTL (-1 表示不过期): %v\n", rdb.TTL(ctx, expiring.key()).Val())
+	_ = expiring.ResetLeaderboard(ctx)
+
+	dailyExpiring := NewLeaderboardService(rdb, WithKey(leaderboardKey+":expiring"), WithWindow(WindowDaily), WithWindowExpiry(time.Hour))
+	_ = dailyExpiring.UpdateScore(ctx, "playerA", 10, time.Now().Unix())
+	fmt.Printf("日榜 %s 的 TTL: %v\n", dailyExpiring.key(), rdb.TTL(ctx, dailyExpiring.key()).Val().Round(time.Minute))
+	_ = dailyExpiring.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayersAtScore
+	fmt.Println("\n--- 测试 GetPlayersAtScore (列出与榜首同分的所有玩家) ---")
+	if leader, err := service.GetTopN(ctx, 1); err == nil && len(leader) > 0 {
+		tied, err := service.GetPlayersAtScore(ctx, leader[0].Score)
+		if err != nil {
+			fmt.Printf("查询同分玩家失败: %v\n", err)
+		}
+		for _, p := range tied {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 时间戳: %d\n", p.Rank, p.PlayerID, p.Score, p.Timestamp)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 UpdateScoreCreated
+	fmt.Println("\n--- 测试 UpdateScoreCreated (新玩家为 true, 再次更新为 false) ---")
+	_, _ = service.DeletePlayer(ctx, "newcomer")
+	for i := 0; i < 2; i++ {
+		created, err := service.UpdateScoreCreated(ctx, "newcomer", 5, time.Now().Unix())
+		fmt.Printf("第 %d 次更新: created=%v, err=%v\n", i+1, created, err)
+	}
+	fmt.Println("========================================")
+
+	// 测试 MergePlayers
+	fmt.Println("\n--- 测试 MergePlayers (mergeSrc 的分数并入 mergeDst, 保留更早的时间戳) ---")
+	mergeTs := time.Now().Unix()
+	_ = service.SetScore(ctx, "mergeSrc", 30, mergeTs-500)
+	_ = service.SetScore(ctx, "mergeDst", 40, mergeTs)
+	fmt.Printf("MergePlayers: err=%v\n", service.MergePlayers(ctx, "mergeSrc", "mergeDst"))
+	if info, err := service.GetPlayerRank(ctx, "mergeDst"); err == nil {
+		fmt.Printf("mergeDst: 分数 %d, 时间戳 %d (源玩家时间戳 %d)\n", info.Score, info.Timestamp, mergeTs-500)
+	}
+	_, err = service.GetPlayerRank(ctx, "mergeSrc")
+	fmt.Printf("mergeSrc 已删除: %v\n", errors.Is(err, ErrPlayerNotFound))
+	err = service.MergePlayers(ctx, "mergeSrc", "mergeDst")
+	fmt.Printf("再次合并: ErrPlayerNotFound=%v\n", errors.Is(err, ErrPlayerNotFound))
+	fmt.Println("========================================")
+
+	// 测试 WithScoreBounds
+	fmt.Println("\n--- 测试 WithScoreBounds (分数限制在 [0, 1000], 超出时截断) ---")
+	bounded := NewLeaderboardService(rdb, WithKey(leaderboardKey+":bounded"), WithScoreBounds(0, 1000))
+	_ = bounded.ResetLeaderboard(ctx)
+	clamped, err := bounded.UpdateScoreClamped(ctx, "boundedA", -50, time.Now().Unix())
+	fmt.Printf("从 0 扣 50 分: clamped=%v, err=%v\n", clamped, err)
+	clamped, err = bounded.SetScoreClamped(ctx, "boundedB", 5000, time.Now().Unix())
+	fmt.Printf("设置 5000 分: clamped=%v, err=%v\n", clamped, err)
+	clamped, err = bounded.UpdateScoreClamped(ctx, "boundedB", -10, time.Now().Unix())
+	fmt.Printf("再扣 10 分: clamped=%v, err=%v\n", clamped, err)
+	for _, id := range []string{"boundedA", "boundedB"} {
+		if info, err := bounded.GetPlayerRank(ctx, id); err == nil {
+			fmt.Printf("%s: 分数 %d\n", id, info.Score)
+		}
+	}
+	_ = bounded.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试毫秒级时间戳
+	fmt.Println("\n--- 测试 WithTimestampUnit(TimestampMilliseconds) (同分时相差 1 毫秒也能区分先后) ---")
+	msService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":ms"), WithTimestampUnit(TimestampMilliseconds))
+	_ = msService.ResetLeaderboard(ctx)
+	nowMs := time.Now().UnixMilli()
+	_ = msService.UpdateScore(ctx, "msLate", 100, nowMs)
+	_ = msService.UpdateScore(ctx, "msEarly", 100, nowMs-1)
+	if msTop, err := msService.GetTopN(ctx, 2); err == nil {
+		for _, p := range msTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 时间戳: %d\n", p.Rank, p.PlayerID, p.Score, p.Timestamp)
+		}
+	}
+	err = service.UpdateScore(ctx, "msOnSecondsBoard", 1, nowMs)
+	fmt.Printf("秒级排行榜传入毫秒时间戳: ErrTimestampOutOfRange=%v\n", errors.Is(err, ErrTimestampOutOfRange))
+	_ = msService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetTopNEnriched
+	fmt.Println("\n--- 测试 GetTopNEnriched (附带昵称和头像, 缺失字段被省略) ---")
+	if leader, err := service.GetTopN(ctx, 1); err == nil && len(leader) > 0 {
+		_ = service.SetPlayerMetadata(ctx, leader[0].PlayerID, map[string]string{"name": "冠军", "avatar": "crown.png"})
+	}
+	enrichedTop, err := service.GetTopNEnriched(ctx, 3, []string{"name", "avatar"})
+	if err != nil {
+		fmt.Printf("获取带元数据的排行榜失败: %v\n", err)
+	} else {
+		for _, p := range enrichedTop {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 元数据: %v\n", p.Rank, p.PlayerID, p.Score, p.Metadata)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 WithRankCrossing
+	fmt.Println("\n--- 测试 WithRankCrossing (进入或跌出前 2 名时回调) ---")
+	var crossingWG sync.WaitGroup
+	crossingService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":crossing"), WithRankCrossing(2, func(c RankCrossing) {
+		defer crossingWG.Done()
+		fmt.Printf("玩家 %s: %d -> %d, 进入前 %d 名=%v\n", c.PlayerID, c.OldRank, c.NewRank, c.Threshold, c.Entered)
+	}))
+	_ = crossingService.ResetLeaderboard(ctx)
+	crossTs := time.Now().Unix()
+	// crossA、crossB 初次上榜时各触发一次; crossC 排在第 3 名, 不触发
+	crossingWG.Add(2)
+	_ = crossingService.SetScore(ctx, "crossA", 100, crossTs)
+	_ = crossingService.SetScore(ctx, "crossB", 90, crossTs)
+	_ = crossingService.SetScore(ctx, "crossC", 80, crossTs)
+	crossingWG.Wait()
+	// crossC 进入前 2 名并把 crossB 挤出, 触发两次
+	crossingWG.Add(2)
+	_ = crossingService.UpdateScore(ctx, "crossC", 15, crossTs)
+	crossingWG.Wait()
+	_ = crossingService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 CountInScoreRange
+	fmt.Println("\n--- 测试 CountInScoreRange (分数在 [80, 100] 与 [80, 100) 内的人数) ---")
+	for _, inclusive := range []bool{true, false} {
+		count, err := service.CountInScoreRange(ctx, 80, 100, inclusive)
+		fmt.Printf("inclusiveMax=%v: %d 人, err=%v\n", inclusive, count, err)
+	}
+	fmt.Println("========================================")
+
+	// 测试 WithIDCodec
+	fmt.Println("\n--- 测试 WithIDCodec (UUID 以 16 字节存储) ---")
+	uuidService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":uuid"), WithIDCodec(UUIDCodec{}))
+	_ = uuidService.ResetLeaderboard(ctx)
+	uuidPlayer := "3f2504e0-4f89-41d3-9a0c-0305e82c3301"
+	_ = uuidService.SetScore(ctx, uuidPlayer, 42, time.Now().Unix())
+	if top, err := uuidService.GetTopN(ctx, 1); err == nil && len(top) == 1 {
+		fmt.Printf("读回的玩家 ID: %s, 与写入一致=%v\n", top[0].PlayerID, top[0].PlayerID == uuidPlayer)
+	}
+	members, _ := rdb.ZRange(ctx, leaderboardKey+":uuid", 0, -1).Result()
+	for _, m := range members {
+		fmt.Printf("Redis 中的成员长度: %d 字节\n", len(m))
+	}
+	err = uuidService.SetScore(ctx, "not-a-uuid", 1, time.Now().Unix())
+	fmt.Printf("写入非 UUID 的 ID: errors.Is(ErrInvalidPlayerID)=%v\n", errors.Is(err, ErrInvalidPlayerID))
+	_ = uuidService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 Close
+	fmt.Println("\n--- 测试 Close (只关闭服务自己创建的客户端) ---")
+	fmt.Printf("注入客户端的服务 Close: err=%v, 共享客户端仍可用=%v\n", service.Close(), rdb.Ping(ctx).Err() == nil)
+	ownedService := NewLeaderboardServiceFromOptions(&redis.Options{Addr: "localhost:6379"}, WithKey(leaderboardKey+":owned"))
+	fmt.Printf("自建客户端的服务 Close: err=%v\n", ownedService.Close())
+	_, err = ownedService.GetPlayerCount(ctx)
+	fmt.Printf("关闭后继续使用: errors.Is(redis.ErrClosed)=%v\n", errors.Is(err, redis.ErrClosed))
+	fmt.Println("========================================")
+
+	// 测试 GetByScoreRange
+	fmt.Println("\n--- 测试 GetByScoreRange (分数在 [80, 100] 内的玩家及其全局排名) ---")
+	scoreWindow, err := service.GetByScoreRange(ctx, 80, 100)
+	if err != nil {
+		fmt.Printf("按分数区间查询失败: %v\n", err)
+	} else {
+		for _, p := range scoreWindow {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 UpdateMetrics 和 RecomputeAll
+	fmt.Println("\n--- 测试 UpdateMetrics (击杀 x10 + 助攻 x5, 之后改为击杀 x1 + 助攻 x20 并重算) ---")
+	metricsService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":weighted"),
+		WithMetricWeights(map[string]int64{"kills": 10, "assists": 5}))
+	_ = metricsService.ResetLeaderboard(ctx)
+	metricsTs := time.Now().Unix()
+	_ = metricsService.UpdateMetrics(ctx, "fragger", map[string]int64{"kills": 8, "assists": 1}, metricsTs)
+	_ = metricsService.UpdateMetrics(ctx, "support", map[string]int64{"kills": 2, "assists": 6}, metricsTs)
+	_ = metricsService.UpdateMetrics(ctx, "support", map[string]int64{"assists": 2}, metricsTs)
+	printWeighted := func() {
+		top, _ := metricsService.GetTopN(ctx, 2)
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	printWeighted()
+	metricsService.SetMetricWeights(map[string]int64{"kills": 1, "assists": 20})
+	if err := metricsService.RecomputeAll(ctx); err != nil {
+		fmt.Printf("重算失败: %v\n", err)
+	}
+	printWeighted()
+	for _, playerID := range []string{"fragger", "support"} {
+		_, _ = metricsService.DeletePlayer(ctx, playerID)
+	}
+	fmt.Println("========================================")
+
+	// 测试 ValidateConfig
+	fmt.Println("\n--- 测试 ValidateConfig (默认配置与错误配置) ---")
+	fmt.Printf("默认配置: err=%v\n", service.ValidateConfig())
+	err = NewLeaderboardService(rdb, WithScoreBounds(100, 10), WithTiebreakMode(TiebreakMode(9))).ValidateConfig()
+	fmt.Printf("空分数区间 + 未知同分规则: errors.Is(ErrInvalidConfig)=%v\n%v\n", errors.Is(err, ErrInvalidConfig), err)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankRange 的窗口平移
+	fmt.Println("\n--- 测试 GetPlayerRankRange (6 名玩家, 窗口 4 名, 分别查询第 1 名、第 2 名和最后一名) ---")
+	rangeService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":range"))
+	_ = rangeService.ResetLeaderboard(ctx)
+	for i := 1; i <= 6; i++ {
+		_ = rangeService.SetScore(ctx, fmt.Sprintf("range%d", i), int64(100-i), time.Now().Unix())
+	}
+	// 期望: range1 -> 1..4, range2 -> 1..4, range6 -> 3..6
+	for _, playerID := range []string{"range1", "range2", "range6"} {
+		window, err := rangeService.GetPlayerRankRange(ctx, playerID, 4)
+		if err != nil {
+			fmt.Printf("查询 %s 周边玩家失败: %v\n", playerID, err)
+			continue
+		}
+		ranks := make([]int64, len(window))
+		for i, p := range window {
+			ranks[i] = p.Rank
+		}
+		fmt.Printf("%s 的窗口排名: %v\n", playerID, ranks)
+	}
+	_ = rangeService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WithReadClient
+	fmt.Println("\n--- 测试 WithReadClient (本地没有副本, 用另一个连接模拟只读副本) ---")
+	replicaClient := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	replicaService := NewLeaderboardService(rdb, WithReadClient(replicaClient))
+	if top, err := replicaService.GetTopN(ctx, 3); err != nil {
+		fmt.Printf("通过只读连接获取排行榜失败: %v\n", err)
+	} else {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	_ = replicaClient.Close()
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankAllWindows
+	fmt.Println("\n--- 测试 GetPlayerRankAllWindows (playerD 在各窗口中的排名) ---")
+	allWindowRanks, err := service.GetPlayerRankAllWindows(ctx, "playerD", time.Now())
+	if err != nil {
+		fmt.Printf("查询各窗口排名失败: %v\n", err)
+	} else {
+		for _, window := range []WindowType{WindowAllTime, WindowDaily, WindowWeekly, WindowMonthly} {
+			if info := allWindowRanks[window]; info.Found {
+				fmt.Printf("%s: 排名=%d, 分数=%d\n", window, info.Rank, info.Score)
+			} else {
+				fmt.Printf("%s: 不在榜上\n", window)
+			}
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 RecordBest
+	fmt.Println("\n--- 测试 RecordBest (只记录更好的成绩) ---")
+	bestService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":best"))
+	_ = bestService.ResetLeaderboard(ctx)
+	bestTs := time.Now().Unix()
+	for _, submission := range []int64{50, 40, 50, 70} {
+		written, err := bestService.RecordBest(ctx, "bestPlayer", submission, bestTs)
+		best := int64(0)
+		if info, err := bestService.GetPlayerRank(ctx, "bestPlayer"); err == nil {
+			best = info.Score
+		}
+		fmt.Printf("提交 %d: 写入=%v, err=%v, 当前最佳=%d\n", submission, written, err, best)
+		bestTs++
+	}
+	_ = bestService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试非有限的组合分数
+	fmt.Println("\n--- 测试非有限的组合分数 (手动写入 +Inf) ---")
+	infService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":inf"))
+	_ = infService.ResetLeaderboard(ctx)
+	rdb.ZAdd(ctx, leaderboardKey+":inf", redis.Z{Score: math.Inf(1), Member: "corrupted"})
+	_, err = infService.GetTopN(ctx, 10)
+	fmt.Printf("GetTopN: errors.Is(ErrNonFiniteScore)=%v, err=%v\n", errors.Is(err, ErrNonFiniteScore), err)
+	_, err = infService.GetPlayerRank(ctx, "corrupted")
+	fmt.Printf("GetPlayerRank: errors.Is(ErrNonFiniteScore)=%v, err=%v\n", errors.Is(err, ErrNonFiniteScore), err)
+	_ = infService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 Migrate
+	fmt.Println("\n--- 测试 Migrate (从 multiplier=1e10、maxTs=1e10 的旧编码迁移) ---")
+	migrateKey := leaderboardKey + ":migrate"
+	migrateService := NewLeaderboardService(rdb, WithKey(migrateKey))
+	_ = migrateService.ResetLeaderboard(ctx)
+	rdb.Del(ctx, migrateKey+":migrate:state")
+	migrateTs := time.Now().Unix()
+	for i, name := range []string{"oldA", "oldB", "oldC"} {
+		score := int64(300 - 100*i)
+		rdb.ZAdd(ctx, migrateKey, redis.Z{Score: float64(score)*1e10 + 1e10 - float64(migrateTs), Member: name})
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		err := migrateService.Migrate(ctx, 1e10, 1e10)
+		fmt.Printf("第 %d 次迁移: err=%v\n", attempt, err)
+	}
+	if top, err := migrateService.GetTopN(ctx, 3); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 时间戳一致=%v\n", p.Rank, p.PlayerID, p.Score, p.Timestamp == migrateTs)
+		}
+	}
+	_ = migrateService.ResetLeaderboard(ctx)
+	rdb.Del(ctx, migrateKey+":migrate:state")
+	fmt.Println("========================================")
+
+	// 测试 GetTopNSince
+	fmt.Println("\n--- 测试 GetTopNSince (只统计最近 60 秒内提交过的玩家) ---")
+	sinceService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":since"))
+	_ = sinceService.ResetLeaderboard(ctx)
+	sinceNow := time.Now().Unix()
+	_ = sinceService.SetScore(ctx, "veteran", 500, sinceNow-3600)
+	_ = sinceService.SetScore(ctx, "riser", 300, sinceNow-10)
+	_ = sinceService.SetScore(ctx, "newbie", 100, sinceNow)
+	if recent, err := sinceService.GetTopNSince(ctx, 2, sinceNow-60); err != nil {
+		fmt.Printf("获取近期活跃榜失败: %v\n", err)
+	} else {
+		for _, p := range recent {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	_ = sinceService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WithLogger
+	fmt.Println("\n--- 测试 WithLogger (用 log/slog 适配 Logger, 查询不存在的玩家) ---")
+	slogger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	loggedService := NewLeaderboardService(rdb, WithLogger(slogLogger{slogger}), WithSlowOpThreshold(time.Nanosecond))
+	_, _ = loggedService.GetPlayerRank(ctx, "nobody")
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerStats
+	fmt.Println("\n--- 测试 GetPlayerStats (两名玩家同分时密集排名相同) ---")
+	statsService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":stats"))
+	_ = statsService.ResetLeaderboard(ctx)
+	statsNow := time.Now().Unix()
+	_ = statsService.SetScore(ctx, "gold", 300, statsNow-2)
+	_ = statsService.SetScore(ctx, "silverA", 200, statsNow-1)
+	_ = statsService.SetScore(ctx, "silverB", 200, statsNow)
+	_ = statsService.SetScore(ctx, "bronze", 100, statsNow)
+	for _, playerID := range []string{"gold", "silverB", "bronze", "nobody"} {
+		stats, err := statsService.GetPlayerStats(ctx, playerID)
+		if err != nil {
+			fmt.Printf("查询玩家 %s 统计失败: %v\n", playerID, err)
+			continue
+		}
+		fmt.Printf("玩家: %s, 排名: %d, 密集排名: %d, 分数: %d, 百分位: %.2f, 总人数: %d\n",
+			stats.PlayerID, stats.Rank, stats.DenseRank, stats.Score, stats.Percentile, stats.Total)
+	}
+	_ = statsService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 UpdateScoreWithOpts
+	fmt.Println("\n--- 测试 UpdateScoreWithOpts (NX / GT / XX+Incr / 互斥选项) ---")
+	optsService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":opts"))
+	_ = optsService.ResetLeaderboard(ctx)
+	optsNow := time.Now().Unix()
+	for _, step := range []struct {
+		name  string
+		score int64
+		opts  UpdateOpts
+	}{
+		{"NX 新建 100", 100, UpdateOpts{NX: true}},
+		{"NX 再写 200", 200, UpdateOpts{NX: true}},
+		{"GT 写 50", 50, UpdateOpts{GT: true}},
+		{"GT 写 150", 150, UpdateOpts{GT: true}},
+		{"XX 增加 25", 25, UpdateOpts{XX: true, Incr: true}},
+		{"NX+GT", 10, UpdateOpts{NX: true, GT: true}},
+	} {
+		changed, err := optsService.UpdateScoreWithOpts(ctx, "optsPlayer", step.score, optsNow, step.opts)
+		fmt.Printf("%s: changed=%v, err=%v\n", step.name, changed, err)
+	}
+	if info, err := optsService.GetPlayerRank(ctx, "optsPlayer"); err == nil {
+		fmt.Printf("最终分数: %d\n", info.Score)
+	}
+	_ = optsService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRangeWindow
+	fmt.Println("\n--- 测试 GetPlayerRangeWindow (玩家 playerA 前后共 3 名) ---")
+	if window, err := service.GetPlayerRangeWindow(ctx, "playerA", 3); err != nil {
+		fmt.Printf("获取排名窗口失败: %v\n", err)
+	} else {
+		fmt.Printf("名次 %d-%d, 上方还有玩家=%v, 下方还有玩家=%v\n", window.StartRank, window.EndRank, window.HasAbove, window.HasBelow)
+		for _, p := range window.Entries {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 WithScoreHistory
+	fmt.Println("\n--- 测试 WithScoreHistory (保留最近 3 条, 写入 4 次) ---")
+	historyService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":history"), WithScoreHistory(3))
+	_ = historyService.ResetLeaderboard(ctx)
+	historyNow := time.Now().Unix()
+	for i, incr := range []int64{10, 20, 30, 40} {
+		_ = historyService.UpdateScore(ctx, "climber", incr, historyNow+int64(i))
+	}
+	if points, err := historyService.GetPlayerHistory(ctx, "climber", 10); err != nil {
+		fmt.Printf("获取分数历史失败: %v\n", err)
+	} else {
+		for _, p := range points {
+			fmt.Printf("分数: %d, 时间戳: %d\n", p.Score, p.Timestamp)
+		}
+	}
+	_, _ = historyService.DeletePlayer(ctx, "climber")
+	fmt.Println("========================================")
+
+	// 测试 DeletePlayers
+	fmt.Println("\n--- 测试 DeletePlayers (删除 3 名玩家, 其中 1 名不存在) ---")
+	bulkService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":bulk"))
+	_ = bulkService.ResetLeaderboard(ctx)
+	bulkNow := time.Now().Unix()
+	for i, playerID := range []string{"gdpr1", "gdpr2", "keeper"} {
+		_ = bulkService.SetScore(ctx, playerID, int64(100*(i+1)), bulkNow)
+	}
+	_ = bulkService.SetPlayerMetadata(ctx, "gdpr1", map[string]string{"name": "Alice"})
+	removedCount, err := bulkService.DeletePlayers(ctx, []string{"gdpr1", "gdpr2", "ghost"})
+	remaining, _ := bulkService.GetPlayerCount(ctx)
+	fmt.Printf("删除了 %d 名玩家 (err=%v), 剩余 %d 名\n", removedCount, err, remaining)
+	_ = bulkService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetRankForScore
+	fmt.Println("\n--- 测试 GetRankForScore (预览分数上榜后的名次) ---")
+	for _, score := range []int64{1000000, 150, -1000} {
+		rank, err := service.GetRankForScore(ctx, score)
+		if err != nil {
+			fmt.Printf("预览分数 %d 的名次失败: %v\n", score, err)
+		} else {
+			fmt.Printf("分数 %d 上榜后的名次: %d\n", score, rank)
+		}
+	}
+	emptyRank, err := NewLeaderboardService(rdb, WithKey(leaderboardKey+":empty")).GetRankForScore(ctx, 0)
+	fmt.Printf("空排行榜上的名次: %d (err=%v)\n", emptyRank, err)
+	fmt.Println("========================================")
+
+	// 测试 WithServerTimestamps
+	fmt.Println("\n--- 测试 WithServerTimestamps (时间戳传 0 时使用 Redis 服务器时间) ---")
+	serverTimeService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":servertime"), WithServerTimestamps())
+	_ = serverTimeService.ResetLeaderboard(ctx)
+	_ = serverTimeService.UpdateScore(ctx, "clockless", 100, 0)
+	if info, err := serverTimeService.GetPlayerRank(ctx, "clockless"); err != nil {
+		fmt.Printf("查询玩家排名失败: %v\n", err)
+	} else {
+		serverNow, _ := rdb.Time(ctx).Result()
+		fmt.Printf("分数: %d, 时间戳与服务器时间相差 %d 秒\n", info.Score, serverNow.Unix()-info.Timestamp)
+	}
+	_ = serverTimeService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WithTopNCache
+	fmt.Println("\n--- 测试 WithTopNCache (窗口内玩家的写入使缓存失效) ---")
+	cachedService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":cached"), WithTopNCache(time.Minute))
+	_ = cachedService.ResetLeaderboard(ctx)
+	cacheNow := time.Now().Unix()
+	_ = cachedService.SetScore(ctx, "cacheA", 300, cacheNow)
+	_ = cachedService.SetScore(ctx, "cacheB", 200, cacheNow)
+	_, _ = cachedService.GetTopN(ctx, 2)
+	// 绕过服务直接修改 Redis, 缓存命中时看不到这次修改
+	rdb.ZAdd(ctx, leaderboardKey+":cached", redis.Z{Score: cachedService.combineScore(999, cacheNow), Member: "cacheB"})
+	if top, err := cachedService.GetTopN(ctx, 2); err == nil {
+		fmt.Printf("缓存命中: 第 1 名 %s (%d)\n", top[0].PlayerID, top[0].Score)
+	}
+	_ = cachedService.UpdateScore(ctx, "cacheA", 1, cacheNow)
+	if top, err := cachedService.GetTopN(ctx, 2); err == nil {
+		fmt.Printf("失效后重新读取: 第 1 名 %s (%d)\n", top[0].PlayerID, top[0].Score)
+	}
+	_ = cachedService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetDistinctScoreCount
+	fmt.Println("\n--- 测试 GetDistinctScoreCount (4 名玩家, 3 个分数档位) ---")
+	tierService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":tiers"))
+	_ = tierService.ResetLeaderboard(ctx)
+	tierNow := time.Now().Unix()
+	for i, score := range []int64{500, 300, 300, 100} {
+		_ = tierService.SetScore(ctx, fmt.Sprintf("tier%d", i), score, tierNow-int64(i))
+	}
+	tiers, err := tierService.GetDistinctScoreCount(ctx)
+	fmt.Printf("分数档位数: %d (err=%v)\n", tiers, err)
+	_ = tierService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetRankRange
+	fmt.Println("\n--- 测试 GetRankRange (第 2-4 名 / 超出人数 / 非法区间) ---")
+	for _, r := range [][2]int64{{2, 4}, {1000, 1010}, {5, 3}} {
+		rankings, err := service.GetRankRange(ctx, r[0], r[1])
+		if err != nil {
+			fmt.Printf("获取第 %d-%d 名失败: %v\n", r[0], r[1], err)
+			continue
+		}
+		fmt.Printf("第 %d-%d 名共 %d 人\n", r[0], r[1], len(rankings))
+		for _, p := range rankings {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 WithTracer
+	fmt.Println("\n--- 测试 WithTracer (打印 span) ---")
+	tracedService := NewLeaderboardService(rdb, WithTracer(printTracer{}))
+	_, _ = tracedService.GetPlayerRank(ctx, "playerA")
+	_, _ = tracedService.GetTopN(ctx, 1)
+	fmt.Println("========================================")
+
+	// 测试 WithTiebreakKeys
+	fmt.Println("\n--- 测试 WithTiebreakKeys (同分时击杀数多者优先, 再按时间戳) ---")
+	killsService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":kills"), WithTiebreakKeys(TiebreakKey{Field: "kills"}))
+	_ = killsService.ResetLeaderboard(ctx)
+	killsNow := time.Now().Unix()
+	for i, p := range []struct {
+		id    string
+		score int64
+		kills int64
+	}{{"early", 100, 3}, {"late", 100, 9}, {"top", 200, 0}, {"low", 50, 99}} {
+		_ = killsService.SetScore(ctx, p.id, p.score, killsNow+int64(i))
+		_ = killsService.SetTiebreakValues(ctx, p.id, map[string]int64{"kills": p.kills})
+	}
+	if top, err := killsService.GetTopN(ctx, 2); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	if info, err := killsService.GetPlayerRank(ctx, "early"); err == nil {
+		fmt.Printf("玩家 early 的排名: %d\n", info.Rank)
+	}
+	_, _ = killsService.DeletePlayers(ctx, []string{"early", "late", "top", "low"})
+	fmt.Println("========================================")
+
+	// 测试 WithUpdateCoalescing
+	fmt.Println("\n--- 测试 WithUpdateCoalescing (1000 次 +1 合并写入) ---")
+	coalescedService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":coalesced"), WithUpdateCoalescing(time.Second))
+	_ = coalescedService.ResetLeaderboard(ctx)
+	coalesceNow := time.Now().Unix()
+	for i := 0; i < 1000; i++ {
+		_ = coalescedService.UpdateScore(ctx, "spammer", 1, coalesceNow)
+	}
+	flushErr := coalescedService.Flush(ctx)
+	if info, err := coalescedService.GetPlayerRank(ctx, "spammer"); err == nil {
+		fmt.Printf("Flush 后分数: %d (flush err=%v)\n", info.Score, flushErr)
+	}
+	fmt.Printf("Close: err=%v\n", coalescedService.Close())
+	_ = coalescedService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 ResetPlayerScore
+	fmt.Println("\n--- 测试 ResetPlayerScore (0 分排在正分之后、负分之前) ---")
+	resetService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":reset"))
+	_ = resetService.ResetLeaderboard(ctx)
+	resetNow := time.Now().Unix()
+	_ = resetService.SetScore(ctx, "positive", 1, resetNow)
+	_ = resetService.SetScore(ctx, "veteran", 500, resetNow)
+	_ = resetService.SetScore(ctx, "negative", -1, resetNow)
+	fmt.Printf("重置 veteran: err=%v\n", resetService.ResetPlayerScore(ctx, "veteran"))
+	fmt.Printf("重置不存在的玩家: err=%v\n", resetService.ResetPlayerScore(ctx, "nobody"))
+	if top, err := resetService.GetTopN(ctx, 3); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	_ = resetService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 UpdateScoreOnce
+	fmt.Println("\n--- 测试 UpdateScoreOnce (同一事件投递两次只生效一次) ---")
+	onceService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":once"), WithEventDedupeTTL(time.Minute))
+	_ = onceService.ResetLeaderboard(ctx)
+	onceNow := time.Now().Unix()
+	for i := 0; i < 2; i++ {
+		applied, err := onceService.UpdateScoreOnce(ctx, "retried", 10, onceNow, "evt-1")
+		fmt.Printf("第 %d 次投递 evt-1: applied=%v, err=%v\n", i+1, applied, err)
+	}
+	applied, err = onceService.UpdateScoreOnce(ctx, "retried", 5, onceNow+1, "evt-2")
+	fmt.Printf("投递 evt-2: applied=%v, err=%v\n", applied, err)
+	if info, err := onceService.GetPlayerRank(ctx, "retried"); err == nil {
+		fmt.Printf("最终分数: %d (期望 15)\n", info.Score)
+	}
+	_ = onceService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankRangeWithOptions
+	fmt.Println("\n--- 测试 GetPlayerRankRangeWithOptions (之前 3 名、之后 1 名, 不含自己) ---")
+	rangeOptsService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":rangeopts"))
+	_ = rangeOptsService.ResetLeaderboard(ctx)
+	rangeOptsNow := time.Now().Unix()
+	for i := 0; i < 10; i++ {
+		_ = rangeOptsService.SetScore(ctx, fmt.Sprintf("r%d", i), int64(100-i), rangeOptsNow)
+	}
+	if rankings, err := rangeOptsService.GetPlayerRankRangeWithOptions(ctx, "r5", RangeOptions{Above: 3, Below: 1}); err == nil {
+		for _, p := range rankings {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	} else {
+		fmt.Printf("查询失败: %v\n", err)
+	}
+	_ = rangeOptsService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 Shutdown
+	fmt.Println("\n--- 测试 Shutdown (Flush 合并中的更新后拒绝新的写入) ---")
+	shutdownService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":shutdown"), WithUpdateCoalescing(time.Minute))
+	_ = shutdownService.ResetLeaderboard(ctx)
+	_ = shutdownService.UpdateScore(ctx, "pending", 42, time.Now().Unix())
+	shutdownCtx, cancelShutdown := context.WithTimeout(ctx, 5*time.Second)
+	fmt.Printf("Shutdown: err=%v\n", shutdownService.Shutdown(shutdownCtx))
+	cancelShutdown()
+	if info, err := shutdownService.GetPlayerRank(ctx, "pending"); err == nil {
+		fmt.Printf("Shutdown 后分数: %d (期望 42)\n", info.Score)
+	}
+	err = shutdownService.UpdateScore(ctx, "pending", 1, time.Now().Unix())
+	fmt.Printf("Shutdown 后写入: errors.Is(ErrShuttingDown)=%v\n", errors.Is(err, ErrShuttingDown))
+	_ = shutdownService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GlobalTopN
+	fmt.Println("\n--- 测试 GlobalTopN (大小悬殊的两个地区合并前 3 名, 同分按时间戳) ---")
+	euService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":region:eu"))
+	usService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":region:us"))
+	_ = euService.ResetLeaderboard(ctx)
+	_ = usService.ResetLeaderboard(ctx)
+	regionNow := time.Now().Unix()
+	for i := 0; i < 50; i++ {
+		_ = euService.SetScore(ctx, fmt.Sprintf("eu%02d", i), int64(100+i), regionNow)
+	}
+	_ = usService.SetScore(ctx, "usEarly", 149, regionNow-10)
+	if top, err := euService.GlobalTopN(ctx, 3, []string{euService.key(), usService.key()}); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	} else {
+		fmt.Printf("合并失败: %v\n", err)
+	}
+	_ = euService.ResetLeaderboard(ctx)
+	_ = usService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 RankInfo 的 JSON 格式
+	fmt.Println("\n--- 测试 RankInfo 的 JSON 格式 (时间戳未知时省略, 编码后可还原) ---")
+	jsonService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":json"))
+	_ = jsonService.ResetLeaderboard(ctx)
+	_ = jsonService.SetScore(ctx, "shown", 0, time.Now().Unix())
+	for _, playerID := range []string{"shown", "missing"} {
+		info, _ := jsonService.GetPlayerRank(ctx, playerID)
+		data, _ := json.Marshal(info)
+		var decoded RankInfo
+		_ = json.Unmarshal(data, &decoded)
+		fmt.Printf("%s (还原相等=%v)\n", data, decoded == *info)
+	}
+	_ = jsonService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetGapToNextRank
+	fmt.Println("\n--- 测试 GetGapToNextRank (与前一名的分差) ---")
+	gapService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":gap"))
+	_ = gapService.ResetLeaderboard(ctx)
+	gapNow := time.Now().Unix()
+	_ = gapService.SetScore(ctx, "leader", 120, gapNow)
+	_ = gapService.SetScore(ctx, "chaser", 113, gapNow)
+	for _, playerID := range []string{"chaser", "leader"} {
+		gap, err := gapService.GetGapToNextRank(ctx, playerID)
+		switch {
+		case err != nil:
+			fmt.Printf("查询失败: %v\n", err)
+		case gap.AlreadyFirst:
+			fmt.Printf("%s 已经是第一名\n", playerID)
+		default:
+			fmt.Printf("%s 再得 %d 分以上即可超越 %s\n", playerID, gap.Gap, gap.Above.PlayerID)
+		}
+	}
+	_ = gapService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 ExportCompressed / ImportCompressed
+	fmt.Println("\n--- 测试 ExportCompressed / ImportCompressed (归档后导入到毫秒单位的排行榜) ---")
+	archiveService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":archive"))
+	_ = archiveService.ResetLeaderboard(ctx)
+	archiveNow := time.Now().Unix()
+	for i := 0; i < 5; i++ {
+		_ = archiveService.SetScore(ctx, fmt.Sprintf("season%d", i), int64(10*i), archiveNow+int64(i))
+	}
+	var archive bytes.Buffer
+	err = archiveService.ExportCompressed(ctx, &archive)
+	fmt.Printf("归档大小: %d 字节, err=%v\n", archive.Len(), err)
+	restored := NewLeaderboardService(rdb, WithKey(leaderboardKey+":archive:restored"), WithTimestampUnit(TimestampMilliseconds))
+	err = restored.ImportCompressed(ctx, &archive, ImportReplace)
+	fmt.Printf("导入: err=%v\n", err)
+	if top, err := restored.GetTopN(ctx, 2); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 分数: %d, 时间戳: %d\n", p.Rank, p.PlayerID, p.Score, p.Timestamp)
+		}
+	}
+	_ = archiveService.ResetLeaderboard(ctx)
+	_ = restored.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 BulkLoad
+	fmt.Println("\n--- 测试 BulkLoad (10000 名玩家, 每批 2000 条) ---")
+	seedService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":bulk"))
+	_ = seedService.ResetLeaderboard(ctx)
+	seedNow := time.Now().Unix()
+	seedEntries := make([]ScoreUpdate, 10000)
+	for i := range seedEntries {
+		seedEntries[i] = ScoreUpdate{PlayerID: fmt.Sprintf("seed%05d", i), IncrScore: int64(i % 500), Timestamp: seedNow}
+	}
+	seedStart := time.Now()
+	err = seedService.BulkLoad(ctx, seedEntries, 2000, func(done, total int) {
+		fmt.Printf("进度: %d/%d\n", done, total)
+	})
+	seedCount, _ := seedService.GetPlayerCount(ctx)
+	fmt.Printf("BulkLoad: err=%v, 人数=%d, 耗时=%v\n", err, seedCount, time.Since(seedStart))
+	_ = seedService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WithPlayerRankCache
+	fmt.Println("\n--- 测试 WithPlayerRankCache (他人写入在 ttl 内不可见, 自己的写入立即可见) ---")
+	profileService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":profile"), WithPlayerRankCache(time.Minute))
+	_ = profileService.ResetLeaderboard(ctx)
+	profileNow := time.Now().Unix()
+	_ = profileService.SetScore(ctx, "visitor", 10, profileNow)
+	if info, err := profileService.GetPlayerRank(ctx, "visitor"); err == nil {
+		fmt.Printf("首次查询: 排名 %d\n", info.Rank)
+	}
+	_ = profileService.SetScore(ctx, "rival", 20, profileNow)
+	if info, err := profileService.GetPlayerRank(ctx, "visitor"); err == nil {
+		fmt.Printf("rival 上榜后 (缓存): 排名 %d\n", info.Rank)
+	}
+	_ = profileService.UpdateScore(ctx, "visitor", 1, profileNow)
+	if info, err := profileService.GetPlayerRank(ctx, "visitor"); err == nil {
+		fmt.Printf("自己加分后: 排名 %d, 分数 %d\n", info.Rank, info.Score)
+	}
+	_ = profileService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetTieGroups
+	fmt.Println("\n--- 测试 GetTieGroups (前 2 个分数组) ---")
+	tieGroupService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":tiegroups"))
+	_ = tieGroupService.ResetLeaderboard(ctx)
+	tieGroupNow := time.Now().Unix()
+	for i, score := range []int64{90, 100, 90, 80, 100, 90} {
+		_ = tieGroupService.SetScore(ctx, fmt.Sprintf("tg%d", i), score, tieGroupNow+int64(i))
+	}
+	if groups, err := tieGroupService.GetTieGroups(ctx, 2); err == nil {
+		for _, g := range groups {
+			fmt.Printf("分数 %d: %d 人 %v\n", g.Score, g.Count, g.PlayerIDs)
+		}
+	} else {
+		fmt.Printf("查询失败: %v\n", err)
+	}
+	_ = tieGroupService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 VersionedLeaderboard
+	fmt.Println("\n--- 测试 VersionedLeaderboard (新版本 10 分排在旧版本 1000 分之前) ---")
+	versioned := NewVersionedLeaderboard(rdb, WithKey(leaderboardKey+":versioned"))
+	_ = versioned.ResetLeaderboard(ctx)
+	versionNow := time.Now().Unix()
+	_, _ = versioned.SetScore(ctx, "veteran", 1, 1000, versionNow)
+	_, _ = versioned.SetScore(ctx, "legacy", 1, 500, versionNow)
+	_, _ = versioned.SetScore(ctx, "patched", 2, 10, versionNow)
+	// veteran 在 2 版本重新开始, 旧版本的 1000 分被丢弃
+	_, _ = versioned.UpdateScore(ctx, "veteran", 2, 5, versionNow)
+	applied, err = versioned.UpdateScore(ctx, "veteran", 1, 100, versionNow)
+	fmt.Printf("以旧版本写入: applied=%v, err=%v\n", applied, err)
+	if top, err := versioned.GetTopN(ctx, 10); err == nil {
+		for _, p := range top {
+			fmt.Printf("排名: %d, 玩家: %s, 版本: %d, 分数: %d\n", p.Rank, p.PlayerID, p.Version, p.Score)
+		}
+	}
+	if info, err := versioned.GetPlayerRank(ctx, "legacy"); err == nil {
+		fmt.Printf("legacy 的全局排名: %d\n", info.Rank)
+	}
+	_ = versioned.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WriteTopNCSV
+	fmt.Println("\n--- 测试 WriteTopNCSV (玩家 ID 含逗号和引号) ---")
+	csvService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":csv"))
+	_ = csvService.ResetLeaderboard(ctx)
+	csvNow := time.Now().Unix()
+	_ = csvService.SetScore(ctx, "plain", 30, csvNow)
+	_ = csvService.SetScore(ctx, "Smith, John", 20, csvNow)
+	_ = csvService.SetScore(ctx, `say "hi"`, 10, csvNow)
+	if err := csvService.WriteTopNCSV(ctx, os.Stdout, 3); err != nil {
+		fmt.Printf("导出失败: %v\n", err)
+	}
+	_ = csvService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 Freeze / Unfreeze
+	fmt.Println("\n--- 测试 Freeze / Unfreeze (两个实例共享冻结标志) ---")
+	freezeA := NewLeaderboardService(rdb, WithKey(leaderboardKey+":freeze"), WithSharedFreeze())
+	freezeB := NewLeaderboardService(rdb, WithKey(leaderboardKey+":freeze"), WithSharedFreeze())
+	_ = freezeA.ResetLeaderboard(ctx)
+	freezeNow := time.Now().Unix()
+	_ = freezeA.SetScore(ctx, "final", 100, freezeNow)
+	fmt.Printf("实例 A 冻结: err=%v\n", freezeA.Freeze(ctx))
+	err = freezeB.UpdateScore(ctx, "final", 1, freezeNow)
+	fmt.Printf("实例 B 写入: errors.Is(ErrLeaderboardFrozen)=%v\n", errors.Is(err, ErrLeaderboardFrozen))
+	if info, err := freezeB.GetPlayerRank(ctx, "final"); err == nil {
+		fmt.Printf("冻结期间读取: 分数 %d\n", info.Score)
+	}
+	_ = freezeB.Unfreeze(ctx)
+	fmt.Printf("解冻后实例 A 写入: err=%v\n", freezeA.UpdateScore(ctx, "final", 1, freezeNow))
+	_ = freezeA.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankRange 查询最后一名
+	fmt.Println("\n--- 测试 GetPlayerRankRange (最后一名, nRange=3, 名次连续且不超过总人数) ---")
+	bottomService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":bottom"))
+	_ = bottomService.ResetLeaderboard(ctx)
+	bottomNow := time.Now().Unix()
+	for i := 0; i < 5; i++ {
+		_ = bottomService.SetScore(ctx, fmt.Sprintf("b%d", i), int64(50-i), bottomNow)
+	}
+	bottomTotal, _ := bottomService.GetPlayerCount(ctx)
+	for _, nRange := range []int64{3, 10} {
+		rankings, err := bottomService.GetPlayerRankRange(ctx, "b4", nRange)
+		if err != nil {
+			fmt.Printf("查询失败: %v\n", err)
+			continue
+		}
+		contiguous := true
+		for i, p := range rankings {
+			if p.Rank > bottomTotal || (i > 0 && p.Rank != rankings[i-1].Rank+1) {
+				contiguous = false
+			}
+		}
+		last := rankings[len(rankings)-1]
+		fmt.Printf("nRange=%d: %d 条, 最后一条 %s 排名 %d/%d, 连续且无多余条目=%v\n",
+			nRange, len(rankings), last.PlayerID, last.Rank, bottomTotal, contiguous && last.PlayerID == "b4")
+	}
+	_ = bottomService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试内存 RankStore 的 ZCount
+	fmt.Println("\n--- 测试 GetRankForScore (内存 RankStore 与 Redis 结果一致) ---")
+	countStoreService := NewLeaderboardServiceWithStore(memstore.New(int64(scoreMultiplier)))
+	countRedisService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":count"))
+	_ = countRedisService.ResetLeaderboard(ctx)
+	countNow := time.Now().Unix()
+	for i, score := range []int64{10, 20, 20, 30} {
+		_ = countStoreService.SetScore(ctx, fmt.Sprintf("c%d", i), score, countNow)
+		_ = countRedisService.SetScore(ctx, fmt.Sprintf("c%d", i), score, countNow)
+	}
+	for _, score := range []int64{30, 25, 20, 5} {
+		memRank, memErr := countStoreService.GetRankForScore(ctx, score)
+		redisRank, redisErr := countRedisService.GetRankForScore(ctx, score)
+		fmt.Printf("分数 %d: 内存=%d (err=%v), Redis=%d (err=%v)\n", score, memRank, memErr, redisRank, redisErr)
+	}
+	_ = countRedisService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 WithSlidingTTL
+	fmt.Println("\n--- 测试 WithSlidingTTL (每次写入把 TTL 重新设置为 24h) ---")
+	sliding := NewLeaderboardService(rdb, WithKey(leaderboardKey+":sliding"), WithSlidingTTL(24*time.Hour))
+	_ = sliding.ResetLeaderboard(ctx)
+	_ = sliding.UpdateScore(ctx, "playerA", 10, time.Now().Unix())
+	_ = rdb.Expire(ctx, sliding.key(), time.Minute).Err()
+	fmt.Printf("手动缩短后的 TTL: %v\n", rdb.TTL(ctx, sliding.key()).Val().Round(time.Minute))
+	_ = sliding.SetScore(ctx, "playerB", 20, time.Now().Unix())
+	fmt.Printf("SetScore 之后的 TTL: %v\n", rdb.TTL(ctx, sliding.key()).Val().Round(time.Minute))
+	_ = rdb.Expire(ctx, sliding.key(), time.Minute).Err()
+	_ = sliding.UpdateScore(ctx, "playerA", 5, time.Now().Unix())
+	fmt.Printf("UpdateScore 之后的 TTL: %v\n", rdb.TTL(ctx, sliding.key()).Val().Round(time.Minute))
+	_ = sliding.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GetPlayersByRanks
+	fmt.Println("\n--- 测试 GetPlayersByRanks (按任意排名取玩家, 超出范围的为零值) ---")
+	picked, err := service.GetPlayersByRanks(ctx, []int64{1, 3, 0, 1000000})
+	if err != nil {
+		fmt.Printf("按排名查询失败: %v\n", err)
+	}
+	for _, p := range picked {
+		fmt.Printf("排名: %d, 玩家: %s, 分数: %d, Found: %v\n", p.Rank, p.PlayerID, p.Score, p.Found)
+	}
+	fmt.Println("========================================")
+
+	// 测试 WithScoreNormalization
+	fmt.Println("\n--- 测试 WithScoreNormalization (原始分数 [0, 1000] 换算为 0~100, 排名仍按原始分数) ---")
+	ratedService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":rated"), WithScoreNormalization(0, 1000))
+	_ = ratedService.ResetLeaderboard(ctx)
+	ratedNow := time.Now().Unix()
+	for id, score := range map[string]int64{"r1": -50, "r2": 250, "r3": 254, "r4": 5000} {
+		_ = ratedService.SetScore(ctx, id, score, ratedNow)
+	}
+	if rated, err := ratedService.GetTopN(ctx, 4); err == nil {
+		for _, p := range rated {
+			fmt.Printf("排名: %d, 玩家: %s, 展示分: %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	if raw, err := rdb.ZScore(ctx, ratedService.key(), "r3").Result(); err == nil {
+		rawScore, _ := ratedService.decodeScore(raw)
+		fmt.Printf("r3 存储的原始分数: %d\n", rawScore)
+	}
+	_ = ratedService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
+
+	// 测试 GC
+	fmt.Println("\n--- 测试 GC (清理直接 ZREM 后遗留的历史和元数据) ---")
+	gcService := NewLeaderboardService(rdb, WithKey(leaderboardKey+":gc"), WithScoreHistory(5))
+	_ = gcService.ResetLeaderboard(ctx)
+	for _, id := range []string{"kept", "orphan"} {
+		_ = gcService.UpdateScore(ctx, id, 10, time.Now().Unix())
+		_ = gcService.SetPlayerMetadata(ctx, id, map[string]string{"name": id})
+	}
+	_ = rdb.ZRem(ctx, gcService.key(), "orphan").Err()
+	gcRemoved, err := gcService.GC(ctx)
+	fmt.Printf("GC 删除 %d 个 key (期望 2), err=%v\n", gcRemoved, err)
+	for _, id := range []string{"kept", "orphan"} {
+		exists := rdb.Exists(ctx, gcService.historyKey(gcService.key(), id), gcService.metadataKey(id)).Val()
+		fmt.Printf("%s 剩余的历史和元数据 key: %d\n", id, exists)
+	}
+	gcRemoved, err = gcService.GC(ctx)
+	fmt.Printf("再次 GC 删除 %d 个 key, err=%v\n", gcRemoved, err)
+	_, _ = gcService.DeletePlayers(ctx, []string{"kept"})
+	_ = gcService.ResetLeaderboard(ctx)
+	fmt.Println("========================================")
 }
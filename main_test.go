@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"ranking/memstore"
+)
+
+// testTimestamp 是测试中使用的基准时间戳 (秒)
+const testTimestamp = 1700000000
+
+// newMemService 创建基于内存 RankStore 的排行榜服务, 不需要 Redis
+func newMemService(t *testing.T, opts ...Option) *LeaderboardService {
+	t.Helper()
+	return NewLeaderboardServiceWithStore(memstore.New(scoreMultiplier), opts...)
+}
+
+// newRedisService 创建连接 REDIS_ADDR (默认 localhost:6379) 的排行榜服务, 连接不上时跳过测试
+// 每个测试使用以测试名命名的独立 key, 结束时删除
+func newRedisService(t *testing.T, opts ...Option) *LeaderboardService {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		t.Skipf("redis not available at %s: %v", addr, err)
+	}
+	key := "test:leaderboard:" + t.Name()
+	cleanup := func() {
+		keys, _ := rdb.Keys(context.Background(), escapeGlob(key)+"*").Result()
+		if len(keys) > 0 {
+			rdb.Del(context.Background(), keys...)
+		}
+	}
+	cleanup()
+	t.Cleanup(func() {
+		cleanup()
+		rdb.Close()
+	})
+	return NewLeaderboardService(rdb, append([]Option{WithKey(key)}, opts...)...)
+}
+
+// backends 是同时在内存存储和 Redis 上运行的测试使用的服务构造函数
+var backends = []struct {
+	name       string
+	newService func(t *testing.T, opts ...Option) *LeaderboardService
+}{
+	{"memstore", newMemService},
+	{"redis", newRedisService},
+}
+
+// mustRank 返回玩家的 RankInfo, 出错时终止测试
+func mustRank(t *testing.T, s *LeaderboardService, playerID string) *RankInfo {
+	t.Helper()
+	info, err := s.GetPlayerRank(context.Background(), playerID)
+	if err != nil {
+		t.Fatalf("GetPlayerRank(%s): %v", playerID, err)
+	}
+	return info
+}
+
+func TestUpdateScoreConcurrentIncrements(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := b.newService(t)
+			if err := s.UpdateScore(ctx, "player", 50, testTimestamp); err != nil {
+				t.Fatal(err)
+			}
+
+			const workers = 100
+			var wg sync.WaitGroup
+			errs := make(chan error, workers)
+			for i := range workers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- s.UpdateScore(ctx, "player", 1, testTimestamp+int64(i))
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if got := mustRank(t, s, "player").Score; got != 50+workers {
+				t.Errorf("score = %d, want %d", got, 50+workers)
+			}
+		})
+	}
+}
+
+func TestLargeScoreKeepsTimestampOrder(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := b.newService(t)
+			// 后写入但时间戳更早的玩家应排在前面
+			if err := s.SetScore(ctx, "late", maxSafeScore, testTimestamp+1); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetScore(ctx, "early", maxSafeScore, testTimestamp); err != nil {
+				t.Fatal(err)
+			}
+
+			top, err := s.GetTopN(ctx, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(top) != 2 || top[0].PlayerID != "early" || top[1].PlayerID != "late" {
+				t.Fatalf("GetTopN = %+v, want early before late", top)
+			}
+			for i, want := range []int64{testTimestamp, testTimestamp + 1} {
+				if top[i].Score != maxSafeScore || top[i].Timestamp != want {
+					t.Errorf("top[%d] = score %d timestamp %d, want %d %d", i, top[i].Score, top[i].Timestamp, int64(maxSafeScore), want)
+				}
+			}
+		})
+	}
+}
+
+func TestScoreAboveMaxSafeScoreRejected(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := b.newService(t)
+			if err := s.SetScore(ctx, "player", maxSafeScore+1, testTimestamp); !errors.Is(err, ErrScoreOutOfRange) {
+				t.Errorf("SetScore above max: err = %v, want ErrScoreOutOfRange", err)
+			}
+			if err := s.UpdateScore(ctx, "player", maxSafeScore, testTimestamp); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.UpdateScore(ctx, "player", 1, testTimestamp); !errors.Is(err, ErrScoreOutOfRange) {
+				t.Errorf("UpdateScore past max: err = %v, want ErrScoreOutOfRange", err)
+			}
+			if got := mustRank(t, s, "player").Score; got != maxSafeScore {
+				t.Errorf("score = %d, want %d", got, int64(maxSafeScore))
+			}
+		})
+	}
+}
+
+// seedBoard 写入 n 名玩家 p01..pNN, 分数依次递减, 因此 pXX 的名次为 XX
+func seedBoard(t *testing.T, s *LeaderboardService, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		if err := s.SetScore(context.Background(), fmt.Sprintf("p%02d", i), int64(1000-i), testTimestamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// checkRanks 检查 entries 的名次依次为 from..to, 且玩家与 seedBoard 写入的名次一致
+func checkRanks(t *testing.T, entries []RankInfo, from, to int64) {
+	t.Helper()
+	if int64(len(entries)) != to-from+1 {
+		t.Fatalf("got %d entries %+v, want ranks %d..%d", len(entries), entries, from, to)
+	}
+	for i, e := range entries {
+		want := from + int64(i)
+		if e.Rank != want || e.PlayerID != fmt.Sprintf("p%02d", want) {
+			t.Errorf("entries[%d] = %s rank %d, want p%02d rank %d", i, e.PlayerID, e.Rank, want, want)
+		}
+	}
+}
+
+func TestGetPlayerRankRangeFullWindow(t *testing.T) {
+	tests := []struct {
+		playerID string
+		nRange   int64
+		from, to int64
+	}{
+		{"p01", 5, 1, 5},
+		{"p02", 5, 1, 5},
+		{"p10", 5, 6, 10},
+		{"p01", 4, 1, 4},
+		{"p02", 4, 1, 4},
+		{"p10", 4, 7, 10},
+		// 偶数 nRange 时之后多取一名
+		{"p05", 4, 4, 7},
+	}
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.newService(t)
+			seedBoard(t, s, 10)
+			for _, tt := range tests {
+				entries, err := s.GetPlayerRankRange(context.Background(), tt.playerID, tt.nRange)
+				if err != nil {
+					t.Fatalf("GetPlayerRankRange(%s, %d): %v", tt.playerID, tt.nRange, err)
+				}
+				checkRanks(t, entries, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestNonFiniteScoreReported(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.newService(t)
+			if err := s.SetScore(ctx, "good", 10, testTimestamp); err != nil {
+				t.Fatal(err)
+			}
+			// 模拟手动写入的错误数据
+			member, err := s.member("bad")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.store.ZAdd(ctx, s.key(), redis.Z{Score: math.Inf(1), Member: member}).Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.GetPlayerRank(ctx, "bad")
+			if !errors.Is(err, ErrNonFiniteScore) || !strings.Contains(err.Error(), "bad") {
+				t.Errorf("GetPlayerRank: err = %v, want ErrNonFiniteScore naming the member", err)
+			}
+			if _, err := s.GetTopN(ctx, 10); !errors.Is(err, ErrNonFiniteScore) {
+				t.Errorf("GetTopN: err = %v, want ErrNonFiniteScore", err)
+			}
+			if got := mustRank(t, s, "good"); got.Score != 10 || got.Rank != 2 {
+				t.Errorf("good = score %d rank %d, want 10 2", got.Score, got.Rank)
+			}
+		})
+	}
+}
+
+func TestGetPlayerRankRangeLastRank(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.newService(t)
+			seedBoard(t, s, 10)
+			for _, nRange := range []int64{1, 2, 3} {
+				entries, err := s.GetPlayerRankRange(ctx, "p10", nRange)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkRanks(t, entries, 11-nRange, 10)
+			}
+			window, err := s.GetPlayerRangeWindow(ctx, "p10", 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if window.StartRank != 8 || window.EndRank != 10 || !window.HasAbove || window.HasBelow {
+				t.Errorf("window = %+v, want ranks 8..10 with HasAbove only", window)
+			}
+		})
+	}
+}
+
+func TestGetPlayerRankRangeSmallBoard(t *testing.T) {
+	ctx := context.Background()
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.newService(t)
+			seedBoard(t, s, 3)
+			// 人数不足 nRange 时返回整个排行榜, 名次不超过人数
+			for _, playerID := range []string{"p01", "p02", "p03"} {
+				entries, err := s.GetPlayerRankRange(ctx, playerID, 5)
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkRanks(t, entries, 1, 3)
+			}
+		})
+	}
+}
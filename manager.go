@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaderboardManager 为多个游戏模式分发共享同一个 Redis 客户端的排行榜服务
+// 每个模式的 key 为 <prefix>:<mode>, 可安全地并发使用
+type LeaderboardManager struct {
+	rdb    *redis.Client
+	prefix string
+	opts   []Option
+
+	mu     sync.Mutex
+	boards map[string]*LeaderboardService
+}
+
+// NewLeaderboardManager 创建排行榜管理器, opts 会应用到它创建的每个排行榜服务
+func NewLeaderboardManager(rdb *redis.Client, prefix string, opts ...Option) *LeaderboardManager {
+	return &LeaderboardManager{
+		rdb:    rdb,
+		prefix: prefix,
+		opts:   opts,
+		boards: make(map[string]*LeaderboardService),
+	}
+}
+
+// Board 返回指定模式的排行榜服务, 同一模式多次调用返回同一个实例
+func (m *LeaderboardManager) Board(mode string) *LeaderboardService {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if board, ok := m.boards[mode]; ok {
+		return board
+	}
+	opts := append(append([]Option{}, m.opts...), WithKey(m.prefix+":"+mode))
+	board := NewLeaderboardService(m.rdb, opts...)
+	m.boards[mode] = board
+	return board
+}
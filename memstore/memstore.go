@@ -0,0 +1,357 @@
+// Package memstore 提供排行榜 RankStore 接口的内存实现, 用于在没有 Redis 的环境下测试
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// entry 是有序集合中的一个成员
+type entry struct {
+	member string
+	score  float64
+}
+
+// less 与 Redis 有序集合的排序规则一致: 先按分数升序, 分数相同时按成员字典序升序
+func less(a, b entry) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.member < b.member
+}
+
+// sortedSet 用按 less 排序的切片和成员索引实现有序集合
+type sortedSet struct {
+	entries []entry
+	scores  map[string]float64
+}
+
+// index 返回成员在升序切片中的位置
+func (z *sortedSet) index(member string) (int, bool) {
+	score, ok := z.scores[member]
+	if !ok {
+		return 0, false
+	}
+	target := entry{member: member, score: score}
+	i := sort.Search(len(z.entries), func(i int) bool { return !less(z.entries[i], target) })
+	return i, true
+}
+
+func (z *sortedSet) remove(member string) bool {
+	i, ok := z.index(member)
+	if !ok {
+		return false
+	}
+	z.entries = append(z.entries[:i], z.entries[i+1:]...)
+	delete(z.scores, member)
+	return true
+}
+
+// set 写入成员的分数, 返回是否为新成员
+func (z *sortedSet) set(member string, score float64) bool {
+	added := !z.remove(member)
+	e := entry{member: member, score: score}
+	i := sort.Search(len(z.entries), func(i int) bool { return !less(z.entries[i], e) })
+	z.entries = append(z.entries, entry{})
+	copy(z.entries[i+1:], z.entries[i:])
+	z.entries[i] = e
+	z.scores[member] = score
+	return added
+}
+
+// Store 是并发安全的内存 RankStore 实现
+type Store struct {
+	multiplier int64
+
+	mu   sync.Mutex
+	sets map[string]*sortedSet
+}
+
+// New 创建内存存储, multiplier 需与排行榜服务的组合分数编码一致
+func New(multiplier int64) *Store {
+	return &Store{
+		multiplier: multiplier,
+		sets:       make(map[string]*sortedSet),
+	}
+}
+
+// set 返回 key 对应的有序集合, create 为 false 且不存在时返回 nil
+func (s *Store) set(key string, create bool) *sortedSet {
+	z, ok := s.sets[key]
+	if !ok && create {
+		z = &sortedSet{scores: make(map[string]float64)}
+		s.sets[key] = z
+	}
+	return z
+}
+
+// dropIfEmpty 与 Redis 一样, 有序集合为空时删除 key
+func (s *Store) dropIfEmpty(key string) {
+	if z, ok := s.sets[key]; ok && len(z.entries) == 0 {
+		delete(s.sets, key)
+	}
+}
+
+// ZAdd 写入成员分数, 返回新增的成员数
+func (s *Store) ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, true)
+	added := int64(0)
+	for _, m := range members {
+		member, ok := m.Member.(string)
+		if !ok {
+			member = fmt.Sprint(m.Member)
+		}
+		if z.set(member, m.Score) {
+			added++
+		}
+	}
+	return redis.NewIntResult(added, nil)
+}
+
+// ZScore 返回成员分数, 成员不存在时返回 redis.Nil
+func (s *Store) ZScore(ctx context.Context, key, member string) *redis.FloatCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewFloatResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	score, ok := z.scores[member]
+	if !ok {
+		return redis.NewFloatResult(0, redis.Nil)
+	}
+	return redis.NewFloatResult(score, nil)
+}
+
+// ZRank 返回成员按分数升序的 0-based 排名, 成员不存在时返回 redis.Nil
+func (s *Store) ZRank(ctx context.Context, key, member string) *redis.IntCmd {
+	return s.rank(ctx, key, member, false)
+}
+
+// ZRevRank 返回成员按分数降序的 0-based 排名, 成员不存在时返回 redis.Nil
+func (s *Store) ZRevRank(ctx context.Context, key, member string) *redis.IntCmd {
+	return s.rank(ctx, key, member, true)
+}
+
+func (s *Store) rank(ctx context.Context, key, member string, rev bool) *redis.IntCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewIntResult(0, redis.Nil)
+	}
+	i, ok := z.index(member)
+	if !ok {
+		return redis.NewIntResult(0, redis.Nil)
+	}
+	if rev {
+		i = len(z.entries) - 1 - i
+	}
+	return redis.NewIntResult(int64(i), nil)
+}
+
+// ZRangeWithScores 按分数升序返回 [start, stop] 区间内的成员, 支持 Redis 的负数下标
+func (s *Store) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	return s.rangeWithScores(ctx, key, start, stop, false)
+}
+
+// ZRevRangeWithScores 按分数降序返回 [start, stop] 区间内的成员, 支持 Redis 的负数下标
+func (s *Store) ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	return s.rangeWithScores(ctx, key, start, stop, true)
+}
+
+func (s *Store) rangeWithScores(ctx context.Context, key string, start, stop int64, rev bool) *redis.ZSliceCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewZSliceCmdResult(nil, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewZSliceCmdResult([]redis.Z{}, nil)
+	}
+	n := int64(len(z.entries))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return redis.NewZSliceCmdResult([]redis.Z{}, nil)
+	}
+
+	results := make([]redis.Z, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		e := z.entries[i]
+		if rev {
+			e = z.entries[n-1-i]
+		}
+		results = append(results, redis.Z{Score: e.score, Member: e.member})
+	}
+	return redis.NewZSliceCmdResult(results, nil)
+}
+
+// ZRem 删除成员, 返回实际删除的成员数
+func (s *Store) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewIntResult(0, nil)
+	}
+	removed := int64(0)
+	for _, m := range members {
+		member, ok := m.(string)
+		if !ok {
+			member = fmt.Sprint(m)
+		}
+		if z.remove(member) {
+			removed++
+		}
+	}
+	s.dropIfEmpty(key)
+	return redis.NewIntResult(removed, nil)
+}
+
+// ZCard 返回成员数, key 不存在时返回 0
+func (s *Store) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewIntResult(0, nil)
+	}
+	return redis.NewIntResult(int64(len(z.entries)), nil)
+}
+
+// ZCount 返回分数在 [min, max] 内的成员数, 边界格式与 Redis 相同: "-inf"、"+inf", 以 "(" 开头表示不包含该值
+func (s *Store) ZCount(ctx context.Context, key, min, max string) *redis.IntCmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	low, lowExclusive, err := parseBound(min)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	high, highExclusive, err := parseBound(max)
+	if err != nil {
+		return redis.NewIntResult(0, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, false)
+	if z == nil {
+		return redis.NewIntResult(0, nil)
+	}
+	// entries 按分数升序排列, 两次二分查找得到区间的起止位置
+	start := sort.Search(len(z.entries), func(i int) bool {
+		return z.entries[i].score > low || !lowExclusive && z.entries[i].score == low
+	})
+	end := sort.Search(len(z.entries), func(i int) bool {
+		return z.entries[i].score > high || highExclusive && z.entries[i].score == high
+	})
+	if end < start {
+		return redis.NewIntResult(0, nil)
+	}
+	return redis.NewIntResult(int64(end-start), nil)
+}
+
+// parseBound 解析 ZCOUNT 的区间边界
+func parseBound(bound string) (value float64, exclusive bool, err error) {
+	if rest, ok := strings.CutPrefix(bound, "("); ok {
+		bound, exclusive = rest, true
+	}
+	switch bound {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+	value, err = strconv.ParseFloat(bound, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("min or max is not a float: %q", bound)
+	}
+	return value, exclusive, nil
+}
+
+// IncrScore 与排行榜的 updateScoreScript 行为一致:
+// 旧组合分数按向下取整拆分出原始分数和时间戳部分, staleCheck 非 0 时拒绝时间戳不更新的写入,
+// 新分数超出 [minScore, maxScore] 时按 clamp 截断或返回 redis.Nil,
+// 更新已有成员返回 1, 新建成员返回 2, 时间戳过旧返回 0, 发生截断时再加 4
+func (s *Store) IncrScore(ctx context.Context, key, member string, incr, tiebreak int64, staleCheck int, minScore, maxScore int64, clamp bool) *redis.Cmd {
+	if err := ctx.Err(); err != nil {
+		return redis.NewCmdResult(nil, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	z := s.set(key, true)
+	defer s.dropIfEmpty(key)
+
+	oldScore := int64(0)
+	old, exists := z.scores[member]
+	if exists {
+		combined := int64(old)
+		oldScore = combined / s.multiplier
+		part := combined % s.multiplier
+		if part < 0 {
+			oldScore--
+			part += s.multiplier
+		}
+		if staleCheck != 0 && (part-tiebreak)*int64(staleCheck) <= 0 {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+	}
+	newScore := oldScore + incr
+	clamped := int64(0)
+	if newScore < minScore || newScore > maxScore {
+		if !clamp {
+			return redis.NewCmdResult(nil, redis.Nil)
+		}
+		newScore = min(max(newScore, minScore), maxScore)
+		clamped = 4
+	}
+	z.set(member, float64(newScore*s.multiplier+tiebreak))
+	if !exists {
+		return redis.NewCmdResult(2+clamped, nil)
+	}
+	return redis.NewCmdResult(1+clamped, nil)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// mergePlayersScript 原子地将源玩家的原始分数加到目标玩家上并删除源玩家
+// KEYS[1]: 排行榜 key, KEYS[2] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: sourceID, destID, scoreMultiplier, minScore, maxScore, clamp, 升序时为 '1', bucketWidth (仅在有 KEYS[2] 时使用)
+// 两人的时间戳部分取排名更靠前的一个: 降序时组合分数越大越靠前, 升序时越小越靠前
+// 成功返回 1, 源玩家不存在返回 0; 合并后的分数超出 [minScore, maxScore] 时, clamp 为 '1' 则截断到区间内, 否则不写入并返回 nil
+var mergePlayersScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[3])
+local function decode(combined)
+	local score = math.floor(combined / multiplier)
+	local part = combined - score * multiplier
+	if part < 0 then
+		score = score - 1
+		part = part + multiplier
+	elseif part >= multiplier then
+		score = score + 1
+		part = part - multiplier
+	end
+	return score, part
+end
+
+local source = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not source then
+	return 0
+end
+local sourceScore, sourcePart = decode(tonumber(source))
+local score, part = sourceScore, sourcePart
+local dest = redis.call('ZSCORE', KEYS[1], ARGV[2])
+local destScore
+if dest then
+	local destPart
+	destScore, destPart = decode(tonumber(dest))
+	score = score + destScore
+	if (ARGV[7] == '1') == (destPart < part) then
+		part = destPart
+	end
+end
+local minScore = tonumber(ARGV[4])
+local maxScore = tonumber(ARGV[5])
+if score < minScore or score > maxScore then
+	if ARGV[6] ~= '1' then
+		return false
+	end
+	score = math.min(math.max(score, minScore), maxScore)
+end
+
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[1], score * multiplier + part, ARGV[2])
+if KEYS[2] then
+	local width = tonumber(ARGV[8])
+	redis.call('HINCRBY', KEYS[2], math.floor(sourceScore / width), -1)
+	if dest then
+		redis.call('HINCRBY', KEYS[2], math.floor(destScore / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[2], math.floor(score / width), 1)
+end
+return 1
+`)
+
+// MergePlayers 将 sourceID 的原始分数转移给 destID 并把 sourceID 从排行榜中删除, 例如用于账号合并
+// destID 不在排行榜上时直接继承源玩家的分数和时间戳; 否则分数相加, 时间戳取两人中同分时排名更靠前的一个
+// 读取、写入和删除在同一个 Lua 脚本中完成, 不会出现两人同时存在或都被删除的中间状态
+// 源玩家不存在时返回 ErrPlayerNotFound; 合并后的分数超出 WithScoreBounds 的区间时按 SetScore 的规则截断,
+// 未配置截断时返回 ErrScoreOutOfRange 且不做任何修改; 合并成功后源玩家的元数据等附属 key 与 DeletePlayer 一样被删除
+func (s *LeaderboardService) MergePlayers(ctx context.Context, sourceID, destID string) (err error) {
+	defer s.observe(&ctx, "MergePlayers")(&err)
+	if err := s.requireRedis("MergePlayers"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if sourceID == destID {
+		return fmt.Errorf("cannot merge player %s into itself", sourceID)
+	}
+	ascending := "0"
+	if s.order == Ascending {
+		ascending = "1"
+	}
+	source, err := s.member(sourceID)
+	if err != nil {
+		return err
+	}
+	dest, err := s.member(destID)
+	if err != nil {
+		return err
+	}
+	clamp := 0
+	if s.clampScores {
+		clamp = 1
+	}
+	key := s.key()
+	release, err := s.flushPending(ctx, key, []string{sourceID, destID})
+	if err != nil {
+		return err
+	}
+	defer release()
+	var cmd *redis.Cmd
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		cmd = mergePlayersScript.Run(ctx, c, s.scriptKeys(key),
+			source, dest, scoreMultiplier, s.minScore, s.maxScore, clamp, ascending, s.bucketWidth)
+		return cmd
+	})
+	merged, err := cmd.Int()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("%w: merge %s into %s", ErrScoreOutOfRange, sourceID, destID)
+		}
+		return err
+	}
+	if merged == 0 {
+		return fmt.Errorf("%w: %s", ErrPlayerNotFound, sourceID)
+	}
+	s.invalidateCached(key, sourceID, destID)
+	return s.deletePlayerKeys(ctx, key, []string{sourceID}, []string{source})
+}
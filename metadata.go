@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// EnrichedRankInfo 在 RankInfo 的基础上附带玩家元数据 (昵称、头像等)
+type EnrichedRankInfo struct {
+	RankInfo
+	// Metadata 只包含元数据哈希中存在的字段, 玩家没有元数据时为空 map
+	Metadata map[string]string `json:"metadata"`
+}
+
+// WithMetadataPrefix 设置玩家元数据哈希 key 的前缀, 玩家的元数据保存在 <prefix><playerID> 中
+// 默认为 <key>:meta:, 其中 key 为 WithKey 设置的排行榜 key (不含时间窗口后缀)
+func WithMetadataPrefix(prefix string) Option {
+	return func(s *LeaderboardService) {
+		s.metaPrefix = prefix
+	}
+}
+
+// metadataKey 返回玩家元数据哈希的 key
+func (s *LeaderboardService) metadataKey(playerID string) string {
+	if s.metaPrefix == "" {
+		return s.baseKey + ":meta:" + playerID
+	}
+	return s.metaPrefix + playerID
+}
+
+// SetPlayerMetadata 写入玩家元数据, 只覆盖 fields 中给出的字段
+func (s *LeaderboardService) SetPlayerMetadata(ctx context.Context, playerID string, fields map[string]string) (err error) {
+	defer s.observePlayer(&ctx, "SetPlayerMetadata", playerID)(&err)
+	if err := s.requireRedis("SetPlayerMetadata"); err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return s.rdb.HSet(ctx, s.metadataKey(playerID), fields).Err()
+}
+
+// GetTopNEnriched 获取前 N 名玩家并附带元数据中的 fields 字段, n <= 0 时返回 ErrInvalidLimit
+// 读取排行榜后在一个 pipeline 中对每名玩家执行 HMGET, 缺失的字段或元数据哈希直接省略, 不视为错误
+func (s *LeaderboardService) GetTopNEnriched(ctx context.Context, n int64, fields []string) (_ []EnrichedRankInfo, err error) {
+	defer s.observe(&ctx, "GetTopNEnriched")(&err)
+	if err := s.requireRedis("GetTopNEnriched"); err != nil {
+		return nil, err
+	}
+	rankings, err := s.displayRankings(s.topN(ctx, s.key(), n))
+	if err != nil {
+		return nil, err
+	}
+
+	enriched := make([]EnrichedRankInfo, len(rankings))
+	for i, info := range rankings {
+		enriched[i] = EnrichedRankInfo{RankInfo: info, Metadata: make(map[string]string)}
+	}
+	if len(rankings) == 0 || len(fields) == 0 {
+		return enriched, nil
+	}
+
+	pipe := s.reader.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(rankings))
+	for i, info := range rankings {
+		cmds[i] = pipe.HMGet(ctx, s.metadataKey(info.PlayerID), fields...)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		for j, value := range cmd.Val() {
+			if str, ok := value.(string); ok {
+				enriched[i].Metadata[fields[j]] = str
+			}
+		}
+	}
+	return enriched, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// MetricsObserver 接收排行榜操作的耗时和结果, 可用于对接 Prometheus 等监控系统
+// op 为 LeaderboardService 的方法名, 例如 "UpdateScore"; err 为该方法返回的错误
+// ObserveOp 在每次调用返回前同步执行, 实现应尽快返回且可被并发调用
+type MetricsObserver interface {
+	ObserveOp(op string, dur time.Duration, err error)
+}
+
+// MetricsObserverFunc 让普通函数可以作为 MetricsObserver 使用
+type MetricsObserverFunc func(op string, dur time.Duration, err error)
+
+// ObserveOp 调用 f(op, dur, err)
+func (f MetricsObserverFunc) ObserveOp(op string, dur time.Duration, err error) {
+	f(op, dur, err)
+}
+
+// WithMetricsObserver 为服务设置 MetricsObserver, 未设置时不做任何统计
+// IterateAll 返回的是持续的数据流, 不单独上报; 其余访问存储的公开方法每次调用上报一次
+func WithMetricsObserver(observer MetricsObserver) Option {
+	return func(s *LeaderboardService) {
+		s.metrics = observer
+	}
+}
+
+// noopObserve 是未设置 MetricsObserver、Logger 和 Tracer 时 observe 返回的空函数
+func noopObserve(*error) {}
+
+// observe 开始统计一次 op 操作, 返回的函数在操作结束时以其错误调用, 通常写作
+// defer s.observe(&ctx, "Op")(&err)
+// 结束时上报给 MetricsObserver 并按 WithLogger 的规则输出日志; 设置了 Tracer 时还会开始一个 span,
+// 并把 *ctx 替换为携带该 span 的 context, 使方法内的 Redis 调用成为它的子 span;
+// 三者都未设置时直接返回 noopObserve, 既不读取时间也不分配闭包
+func (s *LeaderboardService) observe(ctx *context.Context, op string) func(*error) {
+	return s.observePlayer(ctx, op, "")
+}
+
+// observePlayer 与 observe 相同, playerID 不为空时作为 span 的 player.id 属性
+func (s *LeaderboardService) observePlayer(ctx *context.Context, op string, playerID string) func(*error) {
+	_, noLogger := s.logger.(noopLogger)
+	if s.metrics == nil && noLogger && s.tracer == nil {
+		return noopObserve
+	}
+	var span Span
+	if s.tracer != nil {
+		*ctx, span = s.startSpan(*ctx, op, playerID)
+	}
+	start := time.Now()
+	return func(errp *error) {
+		dur := time.Since(start)
+		if s.metrics != nil {
+			s.metrics.ObserveOp(op, dur, *errp)
+		}
+		s.logOp(op, dur, *errp)
+		if span != nil {
+			span.End(*errp)
+		}
+	}
+}
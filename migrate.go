@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// migrateBatchSize 是 Migrate 每批读取并重新编码的成员数
+const migrateBatchSize = 1000
+
+// Migrate 将按旧参数编码的排行榜重新编码为当前配置 (scoreMultiplier、TiebreakMode、排序方向和时间戳单位)
+// 旧组合分数按 score*oldMultiplier + part 解码; oldMaxTs > 0 时 part 为 oldMaxTs - timestamp, 为 0 时 part 即 timestamp
+//
+// 重新编码的结果先按批写入临时 key <key>:migrate:tmp, 全部完成后再原子地替换原排行榜, 进度保存在哈希 <key>:migrate:state 中:
+// 中途失败或进程崩溃后以相同参数再次调用会从上次完成的批次继续; 迁移完成后以相同参数重复调用直接返回 nil, 不会重复转换
+// 迁移期间原排行榜不能有写入, 否则这些写入会在替换时丢失; 开启 WithApproxRank 时完成后会重建分数桶计数
+func (s *LeaderboardService) Migrate(ctx context.Context, oldMultiplier, oldMaxTs float64) (err error) {
+	defer s.observe(&ctx, "Migrate")(&err)
+	if err := s.requireRedis("Migrate"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if oldMultiplier < 1 || oldMaxTs < 0 {
+		return fmt.Errorf("invalid old encoding: multiplier %v, max timestamp %v", oldMultiplier, oldMaxTs)
+	}
+	key := s.key()
+	tmpKey := key + ":migrate:tmp"
+	stateKey := key + ":migrate:state"
+	params := fmt.Sprintf("%v/%v->%v/%d/%d/%d", oldMultiplier, oldMaxTs, float64(scoreMultiplier), s.tiebreakMode, s.order, s.timestampUnit)
+
+	state, err := s.rdb.HGetAll(ctx, stateKey).Result()
+	if err != nil {
+		return err
+	}
+	start := int64(0)
+	switch {
+	case state["params"] == params && state["done"] == "1":
+		return nil
+	case state["params"] == params:
+		start, _ = strconv.ParseInt(state["cursor"], 10, 64)
+	default:
+		// 参数不同说明是一次新的迁移, 丢弃之前残留的进度
+		if err := s.rdb.Del(ctx, tmpKey, stateKey).Err(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		results, err := s.rdb.ZRangeWithScores(ctx, key, start, start+migrateBatchSize-1).Result()
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			break
+		}
+		members := make([]redis.Z, len(results))
+		for i, z := range results {
+			member, err := memberID(z)
+			if err != nil {
+				return err
+			}
+			combined, err := s.reencode(member, z.Score, oldMultiplier, oldMaxTs)
+			if err != nil {
+				return err
+			}
+			members[i] = redis.Z{Score: combined, Member: member}
+		}
+		start += int64(len(results))
+		// 写入临时 key 与保存进度在同一个事务中提交, 重新执行同一批也只会写入相同的值
+		if _, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZAdd(ctx, tmpKey, members...)
+			pipe.HSet(ctx, stateKey, "params", params, "cursor", start)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if int64(len(results)) < migrateBatchSize {
+			break
+		}
+	}
+
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if start > 0 {
+			pipe.Rename(ctx, tmpKey, key)
+		}
+		pipe.HSet(ctx, stateKey, "params", params, "cursor", start, "done", 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.touchExpiry(ctx, s.rdb, key)
+	if s.bucketWidth > 0 {
+		return s.rebuildRankBuckets(ctx)
+	}
+	return nil
+}
+
+// reencode 按旧参数解码组合分数并按当前配置重新编码
+func (s *LeaderboardService) reencode(member string, combinedScore, oldMultiplier, oldMaxTs float64) (float64, error) {
+	if err := checkFinite(member, combinedScore); err != nil {
+		return 0, err
+	}
+	multiplier := int64(oldMultiplier)
+	combined := int64(combinedScore)
+	score := combined / multiplier
+	part := combined % multiplier
+	if part < 0 {
+		score--
+		part += multiplier
+	}
+	timestamp := part
+	if oldMaxTs > 0 {
+		timestamp = int64(oldMaxTs) - part
+	}
+	if err := checkScore(score); err != nil {
+		return 0, fmt.Errorf("member %s: %w", member, err)
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return 0, fmt.Errorf("member %s: %w", member, err)
+	}
+	return s.combineScore(score, timestamp), nil
+}
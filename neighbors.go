@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GetNeighbors 返回排在玩家之前的 above 名、玩家自己以及排在之后的 below 名玩家, 按排名顺序排列
+// 靠近榜首或榜尾时只截断不足的一侧, 不会平移窗口去补齐
+func (s *LeaderboardService) GetNeighbors(ctx context.Context, playerID string, above, below int64) (_ []RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetNeighbors", playerID)(&err)
+	if above < 0 || below < 0 {
+		return nil, fmt.Errorf("%w: above %d, below %d", ErrInvalidLimit, above, below)
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	key := s.key()
+	rank, err := s.rank(ctx, s.readStore, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+
+	start := max(rank-above, 0)
+	results, err := s.rangeWithScores(ctx, s.readStore, key, start, rank+below).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.displayRankings(s.toRankInfos(results, start+1))
+}
+
+// GetPlayersWithinScore 返回原始分数在 [score-delta, score+delta] 内的所有玩家 (包括玩家自己), 按排名顺序排列
+// 返回的 Rank 为各玩家在整个排行榜中的排名
+func (s *LeaderboardService) GetPlayersWithinScore(ctx context.Context, playerID string, delta int64) (_ []RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayersWithinScore", playerID)(&err)
+	if err := s.requireRedis("GetPlayersWithinScore"); err != nil {
+		return nil, err
+	}
+	if delta < 0 {
+		return nil, fmt.Errorf("invalid score delta %d", delta)
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	key := s.key()
+	combinedScore, err := s.reader.ZScore(ctx, key, member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, _ := s.decodeScore(combinedScore)
+
+	// 原始分数在 [low, high] 内等价于组合分数在 [low*scoreMultiplier, (high+1)*scoreMultiplier) 内
+	low := float64(score-delta) * scoreMultiplier
+	high := float64(score+delta+1) * scoreMultiplier
+	return s.rangeByCombinedScore(ctx, key, low, high)
+}
+
+// GetPlayersAtScore 返回原始分数恰好为 score 的所有玩家, 例如用于并列冠军的展示
+// 结果按排名顺序排列, 即按 TiebreakMode 决定的同分顺序 (默认时间戳越早越靠前), Rank 为在整个排行榜中的排名
+func (s *LeaderboardService) GetPlayersAtScore(ctx context.Context, score int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetPlayersAtScore")(&err)
+	if err := s.requireRedis("GetPlayersAtScore"); err != nil {
+		return nil, err
+	}
+	if err := checkScore(score); err != nil {
+		return nil, err
+	}
+	// 原始分数为 score 等价于组合分数在 [score*scoreMultiplier, (score+1)*scoreMultiplier) 内
+	low := float64(score) * scoreMultiplier
+	high := float64(score+1) * scoreMultiplier
+	return s.rangeByCombinedScore(ctx, s.key(), low, high)
+}
+
+// GetByScoreRange 返回原始分数在 [minScore, maxScore] 内的所有玩家, 按排名顺序排列, Rank 为在整个排行榜中的排名
+// 只读取一次区间并计数一次窗口之前的人数, 不对每名玩家单独查询排名; minScore > maxScore 时返回空结果
+func (s *LeaderboardService) GetByScoreRange(ctx context.Context, minScore, maxScore int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetByScoreRange")(&err)
+	if err := s.requireRedis("GetByScoreRange"); err != nil {
+		return nil, err
+	}
+	if err := checkScore(minScore); err != nil {
+		return nil, err
+	}
+	if err := checkScore(maxScore); err != nil {
+		return nil, err
+	}
+	if minScore > maxScore {
+		return []RankInfo{}, nil
+	}
+	// 原始分数在 [minScore, maxScore] 内等价于组合分数在 [minScore*scoreMultiplier, (maxScore+1)*scoreMultiplier) 内
+	low := float64(minScore) * scoreMultiplier
+	high := float64(maxScore+1) * scoreMultiplier
+	return s.rangeByCombinedScore(ctx, s.key(), low, high)
+}
+
+// rangeByCombinedScore 返回组合分数在 [low, high) 内的所有玩家及其在整个排行榜中的排名
+// 只需一次区间读取和一次计数: 窗口第一名的排名等于排在窗口之前的人数加一, 之后依次递增
+func (s *LeaderboardService) rangeByCombinedScore(ctx context.Context, key string, low, high float64) ([]RankInfo, error) {
+	pipe := s.reader.Pipeline()
+	membersCmd := s.rangeBetweenScores(ctx, pipe, key, formatScore(low), "("+formatScore(high))
+	var beforeCmd *redis.IntCmd
+	if s.order == Ascending {
+		beforeCmd = pipe.ZCount(ctx, key, "-inf", "("+formatScore(low))
+	} else {
+		beforeCmd = pipe.ZCount(ctx, key, formatScore(high), "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	return s.displayRankings(s.toRankInfos(membersCmd.Val(), beforeCmd.Val()+1))
+}
+
+// GapInfo 描述玩家与排在其前一名的玩家之间的分差
+// AlreadyFirst 为 true 时玩家已是第一名, Above 为 nil (JSON 中省略), Gap 为 0
+type GapInfo struct {
+	Player       RankInfo  `json:"player"`
+	Above        *RankInfo `json:"above,omitempty"`
+	Gap          int64     `json:"gap"` // 原始分数之差, 总是 >= 0; 为 0 时两人同分, 由 TiebreakMode 决定先后
+	AlreadyFirst bool      `json:"alreadyFirst"`
+}
+
+// GetGapToNextRank 返回排在玩家前一名的玩家及两人的原始分数之差, 用于展示 "再得 7 分即可超越 PlayerX"
+// 降序时要超越对方需要再得 Gap 分以上 (同分时是否超越取决于 TiebreakMode), 升序时需要减少相应的分数
+// 玩家不在排行榜上时返回 ErrPlayerNotFound; 开启 WithTiebreakKeys 时前一名按附加字段解决并列后确定
+func (s *LeaderboardService) GetGapToNextRank(ctx context.Context, playerID string) (_ *GapInfo, err error) {
+	defer s.observePlayer(&ctx, "GetGapToNextRank", playerID)(&err)
+	key := s.key()
+	player, err := s.playerRank(ctx, key, playerID)
+	if err != nil {
+		return nil, err
+	}
+	if player.Rank == 1 {
+		s.displayRank(player, nil)
+		return &GapInfo{Player: *player, AlreadyFirst: true}, nil
+	}
+	results, err := s.rangeResolved(ctx, key, player.Rank-2, player.Rank-2)
+	if err != nil {
+		return nil, err
+	}
+	above, err := s.toRankInfos(results, player.Rank-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(above) == 0 {
+		// 读取期间前面的玩家被删除, 玩家已升到第一名
+		s.displayRank(player, nil)
+		return &GapInfo{Player: *player, AlreadyFirst: true}, nil
+	}
+	gap := above[0].Score - player.Score
+	if s.order == Ascending {
+		gap = -gap
+	}
+	// Gap 按原始分数计算之后再换算展示分
+	s.displayRank(player, nil)
+	s.displayRankings(above, nil)
+	return &GapInfo{Player: *player, Above: &above[0], Gap: max(gap, 0)}, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import "math"
+
+// scoreScale 是 WithScoreNormalization 的换算区间, 原始分数 min 对应 0, max 对应 100
+type scoreScale struct {
+	min, max int64
+}
+
+// WithScoreNormalization 把返回的 RankInfo 中的 Score 按原始分数区间 [minScore, maxScore] 线性换算为 0~100 的展示分, 例如 "评分"
+// 只影响返回值: 写入、存储和排名仍使用原始分数, 展示分相同的玩家依然按原始分数排序; 低于 minScore 的为 0, 高于 maxScore 的为 100, 结果四舍五入
+// 作用于以 RankInfo (包括 RankWithTotal、RankWindow、PageResult、GapInfo、PlayerStats 等) 返回结果的查询方法和 IterateAll;
+// GapInfo.Gap、GetScoreAtRank、GetTieGroups、导出和 CSV 仍为原始分数, 查询参数 (例如 GetByScoreRange 的区间) 也是原始分数;
+// minScore >= maxScore 时不开启
+func WithScoreNormalization(minScore, maxScore int64) Option {
+	return func(s *LeaderboardService) {
+		if minScore < maxScore {
+			s.scoreScale = &scoreScale{min: minScore, max: maxScore}
+		}
+	}
+}
+
+// normalize 把原始分数换算为 0~100 的展示分
+func (c *scoreScale) normalize(score int64) int64 {
+	if score <= c.min {
+		return 0
+	}
+	if score >= c.max {
+		return 100
+	}
+	return int64(math.Round(float64(score-c.min) * 100 / float64(c.max-c.min)))
+}
+
+// displayRankings 开启 WithScoreNormalization 时就地把 rankings 中已上榜项的 Score 换算为展示分
+// 参数与返回值相同, 可以直接包装返回 ([]RankInfo, error) 的调用; err 不为 nil 时原样返回
+func (s *LeaderboardService) displayRankings(rankings []RankInfo, err error) ([]RankInfo, error) {
+	if err != nil || s.scoreScale == nil {
+		return rankings, err
+	}
+	for i := range rankings {
+		s.displayRank(&rankings[i], nil)
+	}
+	return rankings, nil
+}
+
+// displayRank 与 displayRankings 相同, 作用于单个 RankInfo; Found 为 false 的项保持不变
+func (s *LeaderboardService) displayRank(info *RankInfo, err error) (*RankInfo, error) {
+	if err != nil || s.scoreScale == nil || info == nil || !info.Found {
+		return info, err
+	}
+	info.Score = s.scoreScale.normalize(info.Score)
+	return info, nil
+}
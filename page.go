@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxPageSize 是 GetPage 单页允许的最大条数
+const MaxPageSize = 10000
+
+// ErrInvalidCursor 表示分页游标无法解析
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PageResult 是 GetPage 返回的一页结果
+type PageResult struct {
+	Entries []RankInfo `json:"entries"`
+	// NextCursor 用于获取下一页, 为空表示已经没有更多数据
+	NextCursor string `json:"nextCursor"`
+}
+
+// encodeCursor 将最后一条记录的组合分数和成员编码为游标
+func encodeCursor(combinedScore float64, member string) string {
+	raw := formatScore(combinedScore) + ":" + member
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor 是 encodeCursor 的逆运算
+func decodeCursor(cursor string) (float64, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	scoreStr, member, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return 0, "", ErrInvalidCursor
+	}
+	combinedScore, err := strconv.ParseFloat(scoreStr, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return combinedScore, member, nil
+}
+
+// GetPage 基于游标分页读取排行榜, cursor 为空表示从第一名开始
+// 游标记录上一页最后一条的组合分数和成员, 下一页从其之后继续读取,
+// 因此翻页过程中即使有新分数写入也不会出现重复或遗漏
+// 返回的 Rank 为读取该页时的排名; pageSize <= 0 或大于 MaxPageSize 时返回 ErrInvalidLimit
+func (s *LeaderboardService) GetPage(ctx context.Context, cursor string, pageSize int64) (_ PageResult, err error) {
+	defer s.observe(&ctx, "GetPage")(&err)
+	if err := s.requireRedis("GetPage"); err != nil {
+		return PageResult{}, err
+	}
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		return PageResult{}, fmt.Errorf("%w: page size %d", ErrInvalidLimit, pageSize)
+	}
+	key := s.key()
+
+	// 多取一条用于判断是否还有下一页
+	if cursor == "" {
+		results, err := s.rangeFromScore(ctx, s.reader, key, s.topBound(), pageSize+1).Result()
+		if err != nil {
+			return PageResult{}, err
+		}
+		return s.buildPage(results, 1, pageSize)
+	}
+
+	lastScore, lastMember, err := decodeCursor(cursor)
+	if err != nil {
+		return PageResult{}, err
+	}
+	lastScoreStr := formatScore(lastScore)
+
+	// 组合分数完全相同的成员由 Redis 按成员字典序排列, 需要单独取出并跳过游标之前的部分
+	pipe := s.reader.Pipeline()
+	tiesCmd := s.rangeBetweenScores(ctx, pipe, key, lastScoreStr, lastScoreStr)
+	afterCmd := s.rangeFromScore(ctx, pipe, key, "("+lastScoreStr, pageSize+1)
+	higherCmd := s.countBeyond(ctx, pipe, key, lastScore)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return PageResult{}, err
+	}
+
+	results := make([]redis.Z, 0, len(tiesCmd.Val())+len(afterCmd.Val()))
+	passed := int64(0)
+	for _, z := range tiesCmd.Val() {
+		member, err := memberID(z)
+		if err != nil {
+			return PageResult{}, err
+		}
+		if s.order == Ascending && member > lastMember || s.order != Ascending && member < lastMember {
+			results = append(results, z)
+		} else {
+			passed++
+		}
+	}
+	results = append(results, afterCmd.Val()...)
+
+	return s.buildPage(results, higherCmd.Val()+passed+1, pageSize)
+}
+
+// buildPage 将读取到的成员转换为一页结果, firstRank 为第一条记录的排名
+// results 多于 pageSize 条时说明还有下一页, 以本页最后一条生成游标
+func (s *LeaderboardService) buildPage(results []redis.Z, firstRank int64, pageSize int64) (PageResult, error) {
+	hasMore := int64(len(results)) > pageSize
+	if hasMore {
+		results = results[:pageSize]
+	}
+	entries, err := s.displayRankings(s.toRankInfos(results, firstRank))
+	if err != nil {
+		return PageResult{}, err
+	}
+	page := PageResult{Entries: entries}
+	if hasMore {
+		// 游标记录编码后的成员, 与 Redis 中同分成员的字典序比较
+		last := results[len(results)-1]
+		member, err := memberID(last)
+		if err != nil {
+			return PageResult{}, err
+		}
+		page.NextCursor = encodeCursor(last.Score, member)
+	}
+	return page, nil
+}
+
+// topBound 返回按排序方向排在最前的区间端点
+func (s *LeaderboardService) topBound() string {
+	if s.order == Ascending {
+		return "-inf"
+	}
+	return "+inf"
+}
+
+// rangeFromScore 按排序方向读取从 from 开始的至多 count 个成员
+func (s *LeaderboardService) rangeFromScore(ctx context.Context, c redis.Cmdable, key string, from string, count int64) *redis.ZSliceCmd {
+	if s.order == Ascending {
+		return c.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: from, Max: "+inf", Count: count})
+	}
+	return c.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: from, Count: count})
+}
+
+// rangeBetweenScores 按排序方向读取组合分数在 [min, max] 内的所有成员
+func (s *LeaderboardService) rangeBetweenScores(ctx context.Context, c redis.Cmdable, key string, min, max string) *redis.ZSliceCmd {
+	if s.order == Ascending {
+		return c.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: min, Max: max})
+	}
+	return c.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: min, Max: max})
+}
+
+// countBeyond 统计按排序方向排在组合分数 combinedScore 之前 (严格) 的成员数
+func (s *LeaderboardService) countBeyond(ctx context.Context, c redis.Cmdable, key string, combinedScore float64) *redis.IntCmd {
+	bound := "(" + formatScore(combinedScore)
+	if s.order == Ascending {
+		return c.ZCount(ctx, key, "-inf", bound)
+	}
+	return c.ZCount(ctx, key, bound, "+inf")
+}
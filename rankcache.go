@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// WithPlayerRankCache 在进程内缓存 GetPlayerRank 的结果 ttl 时间, 用于同一玩家反复打开个人主页的场景, ttl <= 0 时不开启
+// 与 WithTopNCache 相互独立; 本服务对该玩家自己的写入 (与 WithTopNCache 列出的方法相同)
+// 会立即让其缓存失效, 与 WithTopNCache 相同的方法清空全部缓存; 其他玩家的写入同样会改变该玩家的排名, 但只能等缓存过期后才可见,
+// 因此 ttl 也是排名可能滞后的最长时间; 不在排行榜上的结果不会被缓存
+func WithPlayerRankCache(ttl time.Duration) Option {
+	return func(s *LeaderboardService) {
+		if ttl > 0 {
+			s.rankCache = &playerRankCache{ttl: ttl, entries: make(map[playerRankCacheKey]*playerRankCacheEntry)}
+		}
+	}
+}
+
+// playerRankCache 是 GetPlayerRank 的进程内缓存, 可被并发使用
+type playerRankCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[playerRankCacheKey]*playerRankCacheEntry
+	// generation 在每次失效时递增, 用于丢弃失效之前开始、失效之后才返回的 Redis 读取结果
+	generation uint64
+}
+
+// playerRankCacheKey 区分不同的排行榜 key (时间窗口) 和玩家
+type playerRankCacheKey struct {
+	key      string
+	playerID string
+}
+
+// playerRankCacheEntry 是一名玩家的缓存结果
+type playerRankCacheEntry struct {
+	info    RankInfo
+	expires time.Time
+}
+
+// get 返回未过期的缓存结果的副本, 以及读取 Redis 前应记录的 generation
+func (c *playerRankCache) get(key, playerID string) (_ *RankInfo, generation uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[playerRankCacheKey{key, playerID}]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	info := entry.info
+	return &info, c.generation, true
+}
+
+// put 缓存从 Redis 读到的结果; 读取期间发生过失效时放弃写入, 避免缓存旧数据
+func (c *playerRankCache) put(key string, info RankInfo, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[playerRankCacheKey{key, info.PlayerID}] = &playerRankCacheEntry{info: info, expires: now.Add(c.ttl)}
+}
+
+// invalidate 让排行榜 key 上 playerIDs 的缓存失效, c 为 nil 时不做任何事
+func (c *playerRankCache) invalidate(key string, playerIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, playerID := range playerIDs {
+		delete(c.entries, playerRankCacheKey{key, playerID})
+	}
+}
+
+// clear 清空所有缓存, c 为 nil 时不做任何事
+func (c *playerRankCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.entries)
+}
+
+// invalidateCached 让 WithTopNCache 和 WithPlayerRankCache 中与 playerIDs 有关的缓存失效
+func (s *LeaderboardService) invalidateCached(key string, playerIDs ...string) {
+	s.topCache.invalidate(key, playerIDs...)
+	s.rankCache.invalidate(key, playerIDs...)
+}
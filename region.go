@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// GlobalTopN 合并多个地区排行榜, 返回全局前 n 名, n <= 0 时返回 ErrInvalidLimit
+// regionKeys 为各地区排行榜的完整 key (例如各地区服务的 WithKey 加上时间窗口后缀), 要求它们与本服务使用相同的排序方向、
+// 同分规则和 ID 编码; 一名玩家只属于一个地区, 不做去重
+// 在一个 pipeline 中读取每个地区的前 n 名后按组合分数做 k 路归并, 因此同分时跨地区同样按时间戳决定先后;
+// 任何地区的前 n 名之外的玩家都不可能进入全局前 n 名, 地区大小相差悬殊时结果同样精确; 需要 Redis, 对 RankStore 创建的服务无效
+func (s *LeaderboardService) GlobalTopN(ctx context.Context, n int64, regionKeys []string) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GlobalTopN")(&err)
+	if err := s.requireRedis("GlobalTopN"); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	if len(regionKeys) == 0 {
+		return []RankInfo{}, nil
+	}
+	pipe := s.reader.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, len(regionKeys))
+	for i, key := range regionKeys {
+		cmds[i] = s.rangeWithScores(ctx, pipe, key, 0, n-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	lists := make([][]redis.Z, len(cmds))
+	for i, cmd := range cmds {
+		lists[i] = cmd.Val()
+	}
+	return s.displayRankings(s.toRankInfos(s.mergeTopN(lists, n), 1))
+}
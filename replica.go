@@ -0,0 +1,16 @@
+package main
+
+import "github.com/redis/go-redis/v9"
+
+// WithReadClient 让只读查询通过 reader (通常连接只读副本) 执行, 以减轻主节点的压力, 只适用于 NewLeaderboardService
+// 写入、快照、衰减、WithRankCrossing 在写入前后读取的排名以及其他 Lua 脚本仍然使用主节点的客户端;
+// 只有 GetPlayerStats、GetDistinctScoreCount 以及开启 WithTiebreakKeys 时 GetPlayerRank 的脚本在 reader 上执行,
+// 它们只调用 ZSCORE、ZRANK、ZRANGE、ZCOUNT、ZCARD 等只读命令且不声明 flags,
+// 因此可以在 replica-read-only 的副本上执行
+// 副本的复制是异步的: 刚写入的分数可能要经过复制延迟才能在 GetPlayerRank、GetTopN 等查询中看到,
+// 需要"写后立即读到自己的排名"的场景应使用未设置该选项的服务; reader 由调用方所有, Close 不会关闭它
+func WithReadClient(reader *redis.Client) Option {
+	return func(s *LeaderboardService) {
+		s.reader = reader
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -13,8 +16,73 @@ const (
 	leaderboardKey       = "game:leaderboard:dense_rank_test" // 使用一个独立的key
 	scoreMultiplier      = 1e12
 	maxTimestampReversed = 1e12
+	// float64 只能精确表示 2^53 以内的整数, 组合分数超出该范围后时间戳的比较会失真
+	// 因此原始分数必须落在 [-maxSafeScore, maxSafeScore] 内
+	maxSafeScore = 1<<53/int64(scoreMultiplier) - 1
+	// GetTopNDense 每次从 Redis 读取的行数
+	denseFetchPageSize = 100
+	// distinctScoresKey 是排行榜中出现过的不同原始分数组成的有序集合, 成员和分数都是原始分数
+	distinctScoresKey = leaderboardKey + ":distinct_scores"
+	// scoreCountsKey 记录每个原始分数的玩家人数, 人数降为 0 时从 distinctScoresKey 中移除该分数
+	scoreCountsKey = leaderboardKey + ":score_counts"
+	// denseIndexBuiltKey 存在表示 distinctScoresKey 和 scoreCountsKey 已由 RebuildDenseIndex 从排行榜重建过
+	denseIndexBuiltKey = leaderboardKey + ":dense_index_built"
+	// denseRebuildBatchSize 是 RebuildDenseIndex 每次 ZSCAN 建议返回的成员数
+	denseRebuildBatchSize = 1000
 )
 
+// ErrScoreOutOfRange 表示原始分数超出了组合分数可精确表示的范围
+var ErrScoreOutOfRange = errors.New("score out of safe range")
+
+// ErrPlayerNotFound 表示玩家不在排行榜上
+var ErrPlayerNotFound = errors.New("player not found")
+
+// ErrInvalidMember 表示 Redis 返回的成员不是字符串, 通常是数据被错误写入导致
+var ErrInvalidMember = errors.New("leaderboard member is not a string")
+
+// ErrInvalidLimit 表示请求的玩家数量 (N) 不是正数
+var ErrInvalidLimit = errors.New("limit must be positive")
+
+// updateScoreScript 原子地完成 UpdateScore 的读-改-写, 并同步维护不同原始分数的集合
+// KEYS[1]: 排行榜 key, KEYS[2]: distinctScoresKey, KEYS[3]: scoreCountsKey
+// ARGV: playerID, incrScore, tiebreak, scoreMultiplier, maxSafeScore
+// tiebreak 为组合分数中的时间戳部分, 即 maxTimestampReversed - timestamp
+// 旧分数与 decodeScore 一样按向下取整解码, 负分也能还原写入时的原始分数
+// 新分数超出安全范围时不写入并返回 nil
+var updateScoreScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[4])
+local oldScore = 0
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old then
+	old = tonumber(old)
+	oldScore = math.floor(old / multiplier)
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+	end
+end
+local newScore = oldScore + tonumber(ARGV[2])
+local maxSafeScore = tonumber(ARGV[5])
+if newScore > maxSafeScore or newScore < -maxSafeScore then
+	return false
+end
+local newCombinedScore = newScore * multiplier + tonumber(ARGV[3])
+redis.call('ZADD', KEYS[1], newCombinedScore, ARGV[1])
+
+if old and oldScore == newScore then
+	return newScore
+end
+if old and redis.call('HINCRBY', KEYS[3], oldScore, -1) <= 0 then
+	redis.call('HDEL', KEYS[3], oldScore)
+	redis.call('ZREM', KEYS[2], oldScore)
+end
+redis.call('HINCRBY', KEYS[3], newScore, 1)
+redis.call('ZADD', KEYS[2], newScore, newScore)
+return newScore
+`)
+
 // RankInfo 结构体保持不变
 type RankInfo struct {
 	PlayerID string `json:"playerId"`
@@ -25,44 +93,155 @@ type RankInfo struct {
 // LeaderboardService 结构体保持不变
 type LeaderboardService struct {
 	rdb *redis.Client
-	ctx context.Context
+	// denseReady 为 true 表示已确认密集排名的索引存在, 之后的查询不再检查; 由 denseMu 保护
+	denseMu    sync.Mutex
+	denseReady bool
+}
+
+// swapDenseIndexScript 用重建好的临时 key 原子地替换密集排名的索引, 并设置 denseIndexBuiltKey
+// KEYS[1]: distinctScoresKey, KEYS[2]: scoreCountsKey, KEYS[3]: denseIndexBuiltKey, KEYS[4], KEYS[5]: 对应的临时 key
+var swapDenseIndexScript = redis.NewScript(`
+redis.call('DEL', KEYS[1], KEYS[2])
+if redis.call('EXISTS', KEYS[4]) == 1 then
+	redis.call('RENAME', KEYS[4], KEYS[1])
+	redis.call('RENAME', KEYS[5], KEYS[2])
+end
+redis.call('SET', KEYS[3], 1)
+return 1
+`)
+
+// RebuildDenseIndex 用 ZSCAN 遍历排行榜, 重新生成 distinctScoresKey 和 scoreCountsKey
+// 这两个 key 只由 UpdateScore 维护, 在引入它们之前已有数据的排行榜需要重建一次, 否则密集排名会偏小;
+// GetPlayerRankDense 和 GetNeighborsDense 在 denseIndexBuiltKey 不存在时会自动调用一次
+// 结果先写入临时 key, 遍历完成后再原子地替换; 遍历期间并发的 UpdateScore 对索引的修改会被覆盖, 应在写入较少时执行
+func (s *LeaderboardService) RebuildDenseIndex(ctx context.Context) error {
+	counts := make(map[int64]int64)
+	// ZSCAN 可能重复返回成员, 按成员去重
+	seen := make(map[string]bool)
+	var cursor uint64
+	for {
+		pairs, next, err := s.rdb.ZScan(ctx, leaderboardKey, cursor, "", denseRebuildBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		// ZSCAN 的结果为 member, score 交替排列
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if seen[pairs[i]] {
+				continue
+			}
+			seen[pairs[i]] = true
+			combinedScore, err := strconv.ParseFloat(pairs[i+1], 64)
+			if err != nil {
+				return err
+			}
+			counts[decodeScore(combinedScore)]++
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+
+	tmpDistinct, tmpCounts := distinctScoresKey+":rebuild", scoreCountsKey+":rebuild"
+	pipe := s.rdb.Pipeline()
+	pipe.Del(ctx, tmpDistinct, tmpCounts)
+	for score, n := range counts {
+		pipe.ZAdd(ctx, tmpDistinct, redis.Z{Score: float64(score), Member: score})
+		pipe.HSet(ctx, tmpCounts, strconv.FormatInt(score, 10), n)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	return swapDenseIndexScript.Run(ctx, s.rdb,
+		[]string{distinctScoresKey, scoreCountsKey, denseIndexBuiltKey, tmpDistinct, tmpCounts}).Err()
+}
+
+// ensureDenseIndex 在密集排名的索引尚未重建过时调用 RebuildDenseIndex; 确认一次之后不再访问 Redis, 失败时下次调用会重试
+func (s *LeaderboardService) ensureDenseIndex(ctx context.Context) error {
+	s.denseMu.Lock()
+	defer s.denseMu.Unlock()
+	if s.denseReady {
+		return nil
+	}
+	n, err := s.rdb.Exists(ctx, denseIndexBuiltKey).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := s.RebuildDenseIndex(ctx); err != nil {
+			return fmt.Errorf("rebuild dense index: %w", err)
+		}
+	}
+	s.denseReady = true
+	return nil
 }
 
 // NewLeaderboardService 构造函数保持不变
 func NewLeaderboardService(rdb *redis.Client) *LeaderboardService {
 	return &LeaderboardService{
 		rdb: rdb,
-		ctx: context.Background(),
 	}
 }
 
+// memberID 取出成员的玩家 ID, 成员不是字符串时返回 ErrInvalidMember 而不是 panic
+func memberID(z redis.Z) (string, error) {
+	playerID, ok := z.Member.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %v (%T)", ErrInvalidMember, z.Member, z.Member)
+	}
+	return playerID, nil
+}
+
+// formatScore 将组合分数格式化为 Redis 区间参数, 'f' 格式配合 -1 精度保留能精确还原该值的全部有效数字
+// (%f 固定保留 6 位小数, 会截掉更小的部分, 用作 ZCOUNT 等命令的边界时可能把边界移到错误的一侧)
+func formatScore(combinedScore float64) string {
+	return strconv.FormatFloat(combinedScore, 'f', -1, 64)
+}
+
+// decodeScore 从组合分数中还原原始分数
+// 组合分数为 score*scoreMultiplier + tiebreak 且 tiebreak 在 [0, scoreMultiplier) 内, 因此按向下取整还原, 负分同样适用;
+// 除法的舍入误差可能使商落在整数的另一侧, 按余数修正一次
+func decodeScore(combinedScore float64) int64 {
+	score := math.Floor(combinedScore / scoreMultiplier)
+	part := combinedScore - score*scoreMultiplier
+	if part < 0 {
+		score--
+	} else if part >= scoreMultiplier {
+		score++
+	}
+	return int64(score)
+}
+
 // UpdateScore 方法保持不变
-func (s *LeaderboardService) UpdateScore(playerID string, incrScore int64, timestamp int64) error {
-	oldCombinedScore, err := s.rdb.ZScore(s.ctx, leaderboardKey, playerID).Result()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		return err
+// 读取旧分数、计算新分数并写回在同一个 Lua 脚本中完成, 避免并发更新丢失
+// 更新后的分数超出 [-maxSafeScore, maxSafeScore] 时返回 ErrScoreOutOfRange
+func (s *LeaderboardService) UpdateScore(ctx context.Context, playerID string, incrScore int64, timestamp int64) error {
+	err := updateScoreScript.Run(ctx, s.rdb, []string{leaderboardKey, distinctScoresKey, scoreCountsKey},
+		playerID, incrScore, maxTimestampReversed-timestamp, scoreMultiplier, maxSafeScore).Err()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
 	}
-	oldScore := int64(oldCombinedScore / scoreMultiplier)
-	newScore := oldScore + incrScore
-	newCombinedScore := float64(newScore*scoreMultiplier + (maxTimestampReversed - timestamp))
-	_, err = s.rdb.ZAdd(s.ctx, leaderboardKey, redis.Z{
-		Score:  newCombinedScore,
-		Member: playerID,
-	}).Result()
 	return err
 }
 
 // GetTopN 方法保持不变 (用于对比)
-func (s *LeaderboardService) GetTopN(n int64) ([]RankInfo, error) {
-	results, err := s.rdb.ZRevRangeWithScores(s.ctx, leaderboardKey, 0, n-1).Result()
+func (s *LeaderboardService) GetTopN(ctx context.Context, n int64) ([]RankInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	results, err := s.rdb.ZRevRangeWithScores(ctx, leaderboardKey, 0, n-1).Result()
 	if err != nil {
 		return nil, err
 	}
 	rankings := make([]RankInfo, len(results))
 	for i, member := range results {
+		playerID, err := memberID(member)
+		if err != nil {
+			return nil, err
+		}
 		rankings[i] = RankInfo{
-			PlayerID: member.Member.(string),
-			Score:    int64(member.Score / scoreMultiplier),
+			PlayerID: playerID,
+			Score:    decodeScore(member.Score),
 			Rank:     int64(i + 1), // 标准排名
 		}
 	}
@@ -73,29 +252,31 @@ func (s *LeaderboardService) GetTopN(n int64) ([]RankInfo, error) {
 // 选做题：新增的密集排名方法
 // =================================================================
 
-// GetPlayerRankDense 获取玩家的密集排名
-func (s *LeaderboardService) GetPlayerRankDense(playerID string) (*RankInfo, error) {
+// GetPlayerRankDense 获取玩家的密集排名, 即原始分数比该玩家高的不同分数个数 + 1
+// 不同分数由 UpdateScore 维护在 distinctScoresKey 中, 查询只需一次 ZSCORE 和一次 ZCOUNT, 与同分人数无关;
+// 索引尚未重建过时先调用一次 RebuildDenseIndex
+func (s *LeaderboardService) GetPlayerRankDense(ctx context.Context, playerID string) (*RankInfo, error) {
+	if err := s.ensureDenseIndex(ctx); err != nil {
+		return nil, err
+	}
 	// 1. 获取玩家自己的分数
-	combinedScore, err := s.rdb.ZScore(s.ctx, leaderboardKey, playerID).Result()
+	combinedScore, err := s.rdb.ZScore(ctx, leaderboardKey, playerID).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, fmt.Errorf("player %s not found", playerID)
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
 		}
 		return nil, err
 	}
-	score := int64(combinedScore / scoreMultiplier)
+	score := decodeScore(combinedScore)
 
-	// 2. 计算分数比该玩家【严格】高的玩家数量
-	// ZRevCount 返回 [min, max] 范围内的成员数。我们查询 (+inf, combinedScore) 开区间
-	// 需要将 combinedScore 转换为字符串，并在前面加上 '(' 表示开区间
-	exclusiveScoreStr := fmt.Sprintf("(%f", combinedScore)
-	higherScoreCount, err := s.rdb.ZCount(s.ctx, leaderboardKey, "+inf", exclusiveScoreStr).Result()
+	// 2. 统计比该玩家【严格】高的不同原始分数个数, 同分玩家的组合分数各不相同, 但在 distinctScoresKey 中只占一项
+	higherDistinct, err := s.rdb.ZCount(ctx, distinctScoresKey, "("+strconv.FormatInt(score, 10), "+inf").Result()
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. 密集排名 = 分数比他高的人数 + 1
-	denseRank := higherScoreCount + 1
+	// 3. 密集排名 = 更高的不同分数个数 + 1
+	denseRank := higherDistinct + 1
 
 	return &RankInfo{
 		PlayerID: playerID,
@@ -105,57 +286,242 @@ func (s *LeaderboardService) GetPlayerRankDense(playerID string) (*RankInfo, err
 }
 
 // GetTopNDense 获取前 N 名玩家（密集排名）
-func (s *LeaderboardService) GetTopNDense(limit int64) ([]RankInfo, error) {
-	// 为了获取前 N 个排名，我们可能需要获取超过 N 个玩家
-	// 这里做一个简化，我们先获取一个较多的数量，例如前 100 名
-	results, err := s.rdb.ZRevRangeWithScores(s.ctx, leaderboardKey, 0, 99).Result()
+// limit <= 0 表示获取所有玩家
+func (s *LeaderboardService) GetTopNDense(ctx context.Context, limit int64) ([]RankInfo, error) {
+	// 同分玩家可能很多, 无法预知前 limit 个排名需要多少行,
+	// 因此按页读取, 直到排名超过 limit 或读完整个排行榜
+	rankings := make([]RankInfo, 0)
+	currentRank := int64(0)
+	prevScore := int64(0)
+
+	for start := int64(0); ; start += denseFetchPageSize {
+		results, err := s.rdb.ZRevRangeWithScores(ctx, leaderboardKey, start, start+denseFetchPageSize-1).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range results {
+			currentScore := decodeScore(member.Score)
+
+			// 第一名或分数与上一个不同，排名+1
+			if currentRank == 0 || currentScore < prevScore {
+				currentRank++
+			}
+			prevScore = currentScore
+
+			// 如果我们只需要前 limit 个排名
+			if limit > 0 && currentRank > limit {
+				return rankings, nil
+			}
+
+			playerID, err := memberID(member)
+			if err != nil {
+				return nil, err
+			}
+			rankings = append(rankings, RankInfo{
+				PlayerID: playerID,
+				Score:    currentScore,
+				Rank:     currentRank,
+			})
+		}
+
+		if int64(len(results)) < denseFetchPageSize {
+			return rankings, nil
+		}
+	}
+}
+
+// DenseGroup 是密集排名中同一名次的所有玩家
+type DenseGroup struct {
+	Rank    int64      `json:"rank"`
+	Players []RankInfo `json:"players"`
+}
+
+// GetTopNDenseGrouped 与 GetTopNDense 相同, 但把同一名次的玩家合并为一组, limit 为返回的名次数, <= 0 表示全部
+// 组内顺序与排行榜一致, 即时间戳越早越靠前
+func (s *LeaderboardService) GetTopNDenseGrouped(ctx context.Context, limit int64) ([]DenseGroup, error) {
+	rankings, err := s.GetTopNDense(ctx, limit)
 	if err != nil {
 		return nil, err
 	}
+	groups := make([]DenseGroup, 0)
+	for _, r := range rankings {
+		if len(groups) == 0 || groups[len(groups)-1].Rank != r.Rank {
+			groups = append(groups, DenseGroup{Rank: r.Rank})
+		}
+		last := &groups[len(groups)-1]
+		last.Players = append(last.Players, r)
+	}
+	return groups, nil
+}
 
-	rankings := make([]RankInfo, 0)
-	if len(results) == 0 {
-		return rankings, nil
+// GetPlayerRankRangeDense 查询自己名次前后共 nRange 名玩家, 排名为相对整个排行榜的密集排名
+// 窗口与标准排名的 GetPlayerRankRange 相同; 为了得到窗口之前不同分数的个数,
+// 需要扫描窗口之前的所有玩家, 开销与玩家排名成正比
+func (s *LeaderboardService) GetPlayerRankRangeDense(ctx context.Context, playerID string, nRange int64) ([]RankInfo, error) {
+	if nRange <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, nRange)
+	}
+	rank, err := s.rdb.ZRevRank(ctx, leaderboardKey, playerID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
 	}
 
-	currentRank := int64(1)
-	// 添加第一名
-	firstPlayerScore := int64(results[0].Score / scoreMultiplier)
-	rankings = append(rankings, RankInfo{
-		PlayerID: results[0].Member.(string),
-		Score:    firstPlayerScore,
-		Rank:     currentRank,
-	})
+	start := rank - nRange/2
+	if start < 0 {
+		start = 0
+	}
+	// 窗口前一名玩家的密集排名即窗口之前不同分数的个数
+	currentRank, prevScore, err := s.distinctScoresBefore(ctx, start)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := 1; i < len(results); i++ {
-		currentScore := int64(results[i].Score / scoreMultiplier)
-		prevScore := int64(results[i-1].Score / scoreMultiplier)
+	results, err := s.rdb.ZRevRangeWithScores(ctx, leaderboardKey, start, start+nRange-1).Result()
+	if err != nil {
+		return nil, err
+	}
 
-		// 如果分数与上一个不同，排名+1
-		if currentScore < prevScore {
+	rankings := make([]RankInfo, len(results))
+	for i, member := range results {
+		playerID, err := memberID(member)
+		if err != nil {
+			return nil, err
+		}
+		currentScore := decodeScore(member.Score)
+		// 整个排行榜的第一名或分数与上一个不同，排名+1
+		if start == 0 && i == 0 || currentScore < prevScore {
 			currentRank++
 		}
+		prevScore = currentScore
+		rankings[i] = RankInfo{
+			PlayerID: playerID,
+			Score:    currentScore,
+			Rank:     currentRank,
+		}
+	}
+	return rankings, nil
+}
 
-		// 如果我们只需要前 limit 个排名
-		if limit > 0 && currentRank > limit {
-			break
+// GetNeighborsDense 返回玩家所在分数档位之前的 above 个档位、玩家所在档位以及之后的 below 个档位中的所有玩家, 排名为密集排名
+// 同分玩家属于同一档位, 因此返回的玩家数可能超过 above+below+1; 靠近榜首或榜尾时只截断不足的一侧
+// 档位从 distinctScoresKey 中读取, 玩家只需一次区间读取, 开销与覆盖档位内的人数成正比; 与 GetPlayerRankDense 相同, 必要时先重建索引
+func (s *LeaderboardService) GetNeighborsDense(ctx context.Context, playerID string, above, below int64) ([]RankInfo, error) {
+	if above < 0 || below < 0 {
+		return nil, fmt.Errorf("%w: above %d, below %d", ErrInvalidLimit, above, below)
+	}
+	if err := s.ensureDenseIndex(ctx); err != nil {
+		return nil, err
+	}
+	combinedScore, err := s.rdb.ZScore(ctx, leaderboardKey, playerID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
 		}
+		return nil, err
+	}
+	score := decodeScore(combinedScore)
+	scoreStr := strconv.FormatInt(score, 10)
+
+	pipe := s.rdb.Pipeline()
+	higherCmd := pipe.ZCount(ctx, distinctScoresKey, "("+scoreStr, "+inf")
+	var aboveCmd, belowCmd *redis.StringSliceCmd
+	// Count 为 0 时 go-redis 不发送 LIMIT, 因此不需要的一侧不查询
+	if above > 0 {
+		aboveCmd = pipe.ZRangeByScore(ctx, distinctScoresKey, &redis.ZRangeBy{Min: "(" + scoreStr, Max: "+inf", Count: above})
+	}
+	if below > 0 {
+		belowCmd = pipe.ZRevRangeByScore(ctx, distinctScoresKey, &redis.ZRangeBy{Min: "-inf", Max: "(" + scoreStr, Count: below})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	topScore, lowScore := score, score
+	aboveTiers := int64(0)
+	if aboveCmd != nil && len(aboveCmd.Val()) > 0 {
+		tiers := aboveCmd.Val()
+		aboveTiers = int64(len(tiers))
+		if topScore, err = strconv.ParseInt(tiers[len(tiers)-1], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if belowCmd != nil && len(belowCmd.Val()) > 0 {
+		tiers := belowCmd.Val()
+		if lowScore, err = strconv.ParseInt(tiers[len(tiers)-1], 10, 64); err != nil {
+			return nil, err
+		}
+	}
+
+	// 原始分数在 [lowScore, topScore] 内等价于组合分数在 [lowScore*scoreMultiplier, (topScore+1)*scoreMultiplier) 内
+	results, err := s.rdb.ZRevRangeByScoreWithScores(ctx, leaderboardKey, &redis.ZRangeBy{
+		Min: formatScore(float64(lowScore) * scoreMultiplier),
+		Max: "(" + formatScore(float64(topScore+1)*scoreMultiplier),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
 
-		rankings = append(rankings, RankInfo{
-			PlayerID: results[i].Member.(string),
+	// 玩家的密集排名为 higher+1, 第一个档位的密集排名为 higher+1-aboveTiers, 循环中遇到第一个玩家时加一
+	currentRank := higherCmd.Val() - aboveTiers
+	prevScore := int64(0)
+	rankings := make([]RankInfo, len(results))
+	for i, member := range results {
+		id, err := memberID(member)
+		if err != nil {
+			return nil, err
+		}
+		currentScore := decodeScore(member.Score)
+		if i == 0 || currentScore < prevScore {
+			currentRank++
+		}
+		prevScore = currentScore
+		rankings[i] = RankInfo{
+			PlayerID: id,
 			Score:    currentScore,
 			Rank:     currentRank,
-		})
+		}
 	}
 	return rankings, nil
 }
 
+// distinctScoresBefore 统计标准排名位于 [0, end) 的玩家中不同原始分数的个数, 并返回其中最后一名的原始分数
+func (s *LeaderboardService) distinctScoresBefore(ctx context.Context, end int64) (int64, int64, error) {
+	distinct := int64(0)
+	prevScore := int64(0)
+	for start := int64(0); start < end; start += denseFetchPageSize {
+		stop := start + denseFetchPageSize - 1
+		if stop > end-1 {
+			stop = end - 1
+		}
+		results, err := s.rdb.ZRevRangeWithScores(ctx, leaderboardKey, start, stop).Result()
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, member := range results {
+			currentScore := decodeScore(member.Score)
+			if distinct == 0 || currentScore < prevScore {
+				distinct++
+			}
+			prevScore = currentScore
+		}
+		if int64(len(results)) < stop-start+1 {
+			break
+		}
+	}
+	return distinct, prevScore, nil
+}
+
 // =================================================================
 // main 函数 - 用于演示和测试
 // =================================================================
 func main() {
+	ctx := context.Background()
 	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
-	_, err := rdb.Ping(context.Background()).Result()
+	_, err := rdb.Ping(ctx).Result()
 	if err != nil {
 		fmt.Printf("无法连接到 Redis: %v\n", err)
 		return
@@ -164,7 +530,7 @@ func main() {
 
 	// 准备测试数据并清理环境 ---
 	fmt.Println("--- 准备测试数据 (用于密集排名测试) ---")
-	rdb.Del(context.Background(), leaderboardKey)
+	rdb.Del(ctx, leaderboardKey, distinctScoresKey, scoreCountsKey, denseIndexBuiltKey)
 
 	players := []struct {
 		ID        string
@@ -180,7 +546,7 @@ func main() {
 	}
 
 	for _, p := range players {
-		service.UpdateScore(p.ID, p.Score, p.Timestamp)
+		service.UpdateScore(ctx, p.ID, p.Score, p.Timestamp)
 	}
 	fmt.Println("测试数据写入完成。")
 	fmt.Println("========================================")
@@ -188,7 +554,7 @@ func main() {
 	// 执行测试并打印结果 ---
 
 	fmt.Println("\n--- 对比：标准排名 (Top 6) ---")
-	top6, _ := service.GetTopN(6)
+	top6, _ := service.GetTopN(ctx, 6)
 	fmt.Println("名次 | 玩家ID   | 分数")
 	fmt.Println("-----|----------|------")
 	for _, p := range top6 {
@@ -198,7 +564,7 @@ func main() {
 
 	// 测试 GetTopNDense
 	fmt.Println("\n--- 测试：密集排名 (GetTopNDense) ---")
-	topDense, err := service.GetTopNDense(0) // limit=0 表示获取所有
+	topDense, err := service.GetTopNDense(ctx, 0) // limit=0 表示获取所有
 	if err != nil {
 		fmt.Printf("获取密集排名失败: %v\n", err)
 	} else {
@@ -214,7 +580,7 @@ func main() {
 	fmt.Println("\n--- 测试：查询单个玩家的密集排名 (GetPlayerRankDense) ---")
 	testPlayersForDenseRank := []string{"playerA", "playerB", "playerC", "playerF"}
 	for _, playerID := range testPlayersForDenseRank {
-		rankInfo, err := service.GetPlayerRankDense(playerID)
+		rankInfo, err := service.GetPlayerRankDense(ctx, playerID)
 		if err != nil {
 			fmt.Printf("查询玩家 %s 密集排名失败: %v\n", playerID, err)
 		} else {
@@ -222,4 +588,110 @@ func main() {
 		}
 	}
 	fmt.Println("========================================")
+
+	// 测试 GetTopNDense 跨页
+	fmt.Println("\n--- 测试：密集排名跨越多页 (500 名玩家, 前 150 名同分) ---")
+	rdb.Del(ctx, leaderboardKey, distinctScoresKey, scoreCountsKey, denseIndexBuiltKey)
+	for i := 0; i < 500; i++ {
+		score := int64(1000)
+		if i >= 150 {
+			score = int64(1000 - i)
+		}
+		service.UpdateScore(ctx, fmt.Sprintf("bulk%03d", i), score, time.Now().Unix()-int64(i))
+	}
+	topDense, err = service.GetTopNDense(ctx, 3)
+	if err != nil {
+		fmt.Printf("获取密集排名失败: %v\n", err)
+	} else {
+		countByRank := make(map[int64]int)
+		for _, p := range topDense {
+			countByRank[p.Rank]++
+		}
+		fmt.Printf("返回 %d 名玩家: 第1名 %d 人, 第2名 %d 人, 第3名 %d 人\n",
+			len(topDense), countByRank[1], countByRank[2], countByRank[3])
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetPlayerRankRangeDense
+	fmt.Println("\n--- 测试：密集排名的周边玩家 (GetPlayerRankRangeDense, bulk200 周边 5 名) ---")
+	rangeDense, err := service.GetPlayerRankRangeDense(ctx, "bulk200", 5)
+	if err != nil {
+		fmt.Printf("查询密集排名周边玩家失败: %v\n", err)
+	} else {
+		fmt.Println("名次 | 玩家ID   | 分数")
+		fmt.Println("-----|----------|------")
+		for _, p := range rangeDense {
+			fmt.Printf("%-4d | %-8s | %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试区间边界的格式化
+	fmt.Println("\n--- 测试：区间边界格式化 (Sprintf 的 6 位小数与 formatScore 对比) ---")
+	for _, v := range []float64{95*scoreMultiplier + (maxTimestampReversed - 1700000000), 0.0000001, 1.0000005} {
+		naive := fmt.Sprintf("%f", v)
+		naiveValue, _ := strconv.ParseFloat(naive, 64)
+		exact := formatScore(v)
+		exactValue, _ := strconv.ParseFloat(exact, 64)
+		fmt.Printf("值 %v: %%f=%s (还原相等=%v), formatScore=%s (还原相等=%v)\n",
+			v, naive, naiveValue == v, exact, exactValue == v)
+	}
+	for _, playerID := range []string{"bulk000", "bulk200"} {
+		if rankInfo, err := service.GetPlayerRankDense(ctx, playerID); err == nil {
+			fmt.Printf("玩家 %s: 密集排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试同分玩家的密集排名
+	fmt.Println("\n--- 测试：3 名玩家同分但时间戳不同 (GetPlayerRankDense) ---")
+	rdb.Del(ctx, leaderboardKey, distinctScoresKey, scoreCountsKey, denseIndexBuiltKey)
+	tieTs := time.Now().Unix()
+	service.UpdateScore(ctx, "tieTop", 300, tieTs)
+	for i, playerID := range []string{"tieA", "tieB", "tieC"} {
+		service.UpdateScore(ctx, playerID, 200, tieTs-int64(30-10*i))
+	}
+	service.UpdateScore(ctx, "tieLow", 100, tieTs)
+	// 期望: tieTop=1, tieA/tieB/tieC=2, tieLow=3
+	for _, playerID := range []string{"tieTop", "tieA", "tieB", "tieC", "tieLow"} {
+		if rankInfo, err := service.GetPlayerRankDense(ctx, playerID); err == nil {
+			fmt.Printf("玩家 %s: 密集排名=%d, 分数=%d\n", playerID, rankInfo.Rank, rankInfo.Score)
+		} else {
+			fmt.Printf("查询玩家 %s 密集排名失败: %v\n", playerID, err)
+		}
+	}
+	// tieLow 加到 200 后与三人并列, 分数 100 从不同分数集合中移除
+	service.UpdateScore(ctx, "tieLow", 100, tieTs)
+	distinctCount, _ := rdb.ZCard(ctx, distinctScoresKey).Result()
+	if rankInfo, err := service.GetPlayerRankDense(ctx, "tieLow"); err == nil {
+		fmt.Printf("tieLow 加分后: 密集排名=%d, 不同分数个数=%d\n", rankInfo.Rank, distinctCount)
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetTopNDenseGrouped
+	fmt.Println("\n--- 测试 GetTopNDenseGrouped (前 3 个名次, 同名次玩家合并为一组) ---")
+	groups, err := service.GetTopNDenseGrouped(ctx, 3)
+	if err != nil {
+		fmt.Printf("获取分组密集排名失败: %v\n", err)
+	} else {
+		for _, g := range groups {
+			fmt.Printf("第 %d 名: %d 人, 组内第一位 %s\n", g.Rank, len(g.Players), g.Players[0].PlayerID)
+		}
+	}
+	fmt.Println("========================================")
+
+	// 测试 GetNeighborsDense
+	fmt.Println("\n--- 测试 GetNeighborsDense (tieA 前后各 1 个档位, 同分玩家不占名额) ---")
+	service.UpdateScore(ctx, "tieBottom", 50, tieTs)
+	neighbors, err := service.GetNeighborsDense(ctx, "tieA", 1, 1)
+	if err != nil {
+		fmt.Printf("查询密集排名的邻居失败: %v\n", err)
+	} else {
+		fmt.Println("名次 | 玩家ID    | 分数")
+		fmt.Println("-----|-----------|------")
+		for _, p := range neighbors {
+			fmt.Printf("%-4d | %-9s | %d\n", p.Rank, p.PlayerID, p.Score)
+		}
+	}
+	fmt.Println("========================================")
 }
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ShardedLeaderboard 将一个排行榜按玩家 ID 的哈希分散到多个有序集合中, 用于单个 key 过大的场景
+// 分片 key 为 <key>:shard:{i}, 花括号是 Redis Cluster 的 hash tag, 使各分片分布到不同的 slot
+// 分数编码、排序方向和同分规则与 LeaderboardService 完全相同, 同一玩家始终落在同一个分片上
+// 全局排名是精确的: 查询排名时对每个分片做一次计数, GetTopN 对各分片的前 n 名做 k 路归并
+type ShardedLeaderboard struct {
+	rdb    redis.UniversalClient
+	svc    *LeaderboardService
+	shards int
+}
+
+// NewShardedLeaderboard 创建分片排行榜, rdb 可以是 *redis.Client 或 *redis.ClusterClient
+// opts 与 NewLeaderboardService 相同, 用于设置 key、排序方向、时间窗口等; shards 小于 1 时按 1 处理
+func NewShardedLeaderboard(rdb redis.UniversalClient, shards int, opts ...Option) *ShardedLeaderboard {
+	return &ShardedLeaderboard{
+		rdb:    rdb,
+		svc:    newLeaderboardService(nil, opts...),
+		shards: max(shards, 1),
+	}
+}
+
+// shardKey 返回第 i 个分片的 key
+func (b *ShardedLeaderboard) shardKey(i int) string {
+	return fmt.Sprintf("%s:shard:{%d}", b.svc.key(), i)
+}
+
+// keyFor 返回玩家所在分片的 key, 按原始玩家 ID 分片, 与 WithIDCodec 无关
+func (b *ShardedLeaderboard) keyFor(playerID string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(playerID))
+	return b.shardKey(int(h.Sum32() % uint32(b.shards)))
+}
+
+// UpdateScore 为玩家增加积分, 行为与 LeaderboardService.UpdateScore 相同
+func (b *ShardedLeaderboard) UpdateScore(ctx context.Context, playerID string, incrScore int64, timestamp int64) error {
+	if !b.svc.clampScores {
+		if err := checkIncr(incrScore); err != nil {
+			return fmt.Errorf("player %s: %w", playerID, err)
+		}
+	}
+	if err := b.svc.checkTimestamp(timestamp); err != nil {
+		return err
+	}
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return err
+	}
+	// 分片不维护分数桶计数, bucketWidth 固定为 0
+	args := b.svc.updateScoreArgs(member, incrScore, timestamp)
+	args[len(args)-1] = 0
+	err = updateScoreScript.Run(ctx, b.rdb, []string{b.keyFor(playerID)}, args...).Err()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
+	}
+	return err
+}
+
+// SetScore 直接设置玩家积分, 行为与 LeaderboardService.SetScore 相同
+func (b *ShardedLeaderboard) SetScore(ctx context.Context, playerID string, score int64, timestamp int64) error {
+	if score < b.svc.minScore || score > b.svc.maxScore {
+		if !b.svc.clampScores {
+			return fmt.Errorf("%w: player %s score %d", ErrScoreOutOfRange, playerID, score)
+		}
+		score = min(max(score, b.svc.minScore), b.svc.maxScore)
+	}
+	if err := b.svc.checkTimestamp(timestamp); err != nil {
+		return err
+	}
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return err
+	}
+	return b.rdb.ZAdd(ctx, b.keyFor(playerID), redis.Z{
+		Score:  b.svc.combineScore(score, timestamp),
+		Member: member,
+	}).Err()
+}
+
+// DeletePlayer 将玩家从排行榜中移除, 返回是否确实删除了成员
+func (b *ShardedLeaderboard) DeletePlayer(ctx context.Context, playerID string) (bool, error) {
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return false, err
+	}
+	removed, err := b.rdb.ZRem(ctx, b.keyFor(playerID), member).Result()
+	if err != nil {
+		return false, err
+	}
+	return removed > 0, nil
+}
+
+// ResetLeaderboard 删除所有分片
+// 各分片位于不同的 slot, 因此逐个 DEL 而不是一次删除多个 key
+func (b *ShardedLeaderboard) ResetLeaderboard(ctx context.Context) error {
+	pipe := b.rdb.Pipeline()
+	for i := 0; i < b.shards; i++ {
+		pipe.Del(ctx, b.shardKey(i))
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetPlayerCount 返回所有分片的玩家总数
+func (b *ShardedLeaderboard) GetPlayerCount(ctx context.Context) (int64, error) {
+	pipe := b.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, b.shards)
+	for i := range cmds {
+		cmds[i] = pipe.ZCard(ctx, b.shardKey(i))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, cmd := range cmds {
+		total += cmd.Val()
+	}
+	return total, nil
+}
+
+// GetPlayerRank 查询玩家的全局排名
+// 排名等于各分片中组合分数更靠前的人数之和加一; 组合分数完全相同的成员与单个 key 一样按成员字典序排列
+func (b *ShardedLeaderboard) GetPlayerRank(ctx context.Context, playerID string) (*RankInfo, error) {
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	combinedScore, err := b.rdb.ZScore(ctx, b.keyFor(playerID), member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+
+	scoreStr := formatScore(combinedScore)
+	pipe := b.rdb.Pipeline()
+	beyondCmds := make([]*redis.IntCmd, b.shards)
+	tiesCmds := make([]*redis.ZSliceCmd, b.shards)
+	for i := range beyondCmds {
+		key := b.shardKey(i)
+		beyondCmds[i] = b.svc.countBeyond(ctx, pipe, key, combinedScore)
+		tiesCmds[i] = b.svc.rangeBetweenScores(ctx, pipe, key, scoreStr, scoreStr)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	self := redis.Z{Score: combinedScore, Member: member}
+	rank := int64(1)
+	for i := range beyondCmds {
+		rank += beyondCmds[i].Val()
+		for _, z := range tiesCmds[i].Val() {
+			if b.svc.before(z, self) {
+				rank++
+			}
+		}
+	}
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, timestamp := b.svc.decodeScore(combinedScore)
+	return &RankInfo{
+		PlayerID:  playerID,
+		Score:     score,
+		Rank:      rank,
+		Timestamp: timestamp,
+		Found:     true,
+	}, nil
+}
+
+// GetTopN 获取全局前 n 名, n <= 0 时返回 ErrInvalidLimit
+// 先在一个 pipeline 中读取每个分片的前 n 名, 再按排名顺序做 k 路归并
+func (b *ShardedLeaderboard) GetTopN(ctx context.Context, n int64) ([]RankInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	pipe := b.rdb.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, b.shards)
+	for i := range cmds {
+		cmds[i] = b.svc.rangeWithScores(ctx, pipe, b.shardKey(i), 0, n-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	lists := make([][]redis.Z, b.shards)
+	for i, cmd := range cmds {
+		lists[i] = cmd.Val()
+	}
+	return b.svc.toRankInfos(b.svc.mergeTopN(lists, n), 1)
+}
+
+// mergeTopN 对按排名顺序排列的多个列表做 k 路归并, 返回合并后的前 n 项
+func (s *LeaderboardService) mergeTopN(lists [][]redis.Z, n int64) []redis.Z {
+	fetched := int64(0)
+	for _, list := range lists {
+		fetched += int64(len(list))
+	}
+	merged := make([]redis.Z, 0, min(n, fetched))
+	for int64(len(merged)) < n {
+		best := -1
+		for i, list := range lists {
+			if len(list) > 0 && (best < 0 || s.before(list[0], lists[best][0])) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		merged = append(merged, lists[best][0])
+		lists[best] = lists[best][1:]
+	}
+	return merged
+}
+
+// before 报告 x 是否排在 y 之前, 与 Redis 在单个有序集合中的顺序一致:
+// 组合分数按排序方向比较, 相同时降序按成员字典序倒序, 升序按字典序
+func (s *LeaderboardService) before(x, y redis.Z) bool {
+	if x.Score != y.Score {
+		return (x.Score > y.Score) != (s.order == Ascending)
+	}
+	xm, _ := x.Member.(string)
+	ym, _ := y.Member.(string)
+	if s.order == Ascending {
+		return xm < ym
+	}
+	return xm > ym
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// snapshotBatchSize 为 SnapshotRanks 每次读取和写入的成员数
+const snapshotBatchSize = 1000
+
+// ErrNotInSnapshot 表示玩家不在快照中, 通常是快照之后新加入的玩家
+var ErrNotInSnapshot = errors.New("player not in snapshot")
+
+// SnapshotRanks 将当前所有玩家的排名保存到哈希 snapshotKey (member -> rank) 中, 覆盖已有快照
+// 先用 ZUNIONSTORE 复制出排行榜的一致副本再分批写入, 写完后才替换 snapshotKey, 读者不会看到写了一半的快照
+func (s *LeaderboardService) SnapshotRanks(ctx context.Context, snapshotKey string) (err error) {
+	defer s.observe(&ctx, "SnapshotRanks")(&err)
+	if err := s.requireRedis("SnapshotRanks"); err != nil {
+		return err
+	}
+	copyKey := snapshotKey + ":tmp:board"
+	tmpKey := snapshotKey + ":tmp"
+	defer s.rdb.Del(context.WithoutCancel(ctx), copyKey, tmpKey)
+
+	if err := s.rdb.Del(ctx, tmpKey).Err(); err != nil {
+		return err
+	}
+	total, err := s.rdb.ZUnionStore(ctx, copyKey, &redis.ZStore{Keys: []string{s.key()}}).Result()
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return s.rdb.Del(ctx, snapshotKey).Err()
+	}
+
+	for start := int64(0); start < total; start += snapshotBatchSize {
+		results, err := s.rangeWithScores(ctx, s.rdb, copyKey, start, start+snapshotBatchSize-1).Result()
+		if err != nil {
+			return err
+		}
+		values := make([]interface{}, 0, len(results)*2)
+		for i, z := range results {
+			// 快照哈希的字段与有序集合成员相同, 即 WithIDCodec 编码后的形式
+			member, err := memberID(z)
+			if err != nil {
+				return err
+			}
+			values = append(values, member, start+int64(i)+1)
+		}
+		if err := s.rdb.HSet(ctx, tmpKey, values...).Err(); err != nil {
+			return err
+		}
+	}
+	return s.rdb.Rename(ctx, tmpKey, snapshotKey).Err()
+}
+
+// GetRankChange 返回玩家相对快照 snapshotKey 的排名变化 previousRank - currentRank, 正数表示排名上升
+// 玩家不在快照中时返回 ErrNotInSnapshot, 不在当前排行榜上时返回 ErrPlayerNotFound
+func (s *LeaderboardService) GetRankChange(ctx context.Context, playerID string, snapshotKey string) (_ int64, err error) {
+	defer s.observePlayer(&ctx, "GetRankChange", playerID)(&err)
+	if err := s.requireRedis("GetRankChange"); err != nil {
+		return 0, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return 0, err
+	}
+	pipe := s.reader.Pipeline()
+	rankCmd := s.rank(ctx, pipe, s.key(), member)
+	previousCmd := pipe.HGet(ctx, snapshotKey, member)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+
+	rank, err := rankCmd.Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return 0, err
+	}
+	previous, err := previousCmd.Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, fmt.Errorf("%w: %s", ErrNotInSnapshot, playerID)
+		}
+		return 0, err
+	}
+	previousRank, err := strconv.ParseInt(previous, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return previousRank - (rank + 1), nil
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrRankOutOfRange 表示请求的排名小于 1 或超出了排行榜人数
+var ErrRankOutOfRange = errors.New("rank out of range")
+
+// BucketCount 是分数分布中一个区间 [Low, High) 内的玩家数
+// 低于第一个边界的下溢区间 Low 为 math.MinInt64, 不低于最后一个边界的上溢区间 High 为 math.MaxInt64
+type BucketCount struct {
+	Low   int64 `json:"low"`
+	High  int64 `json:"high"`
+	Count int64 `json:"count"`
+}
+
+// GetScoreDistribution 按给定的分数边界统计各区间内的玩家数
+// buckets 必须严格递增; 返回 len(buckets)+1 个区间, 依次为下溢区间、各 [buckets[i], buckets[i+1]) 区间和上溢区间
+// 分数恰好等于边界时计入以该边界为下界的区间
+func (s *LeaderboardService) GetScoreDistribution(ctx context.Context, buckets []int64) (_ []BucketCount, err error) {
+	defer s.observe(&ctx, "GetScoreDistribution")(&err)
+	if err := s.requireRedis("GetScoreDistribution"); err != nil {
+		return nil, err
+	}
+	if len(buckets) == 0 {
+		return nil, fmt.Errorf("at least one bucket boundary is required")
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, fmt.Errorf("bucket boundaries must be strictly increasing: %d after %d", buckets[i], buckets[i-1])
+		}
+	}
+
+	// 原始分数 >= b 等价于组合分数 >= b*scoreMultiplier
+	bounds := make([]string, len(buckets)+2)
+	bounds[0] = "-inf"
+	for i, b := range buckets {
+		bounds[i+1] = formatScore(float64(b) * scoreMultiplier)
+	}
+	bounds[len(bounds)-1] = "+inf"
+
+	key := s.key()
+	pipe := s.reader.Pipeline()
+	cmds := make([]*redis.IntCmd, len(buckets)+1)
+	for i := range cmds {
+		max := "(" + bounds[i+1]
+		if i == len(cmds)-1 {
+			max = bounds[i+1]
+		}
+		cmds[i] = pipe.ZCount(ctx, key, bounds[i], max)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make([]BucketCount, len(cmds))
+	for i, cmd := range cmds {
+		counts[i].Count = cmd.Val()
+		counts[i].Low = math.MinInt64
+		if i > 0 {
+			counts[i].Low = buckets[i-1]
+		}
+		counts[i].High = math.MaxInt64
+		if i < len(buckets) {
+			counts[i].High = buckets[i]
+		}
+	}
+	return counts, nil
+}
+
+// GetPlayerPercentile 返回玩家的百分位: 排名不高于该玩家的玩家 (含自己) 占总人数的百分比
+// 即 (total - rank + 1) / total * 100, 第一名 (包括只有一名玩家的排行榜) 为 100
+// 玩家不在排行榜上时返回错误
+func (s *LeaderboardService) GetPlayerPercentile(ctx context.Context, playerID string) (_ float64, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerPercentile", playerID)(&err)
+	if err := s.requireRedis("GetPlayerPercentile"); err != nil {
+		return 0, err
+	}
+	info, err := s.playerRankWithTotal(ctx, playerID)
+	if err != nil {
+		return 0, err
+	}
+	return float64(info.Total-info.Rank+1) / float64(info.Total) * 100, nil
+}
+
+// GetScoreAtRank 返回排名 rank (1-based) 的玩家的原始分数, 可用于确定奖励档位的分数线
+// rank < 1 或超出排行榜人数时返回 ErrRankOutOfRange
+func (s *LeaderboardService) GetScoreAtRank(ctx context.Context, rank int64) (_ int64, err error) {
+	defer s.observe(&ctx, "GetScoreAtRank")(&err)
+	if rank < 1 {
+		return 0, fmt.Errorf("%w: %d", ErrRankOutOfRange, rank)
+	}
+	results, err := s.rangeWithScores(ctx, s.readStore, s.key(), rank-1, rank-1).Result()
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, fmt.Errorf("%w: %d", ErrRankOutOfRange, rank)
+	}
+	if err := checkFinite(fmt.Sprint(results[0].Member), results[0].Score); err != nil {
+		return 0, err
+	}
+	score, _ := s.decodeScore(results[0].Score)
+	return score, nil
+}
+
+// CountInScoreRange 统计原始分数在 [minScore, maxScore] 内的玩家数, inclusiveMax 为 false 时上界不包含 maxScore
+// 原始分数区间换算为组合分数区间后直接用 ZCOUNT 计数, 不需要读取成员
+func (s *LeaderboardService) CountInScoreRange(ctx context.Context, minScore, maxScore int64, inclusiveMax bool) (_ int64, err error) {
+	defer s.observe(&ctx, "CountInScoreRange")(&err)
+	// 原始分数 >= minScore 等价于组合分数 >= minScore*scoreMultiplier,
+	// 原始分数 <= maxScore 等价于组合分数 < (maxScore+1)*scoreMultiplier
+	upper := maxScore
+	if inclusiveMax {
+		upper++
+	}
+	if upper <= minScore {
+		return 0, nil
+	}
+	low := float64(minScore) * scoreMultiplier
+	high := float64(upper) * scoreMultiplier
+	return s.readStore.ZCount(ctx, s.key(), formatScore(low), "("+formatScore(high)).Result()
+}
+
+// GetRankForScore 返回一个尚未上榜的玩家以原始分数 score 上榜时的名次, 用于写入前预览, 排行榜为空时返回 1
+// 名次为原始分数严格优于 score 的玩家数加 1, 即与 score 同分的玩家都排在其后时的名次; 实际名次还取决于写入时的时间戳
+// 换算为组合分数区间后用一条 ZCOUNT 计数, 不需要读取成员
+func (s *LeaderboardService) GetRankForScore(ctx context.Context, score int64) (_ int64, err error) {
+	defer s.observe(&ctx, "GetRankForScore")(&err)
+	if err := checkScore(score); err != nil {
+		return 0, err
+	}
+	var better int64
+	if s.order == Ascending {
+		// 原始分数 < score 等价于组合分数 < score*scoreMultiplier
+		better, err = s.readStore.ZCount(ctx, s.key(), "-inf", "("+formatScore(float64(score)*scoreMultiplier)).Result()
+	} else {
+		// 原始分数 > score 等价于组合分数 >= (score+1)*scoreMultiplier
+		better, err = s.readStore.ZCount(ctx, s.key(), formatScore(float64(score+1)*scoreMultiplier), "+inf").Result()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return better + 1, nil
+}
+
+// playerStatsScript 在一次往返中读取玩家的名次、组合分数、总人数和密集排名
+// 密集排名为排名更靠前的不同原始分数个数加 1: 每次取下一个更靠前的成员并跳过与其原始分数相同的所有成员,
+// 复杂度为 O(D·log(N)), D 为排名更靠前的不同原始分数个数
+// KEYS[1]: 排行榜 key, ARGV: playerID, scoreMultiplier, 升序时为 '1'
+// 玩家不存在时返回 nil, 否则返回 {名次 (0-based), 组合分数, 总人数, 密集排名}; 组合分数不是有限值时密集排名为 0
+// 只包含只读命令, 在 WithReadClient 的副本上执行, 修改时不能加入写命令
+var playerStatsScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[2])
+local function decode(combined)
+	local score = math.floor(combined / multiplier)
+	local part = combined - score * multiplier
+	if part < 0 then
+		score = score - 1
+	elseif part >= multiplier then
+		score = score + 1
+	end
+	return score
+end
+local raw = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not raw then
+	return false
+end
+local ascending = ARGV[3] == '1'
+local rank
+if ascending then
+	rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+else
+	rank = redis.call('ZREVRANK', KEYS[1], ARGV[1])
+end
+local total = redis.call('ZCARD', KEYS[1])
+local combined = tonumber(raw)
+if not combined or combined ~= combined or combined == math.huge or combined == -math.huge then
+	return {rank, raw, total, 0}
+end
+
+local score = decode(combined)
+local dense = 1
+while true do
+	local better
+	if ascending then
+		better = redis.call('ZREVRANGEBYSCORE', KEYS[1], '(' .. string.format('%.0f', score * multiplier), '-inf', 'WITHSCORES', 'LIMIT', 0, 1)
+	else
+		better = redis.call('ZRANGEBYSCORE', KEYS[1], string.format('%.0f', (score + 1) * multiplier), '+inf', 'WITHSCORES', 'LIMIT', 0, 1)
+	end
+	if #better == 0 then
+		break
+	end
+	dense = dense + 1
+	local value = tonumber(better[2])
+	-- 非有限的分数无法换算出下一个区间, 继续查询会一直返回同一个成员
+	if value ~= value or value == math.huge or value == -math.huge then
+		break
+	end
+	score = decode(value)
+end
+return {rank, raw, total, dense}
+`)
+
+// PlayerStats 汇总玩家在排行榜上的各项统计
+// JSON 中 RankInfo 的字段与 denseRank、percentile、total 位于同一层, 后三者总是出现
+type PlayerStats struct {
+	RankInfo
+	DenseRank  int64   `json:"denseRank"`  // 同分玩家共享名次且名次连续, 见 GetPlayerStats
+	Percentile float64 `json:"percentile"` // 与 GetPlayerPercentile 相同
+	Total      int64   `json:"total"`
+}
+
+// GetPlayerStats 返回玩家的排名、密集排名、原始分数、时间戳、百分位和排行榜总人数
+// 所有数据由一个 Lua 脚本在一次往返中读取, 结果相互一致; 密集排名只比较原始分数, 不受时间戳的影响
+// 开启 WithTiebreakKeys 时排名 (及百分位) 与 GetPlayerRank 一样按附加字段解决并列, 需要额外读取玩家所在的同分组
+// 脚本只读取数据, 配置了 WithReadClient 时在只读副本上执行; 玩家不存在时返回 ErrPlayerNotFound
+func (s *LeaderboardService) GetPlayerStats(ctx context.Context, playerID string) (_ *PlayerStats, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerStats", playerID)(&err)
+	if err := s.requireRedis("GetPlayerStats"); err != nil {
+		return nil, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	ascending := "0"
+	if s.order == Ascending {
+		ascending = "1"
+	}
+	key := s.key()
+	values, err := playerStatsScript.Run(ctx, s.reader, []string{key}, member, scoreMultiplier, ascending).Slice()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != 4 {
+		return nil, fmt.Errorf("unexpected player stats reply: %v", values)
+	}
+	rank, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	total, _ := values[2].(int64)
+	dense, _ := values[3].(int64)
+	combinedScore, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, fmt.Errorf("member %s score %q: %w", member, raw, err)
+	}
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, timestamp := s.decodeScore(combinedScore)
+	if s.resolvesTies() {
+		if rank, err = s.resolvedRank(ctx, key, member, score); err != nil {
+			return nil, err
+		}
+	}
+	stats := &PlayerStats{
+		RankInfo: RankInfo{
+			PlayerID:  playerID,
+			Score:     score,
+			Rank:      rank + 1,
+			Timestamp: timestamp,
+			Found:     true,
+		},
+		DenseRank:  dense,
+		Percentile: float64(total-rank) / float64(total) * 100,
+		Total:      total,
+	}
+	s.displayRank(&stats.RankInfo, nil)
+	return stats, nil
+}
+
+// distinctScoresScript 统计排行榜上不同原始分数的个数, 从最低分开始每次跳到下一个更高的原始分数
+// KEYS[1]: 排行榜 key, ARGV: scoreMultiplier; 存在非有限的组合分数时返回 -1
+// 与 playerStatsScript 相同, 只包含只读命令并在副本上执行
+var distinctScoresScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[1])
+local function decode(combined)
+	local score = math.floor(combined / multiplier)
+	local part = combined - score * multiplier
+	if part < 0 then
+		score = score - 1
+	elseif part >= multiplier then
+		score = score + 1
+	end
+	return score
+end
+local entry = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local count = 0
+while #entry > 0 do
+	local value = tonumber(entry[2])
+	if value ~= value or value == math.huge or value == -math.huge then
+		return -1
+	end
+	count = count + 1
+	local bound = string.format('%.0f', (decode(value) + 1) * multiplier)
+	entry = redis.call('ZRANGEBYSCORE', KEYS[1], bound, '+inf', 'WITHSCORES', 'LIMIT', 0, 1)
+end
+return count
+`)
+
+// GetDistinctScoreCount 返回排行榜上不同原始分数的个数, 即分数档位数, 同分不同时间戳的玩家只计一次; 排行榜为空时返回 0
+// 组合分数包含时间戳, 不能直接统计不同的组合分数; 这里不额外维护原始分数集合, 而是由 Lua 脚本从最低分开始逐档跳跃计数,
+// 代价为 O(D·log(N)), D 为档位数, 脚本执行期间会阻塞 Redis, 档位很多 (例如数十万) 时应缓存结果或降低调用频率
+// 存在非有限的组合分数时返回 ErrNonFiniteScore
+func (s *LeaderboardService) GetDistinctScoreCount(ctx context.Context) (_ int64, err error) {
+	defer s.observe(&ctx, "GetDistinctScoreCount")(&err)
+	if err := s.requireRedis("GetDistinctScoreCount"); err != nil {
+		return 0, err
+	}
+	key := s.key()
+	count, err := distinctScoresScript.Run(ctx, s.reader, []string{key}, scoreMultiplier).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("%w: leaderboard %s", ErrNonFiniteScore, key)
+	}
+	return count, nil
+}
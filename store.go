@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"ranking/memstore"
+)
+
+var (
+	_ RankStore = redisStore{}
+	_ RankStore = (*memstore.Store)(nil)
+)
+
+// rankReader 是按排序方向读取排名所需的操作, RankStore 和 redis.Pipeliner 都满足该接口
+type rankReader interface {
+	ZRank(ctx context.Context, key, member string) *redis.IntCmd
+	ZRevRank(ctx context.Context, key, member string) *redis.IntCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZRevRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+}
+
+// RankStore 抽象了排行榜核心读写所依赖的有序集合操作
+// 除 IncrScore 外的方法签名与 go-redis 一致, 语义 (包括同分时按成员字典序排列) 也必须与 Redis 相同
+type RankStore interface {
+	rankReader
+	ZAdd(ctx context.Context, key string, members ...redis.Z) *redis.IntCmd
+	ZScore(ctx context.Context, key, member string) *redis.FloatCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+	ZCount(ctx context.Context, key, min, max string) *redis.IntCmd
+
+	// IncrScore 原子地为 member 的原始分数增加 incr, 并以 tiebreak 作为新的时间戳部分
+	// 新分数超出 [minScore, maxScore] 时, clamp 为 true 则截断到区间内, 否则不写入并返回 redis.Nil
+	// staleCheck 与返回值的含义同 updateScoreScript: 更新返回 1, 新建成员返回 2, 时间戳过旧返回 0, 发生截断时再加 4
+	IncrScore(ctx context.Context, key, member string, incr, tiebreak int64, staleCheck int, minScore, maxScore int64, clamp bool) *redis.Cmd
+}
+
+// ErrRedisRequired 表示调用的方法依赖 pipeline、Lua 脚本等 Redis 特性, 而服务由 NewLeaderboardServiceWithStore 基于 RankStore 创建
+var ErrRedisRequired = errors.New("method requires a Redis client")
+
+// requireRedis 在服务没有 Redis 客户端时返回 ErrRedisRequired, op 为调用的方法名
+func (s *LeaderboardService) requireRedis(op string) error {
+	if s.rdb == nil {
+		return fmt.Errorf("%w: %s", ErrRedisRequired, op)
+	}
+	return nil
+}
+
+// redisStore 是基于 Redis 的 RankStore 实现
+type redisStore struct {
+	*redis.Client
+}
+
+func (r redisStore) IncrScore(ctx context.Context, key, member string, incr, tiebreak int64, staleCheck int, minScore, maxScore int64, clamp bool) *redis.Cmd {
+	clampArg := 0
+	if clamp {
+		clampArg = 1
+	}
+	return updateScoreScript.Run(ctx, r.Client, []string{key},
+		member, incr, tiebreak, scoreMultiplier, minScore, maxScore, staleCheck, clampArg, 0)
+}
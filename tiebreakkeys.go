@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TiebreakKey 是同分玩家之间的一级附加排序字段, 值越大越靠前, Ascending 为 true 时值越小越靠前
+type TiebreakKey struct {
+	Field     string
+	Ascending bool
+}
+
+// WithTiebreakKeys 设置原始分数相同时依次比较的附加字段, 例如 "分数高者优先, 其次击杀数多者优先, 再次时间戳早者优先"
+// 写作 WithTiebreakKeys(TiebreakKey{Field: "kills"}); 所有附加字段都相同时仍按 TiebreakMode 排序
+// 字段值通过 SetTiebreakValues 保存在每个玩家的哈希 <key>:tiebreak:<playerID> 中, 缺失的字段按 0 处理
+//
+// 组合分数只能容纳一级同分规则, 附加字段在客户端解决: GetTopN、GetTopNPaged、GetRankRange 和 GetPlayerRank
+// 会把结果扩展到完整的同分组, 只对包含多名玩家的同分组读取附加字段并重新排序, 没有并列时不会产生额外读取;
+// GetPlayerRank 改为用一个 Lua 脚本在一次往返中读取名次、分数和同分组的范围, 与他人同分时再读取同分组及其附加字段;
+// 同分组很大 (例如大量玩家停留在 0 分) 时需要读取整个组, 其他方法仍按存储的顺序返回; 需要 Redis, 对 RankStore 创建的服务无效
+func WithTiebreakKeys(keys ...TiebreakKey) Option {
+	return func(s *LeaderboardService) {
+		s.tiebreakKeys = slices.Clone(keys)
+	}
+}
+
+// tiebreakValuesKey 返回玩家附加排序字段哈希的 key, member 为编码后的成员
+func (s *LeaderboardService) tiebreakValuesKey(key, member string) string {
+	return key + ":tiebreak:" + member
+}
+
+// SetTiebreakValues 写入玩家的附加排序字段, 只覆盖 values 中给出的字段, 见 WithTiebreakKeys
+func (s *LeaderboardService) SetTiebreakValues(ctx context.Context, playerID string, values map[string]int64) (err error) {
+	defer s.observePlayer(&ctx, "SetTiebreakValues", playerID)(&err)
+	if err := s.requireRedis("SetTiebreakValues"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if len(values) == 0 {
+		return nil
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		fields[field] = value
+	}
+	key := s.key()
+	if err := s.rdb.HSet(ctx, s.tiebreakValuesKey(key, member), fields).Err(); err != nil {
+		return err
+	}
+	s.invalidateCached(key, playerID)
+	return nil
+}
+
+// resolvesTies 报告是否需要按附加字段重新排序同分玩家
+func (s *LeaderboardService) resolvesTies() bool {
+	return len(s.tiebreakKeys) > 0 && s.reader != nil
+}
+
+// rangeResolved 与 rangeWithScores 相同, 但开启 WithTiebreakKeys 时按附加字段重新排序同分玩家后再截取 [start, stop]
+func (s *LeaderboardService) rangeResolved(ctx context.Context, key string, start, stop int64) ([]redis.Z, error) {
+	results, err := s.rangeWithScores(ctx, s.readStore, key, start, stop).Result()
+	if err != nil || !s.resolvesTies() || len(results) == 0 {
+		return results, err
+	}
+	first, last := results[0], results[len(results)-1]
+	if checkFinite("", first.Score) != nil || checkFinite("", last.Score) != nil {
+		// 交给 toRankInfos 报告 ErrNonFiniteScore
+		return results, nil
+	}
+
+	// 把区间扩展到两端完整的同分组
+	firstScore, _ := s.decodeScore(first.Score)
+	lastScore, _ := s.decodeScore(last.Score)
+	pipe := s.reader.Pipeline()
+	beforeCmd := s.countBetter(ctx, pipe, key, firstScore)
+	throughCmd := s.countBetter(ctx, pipe, key, lastScore+s.scoreStep())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	groupStart, groupEnd := beforeCmd.Val(), throughCmd.Val()-1
+	if groupStart < start || groupEnd > stop {
+		if results, err = s.rangeWithScores(ctx, s.readStore, key, groupStart, groupEnd).Result(); err != nil {
+			return nil, err
+		}
+	} else {
+		groupStart = start
+	}
+	if err := s.sortTies(ctx, key, results); err != nil {
+		return nil, err
+	}
+	from := min(start-groupStart, int64(len(results)))
+	to := min(stop-groupStart+1, int64(len(results)))
+	return results[from:to], nil
+}
+
+// scoreStep 是排名方向上 "更差一分" 的原始分数差: 降序时为 -1, 升序时为 1
+// countBetter(score + scoreStep()) 即原始分数不差于 score 的玩家数
+func (s *LeaderboardService) scoreStep() int64 {
+	if s.order == Ascending {
+		return 1
+	}
+	return -1
+}
+
+// countBetter 在 c 中加入统计原始分数严格优于 score 的玩家数的 ZCOUNT
+func (s *LeaderboardService) countBetter(ctx context.Context, c redis.Cmdable, key string, score int64) *redis.IntCmd {
+	if s.order == Ascending {
+		return c.ZCount(ctx, key, "-inf", "("+formatScore(float64(score)*scoreMultiplier))
+	}
+	return c.ZCount(ctx, key, formatScore(float64(score+1)*scoreMultiplier), "+inf")
+}
+
+// sortTies 在 results (按存储顺序排列的连续成员) 中找出原始分数相同的组, 读取附加字段后在组内稳定排序
+func (s *LeaderboardService) sortTies(ctx context.Context, key string, results []redis.Z) error {
+	type group struct{ start, end int }
+	var groups []group
+	for i := 0; i < len(results); {
+		score, _ := s.decodeScore(results[i].Score)
+		j := i + 1
+		for j < len(results) {
+			next, _ := s.decodeScore(results[j].Score)
+			if next != score {
+				break
+			}
+			j++
+		}
+		if j-i > 1 {
+			groups = append(groups, group{i, j})
+		}
+		i = j
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+
+	fields := make([]string, len(s.tiebreakKeys))
+	for i, k := range s.tiebreakKeys {
+		fields[i] = k.Field
+	}
+	pipe := s.reader.Pipeline()
+	cmds := make(map[string]*redis.SliceCmd)
+	for _, g := range groups {
+		for _, z := range results[g.start:g.end] {
+			member, err := memberID(z)
+			if err != nil {
+				return err
+			}
+			cmds[member] = pipe.HMGet(ctx, s.tiebreakValuesKey(key, member), fields...)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	values := make(map[string][]int64, len(cmds))
+	for member, cmd := range cmds {
+		parsed := make([]int64, len(fields))
+		for i, v := range cmd.Val() {
+			if str, ok := v.(string); ok {
+				parsed[i], _ = strconv.ParseInt(str, 10, 64)
+			}
+		}
+		values[member] = parsed
+	}
+
+	for _, g := range groups {
+		slices.SortStableFunc(results[g.start:g.end], func(a, b redis.Z) int {
+			va, vb := values[a.Member.(string)], values[b.Member.(string)]
+			for i, k := range s.tiebreakKeys {
+				if va[i] == vb[i] {
+					continue
+				}
+				if (va[i] > vb[i]) != k.Ascending {
+					return -1
+				}
+				return 1
+			}
+			return 0
+		})
+	}
+	return nil
+}
+
+// tiedRankScript 在一次往返中读取成员的名次、组合分数以及原始分数与其相同的同分组在排行榜中的范围
+// KEYS[1]: 排行榜 key, ARGV: member, scoreMultiplier, 升序时为 '1'
+// 成员不存在时返回 nil, 否则返回 {名次 (0-based), 组合分数, 同分组的起始名次, 同分组之后的名次}; 组合分数不是有限值时后两项为 0
+// 与 playerStatsScript 相同, 只包含只读命令并在 WithReadClient 的副本上执行
+var tiedRankScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[2])
+local raw = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if not raw then
+	return false
+end
+local ascending = ARGV[3] == '1'
+local rank
+if ascending then
+	rank = redis.call('ZRANK', KEYS[1], ARGV[1])
+else
+	rank = redis.call('ZREVRANK', KEYS[1], ARGV[1])
+end
+local combined = tonumber(raw)
+if not combined or combined ~= combined or combined == math.huge or combined == -math.huge then
+	return {rank, raw, 0, 0}
+end
+local score = math.floor(combined / multiplier)
+local part = combined - score * multiplier
+if part < 0 then
+	score = score - 1
+elseif part >= multiplier then
+	score = score + 1
+end
+local low = string.format('%.0f', score * multiplier)
+local high = string.format('%.0f', (score + 1) * multiplier)
+if ascending then
+	return {rank, raw, redis.call('ZCOUNT', KEYS[1], '-inf', '(' .. low), redis.call('ZCOUNT', KEYS[1], '-inf', '(' .. high)}
+end
+return {rank, raw, redis.call('ZCOUNT', KEYS[1], high, '+inf'), redis.call('ZCOUNT', KEYS[1], low, '+inf')}
+`)
+
+// resolvedRankAndScore 与 rankAndScore 相同, 但返回的名次已按附加字段解决并列, 只在开启 WithTiebreakKeys 时使用
+// 名次、组合分数和同分组的范围由 tiedRankScript 一次读取, 玩家没有与他人同分时不需要其他往返
+func (s *LeaderboardService) resolvedRankAndScore(ctx context.Context, key, member string) (int64, float64, error) {
+	ascending := "0"
+	if s.order == Ascending {
+		ascending = "1"
+	}
+	values, err := tiedRankScript.Run(ctx, s.reader, []string{key}, member, scoreMultiplier, ascending).Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(values) != 4 {
+		return 0, 0, fmt.Errorf("unexpected tied rank reply: %v", values)
+	}
+	rank, _ := values[0].(int64)
+	raw, _ := values[1].(string)
+	groupStart, _ := values[2].(int64)
+	groupEnd, _ := values[3].(int64)
+	combinedScore, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("member %s score %q: %w", member, raw, err)
+	}
+	if groupEnd-groupStart <= 1 {
+		return rank, combinedScore, nil
+	}
+	rank, err = s.rankInGroup(ctx, key, member, groupStart, groupEnd-1)
+	return rank, combinedScore, err
+}
+
+// resolvedRank 返回开启 WithTiebreakKeys 时成员按附加字段解决并列后的 0-based 名次, score 为其原始分数
+// 先用一个 pipeline 统计同分组的范围, 与他人同分时再读取同分组
+func (s *LeaderboardService) resolvedRank(ctx context.Context, key, member string, score int64) (int64, error) {
+	pipe := s.reader.Pipeline()
+	beforeCmd := s.countBetter(ctx, pipe, key, score)
+	throughCmd := s.countBetter(ctx, pipe, key, score+s.scoreStep())
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	groupStart, groupEnd := beforeCmd.Val(), throughCmd.Val()-1
+	if groupEnd <= groupStart {
+		return groupStart, nil
+	}
+	return s.rankInGroup(ctx, key, member, groupStart, groupEnd)
+}
+
+// rankInGroup 读取名次在 [groupStart, groupEnd] 内的同分组并按附加字段排序, 返回 member 解决并列后的 0-based 名次
+func (s *LeaderboardService) rankInGroup(ctx context.Context, key, member string, groupStart, groupEnd int64) (int64, error) {
+	group, err := s.rangeWithScores(ctx, s.readStore, key, groupStart, groupEnd).Result()
+	if err != nil {
+		return 0, err
+	}
+	if err := s.sortTies(ctx, key, group); err != nil {
+		return 0, err
+	}
+	for i, z := range group {
+		if z.Member == member {
+			return groupStart + int64(i), nil
+		}
+	}
+	// 读取期间玩家的分数发生了变化, 退回到组的开头
+	return groupStart, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import "context"
+
+// tieScanBatchSize 是 GetTieGroups 每次从排行榜读取的成员数
+const tieScanBatchSize = 1000
+
+// TieGroup 是原始分数相同的一组玩家
+type TieGroup struct {
+	Score     int64    `json:"score"`
+	Count     int64    `json:"count"`
+	PlayerIDs []string `json:"playerIds"` // 按排名顺序排列, 即按 TiebreakMode 决定的同分顺序
+}
+
+// GetTieGroups 按排名顺序 (降序排行榜即分数从高到低) 返回排行榜上的每个不同原始分数及其玩家, 用于审计并列情况
+// 只有一名玩家的分数同样返回一组, Count 为 1; limit > 0 时最多返回前 limit 组并在凑满后停止读取, <= 0 表示扫描整个排行榜
+// 每次读取 tieScanBatchSize 个成员, 不会一次性载入全部成员; 扫描期间若有写入, 结果可能出现重复或遗漏
+func (s *LeaderboardService) GetTieGroups(ctx context.Context, limit int64) (_ []TieGroup, err error) {
+	defer s.observe(&ctx, "GetTieGroups")(&err)
+	key := s.key()
+	groups := make([]TieGroup, 0)
+	for start := int64(0); ; start += tieScanBatchSize {
+		results, err := s.rangeWithScores(ctx, s.readStore, key, start, start+tieScanBatchSize-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		infos, err := s.toRankInfos(results, start+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if len(groups) == 0 || groups[len(groups)-1].Score != info.Score {
+				if limit > 0 && int64(len(groups)) == limit {
+					// 第 limit+1 组开始, 前 limit 组都已完整
+					return groups, nil
+				}
+				groups = append(groups, TieGroup{Score: info.Score})
+			}
+			last := &groups[len(groups)-1]
+			last.Count++
+			last.PlayerIDs = append(last.PlayerIDs, info.PlayerID)
+		}
+		if int64(len(results)) < tieScanBatchSize {
+			return groups, nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// TimestampUnit 表示调用方传入的时间戳的单位
+type TimestampUnit int
+
+const (
+	// TimestampSeconds 秒级 Unix 时间戳 (默认)
+	TimestampSeconds TimestampUnit = iota
+	// TimestampMilliseconds 毫秒级 Unix 时间戳
+	TimestampMilliseconds
+)
+
+// millisecondEpoch 是毫秒级时间戳的编码起点 (2020-01-01T00:00:00Z)
+// 组合分数中的时间戳部分只有 scoreMultiplier (1e12) 个取值, 直接存放毫秒级 Unix 时间戳会溢出到分数位,
+// 因此毫秒时间戳先减去该起点再编码, 可表示的范围约为 2020 年到 2051 年, 原始分数的安全范围不受影响
+const millisecondEpoch = 1577836800000
+
+// WithTimestampUnit 设置时间戳的单位, 默认为秒
+// 切换单位会改变时间戳部分的编码, 与 TiebreakMode 一样, 已存储的数据需要清空或重新导入
+func WithTimestampUnit(unit TimestampUnit) Option {
+	return func(s *LeaderboardService) {
+		s.timestampUnit = unit
+	}
+}
+
+// WithServerTimestamps 让写入方法在调用方传入的 timestamp 为 0 时改用 Redis 服务器的 TIME 作为时间戳
+// 多个服务共同写入时所有时间戳都来自同一个时钟, 避免某个服务的时钟偏差在同分比较中占到便宜; 传入非 0 的时间戳时照常使用,
+// 对 UpdateScore (及其变体)、UpdateScoreWithOpts、UpdateScoresBatch、SetScore、RecordBest 和 UpdateMetrics 生效,
+// 每次需要服务器时间的写入会多一次往返 (UpdateScoresBatch 整批只读取一次); 需要 Redis, 对 RankStore 创建的服务无效
+func WithServerTimestamps() Option {
+	return func(s *LeaderboardService) {
+		s.serverTimestamps = true
+	}
+}
+
+// resolveTimestamp 在开启 WithServerTimestamps 且 timestamp 为 0 时按 timestampUnit 返回 Redis 服务器的当前时间, 否则原样返回
+func (s *LeaderboardService) resolveTimestamp(ctx context.Context, timestamp int64) (int64, error) {
+	if !s.serverTimestamps || timestamp != 0 || s.rdb == nil {
+		return timestamp, nil
+	}
+	now, err := s.rdb.Time(ctx).Result()
+	if err != nil {
+		return 0, err
+	}
+	if s.timestampUnit == TimestampMilliseconds {
+		return now.UnixMilli(), nil
+	}
+	return now.Unix(), nil
+}
+
+// now 按 timestampUnit 返回本机的当前时间戳
+func (s *LeaderboardService) now() int64 {
+	if s.timestampUnit == TimestampMilliseconds {
+		return time.Now().UnixMilli()
+	}
+	return time.Now().Unix()
+}
+
+// timestampOffset 返回编码前从时间戳中减去的起点
+func (s *LeaderboardService) timestampOffset() int64 {
+	if s.timestampUnit == TimestampMilliseconds {
+		return millisecondEpoch
+	}
+	return 0
+}
+
+// timeOf 将按 timestampUnit 解释的时间戳转换为 time.Time
+func (s *LeaderboardService) timeOf(timestamp int64) time.Time {
+	if s.timestampUnit == TimestampMilliseconds {
+		return time.UnixMilli(timestamp)
+	}
+	return time.Unix(timestamp, 0)
+}
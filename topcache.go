@@ -0,0 +1,108 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// WithTopNCache 在进程内缓存 GetTopN 的结果 ttl 时间, 用于首页等读远多于写的场景, ttl <= 0 时不开启
+// 本服务对缓存窗口内玩家的写入 (UpdateScore 及其变体、UpdateScoreWithOpts、UpdateScoresBatch、BulkLoad、SetScore、ResetPlayerScore、RecordBest、UpdateMetrics、SetTiebreakValues、MergePlayers、DeletePlayer、DeletePlayers)
+// 会立即让该窗口失效, ResetLeaderboard、ResetAndArchive、ApplyDecay、ImportJSON 和 ImportCompressed 清空全部缓存;
+// 其他进程的写入、不在窗口内的玩家新进入前 N 名都只能等缓存过期后才可见, 因此 ttl 也是结果可能滞后的最长时间
+func WithTopNCache(ttl time.Duration) Option {
+	return func(s *LeaderboardService) {
+		if ttl > 0 {
+			s.topCache = &topNCache{ttl: ttl, entries: make(map[topNCacheKey]*topNCacheEntry)}
+		}
+	}
+}
+
+// topNCache 是 GetTopN 的进程内缓存, 可被并发使用
+type topNCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[topNCacheKey]*topNCacheEntry
+	// generation 在每次失效时递增, 用于丢弃失效之前开始、失效之后才返回的 Redis 读取结果
+	generation uint64
+}
+
+// topNCacheKey 区分不同的排行榜 key (时间窗口) 和 n
+type topNCacheKey struct {
+	key string
+	n   int64
+}
+
+// topNCacheEntry 是一个缓存窗口, players 为窗口内的玩家 ID
+type topNCacheEntry struct {
+	rankings []RankInfo
+	players  map[string]struct{}
+	expires  time.Time
+}
+
+// get 返回未过期的缓存结果的副本, 以及读取 Redis 前应记录的 generation
+func (c *topNCache) get(key string, n int64) (_ []RankInfo, generation uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[topNCacheKey{key, n}]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, c.generation, false
+	}
+	return slices.Clone(entry.rankings), c.generation, true
+}
+
+// put 缓存从 Redis 读到的结果; 读取期间发生过失效时放弃写入, 避免缓存旧数据
+func (c *topNCache) put(key string, n int64, rankings []RankInfo, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	players := make(map[string]struct{}, len(rankings))
+	for _, r := range rankings {
+		players[r.PlayerID] = struct{}{}
+	}
+	c.entries[topNCacheKey{key, n}] = &topNCacheEntry{
+		rankings: slices.Clone(rankings),
+		players:  players,
+		expires:  now.Add(c.ttl),
+	}
+}
+
+// invalidate 让排行榜 key 上包含 playerID 的缓存窗口失效, c 为 nil 时不做任何事
+func (c *topNCache) invalidate(key string, playerIDs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for k, entry := range c.entries {
+		if k.key != key {
+			continue
+		}
+		for _, playerID := range playerIDs {
+			if _, ok := entry.players[playerID]; ok {
+				delete(c.entries, k)
+				break
+			}
+		}
+	}
+}
+
+// clear 清空所有缓存, c 为 nil 时不做任何事
+func (c *topNCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	clear(c.entries)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "context"
+
+// Tracer 为排行榜操作创建分布式追踪的 span, 服务本身不依赖任何追踪库
+// 对接 OpenTelemetry 时, Start 调用 trace.Tracer.Start(ctx, spanName) 并把 keysAndValues 转换为 attribute.String 等属性,
+// 返回的 Span 在 End 中对非 nil 的 err 调用 RecordError 和 SetStatus(codes.Error, err.Error()), 然后调用 End
+type Tracer interface {
+	// Start 开始一个名为 spanName 的 span, keysAndValues 为交替排列的属性键和值
+	// 返回的 context 应携带新的 span, 服务会用它执行本次操作内的 Redis 调用
+	Start(ctx context.Context, spanName string, keysAndValues ...interface{}) (context.Context, Span)
+}
+
+// Span 是 Tracer 创建的一个进行中的 span
+type Span interface {
+	// End 结束 span, err 为这次操作返回的错误, 不为 nil 时应将 span 标记为失败
+	End(err error)
+}
+
+// WithTracer 为每个公开方法开始一个名为 leaderboard.<方法名> (例如 leaderboard.UpdateScore) 的 span,
+// 属性包括 leaderboard.op, 以及参数中有玩家 ID 时的 player.id; 未设置时不创建 span, 也没有额外开销
+func WithTracer(tracer Tracer) Option {
+	return func(s *LeaderboardService) {
+		s.tracer = tracer
+	}
+}
+
+// startSpan 为 op 开始一个 span, playerID 为空时不设置 player.id 属性
+func (s *LeaderboardService) startSpan(ctx context.Context, op string, playerID string) (context.Context, Span) {
+	if playerID == "" {
+		return s.tracer.Start(ctx, "leaderboard."+op, "leaderboard.op", op)
+	}
+	return s.tracer.Start(ctx, "leaderboard."+op, "leaderboard.op", op, "player.id", playerID)
+}
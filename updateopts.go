@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrInvalidUpdateOpts 表示 UpdateOpts 中同时设置了互斥的选项
+var ErrInvalidUpdateOpts = errors.New("invalid update options")
+
+// UpdateOpts 是 UpdateScoreWithOpts 的写入条件, 含义与 Redis ZADD 的同名选项一致
+// GT/LT 比较的是原始分数而不是组合分数: 新旧原始分数相同 (只有时间戳不同) 时视为未变大也未变小, 不会写入
+type UpdateOpts struct {
+	NX   bool // 只在玩家不在排行榜上时写入
+	XX   bool // 只在玩家已在排行榜上时写入
+	GT   bool // 只在新分数大于旧分数时更新, 玩家不存在时照常写入
+	LT   bool // 只在新分数小于旧分数时更新, 玩家不存在时照常写入
+	Incr bool // score 为增量而不是新分数, 与 UpdateScore 相同
+}
+
+// validate 按 ZADD 的规则检查互斥的选项
+func (o UpdateOpts) validate() error {
+	switch {
+	case o.NX && o.XX:
+		return fmt.Errorf("%w: NX and XX", ErrInvalidUpdateOpts)
+	case o.GT && o.LT:
+		return fmt.Errorf("%w: GT and LT", ErrInvalidUpdateOpts)
+	case o.NX && (o.GT || o.LT):
+		return fmt.Errorf("%w: NX with GT or LT", ErrInvalidUpdateOpts)
+	}
+	return nil
+}
+
+// flags 将选项编码为 updateWithOptsScript 的 ARGV
+func (o UpdateOpts) flags() string {
+	flags := ""
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{{o.NX, "N"}, {o.XX, "X"}, {o.GT, "G"}, {o.LT, "L"}, {o.Incr, "I"}} {
+		if f.set {
+			flags += f.name
+		}
+	}
+	return flags
+}
+
+// updateWithOptsScript 按 UpdateOpts 的条件原子地写入玩家分数
+// KEYS[1]: 排行榜 key, KEYS[2] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: playerID, score (Incr 时为增量), tiebreak, scoreMultiplier, minScore, maxScore, staleCheck, clamp, bucketWidth, flags
+// flags 由 N/X/G/L/I 组成, 分别对应 NX/XX/GT/LT/Incr; staleCheck 与 clamp 的含义与 updateScoreScript 相同
+// 组合分数发生变化或新建玩家时返回 1, 条件不满足或写入的值与原值相同时返回 0; 分数超出区间且不截断时返回 nil
+var updateWithOptsScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[4])
+local tiebreak = tonumber(ARGV[3])
+local flags = ARGV[10]
+local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+if old and string.find(flags, 'N') then
+	return 0
+end
+if not old and string.find(flags, 'X') then
+	return 0
+end
+local oldScore = 0
+if old then
+	old = tonumber(old)
+	oldScore = math.floor(old / multiplier)
+	local part = old - oldScore * multiplier
+	if part < 0 then
+		oldScore = oldScore - 1
+		part = part + multiplier
+	elseif part >= multiplier then
+		oldScore = oldScore + 1
+		part = part - multiplier
+	end
+	local staleCheck = tonumber(ARGV[7])
+	if staleCheck ~= 0 and (part - tiebreak) * staleCheck <= 0 then
+		return 0
+	end
+end
+local newScore = tonumber(ARGV[2])
+if string.find(flags, 'I') then
+	newScore = oldScore + newScore
+end
+local minScore = tonumber(ARGV[5])
+local maxScore = tonumber(ARGV[6])
+if newScore < minScore or newScore > maxScore then
+	if ARGV[8] ~= '1' then
+		return false
+	end
+	newScore = math.min(math.max(newScore, minScore), maxScore)
+end
+if old then
+	if string.find(flags, 'G') and newScore <= oldScore then
+		return 0
+	end
+	if string.find(flags, 'L') and newScore >= oldScore then
+		return 0
+	end
+end
+local combined = newScore * multiplier + tiebreak
+if combined == old then
+	return 0
+end
+redis.call('ZADD', KEYS[1], combined, ARGV[1])
+if KEYS[2] then
+	local width = tonumber(ARGV[9])
+	if old then
+		redis.call('HINCRBY', KEYS[2], math.floor(oldScore / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[2], math.floor(newScore / width), 1)
+end
+return 1
+`)
+
+// UpdateScoreWithOpts 按 opts 的条件写入玩家分数, 返回排行榜是否发生变化 (与 ZADD CH 相同, 包括新建玩家)
+// opts.Incr 为 false 时 score 为新的原始分数, 否则为增量; UpdateScore 相当于 opts 只设置 Incr 的情况
+// 读取旧值、判断条件和写入在同一个 Lua 脚本中完成; 分数区间和 WithRejectStaleTimestamps 的处理与 UpdateScore 相同
+// 同时设置 NX 和 XX、GT 和 LT, 或 NX 与 GT/LT 时返回 ErrInvalidUpdateOpts
+func (s *LeaderboardService) UpdateScoreWithOpts(ctx context.Context, playerID string, score int64, timestamp int64, opts UpdateOpts) (changed bool, err error) {
+	defer s.observePlayer(&ctx, "UpdateScoreWithOpts", playerID)(&err)
+	if err := s.requireRedis("UpdateScoreWithOpts"); err != nil {
+		return false, err
+	}
+	return s.updateWithOpts(ctx, playerID, score, timestamp, opts, s.staleCheck())
+}
+
+// updateWithOpts 是 UpdateScoreWithOpts 的实现, staleCheck 代替 s.staleCheck() 作为脚本的 staleCheck 参数, 为 0 时不检查时间戳是否过旧
+func (s *LeaderboardService) updateWithOpts(ctx context.Context, playerID string, score int64, timestamp int64, opts UpdateOpts, staleCheck int) (changed bool, err error) {
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer done()
+	if err := opts.validate(); err != nil {
+		return false, err
+	}
+	if !s.clampScores {
+		check := checkScore
+		if opts.Incr {
+			check = checkIncr
+		}
+		if err := check(score); err != nil {
+			return false, fmt.Errorf("player %s: %w", playerID, err)
+		}
+	}
+	if timestamp, err = s.resolveTimestamp(ctx, timestamp); err != nil {
+		return false, err
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return false, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return false, err
+	}
+
+	key := s.key()
+	release, err := s.flushPending(ctx, key, []string{playerID})
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	notify := s.watchRank(ctx, key, member)
+	args := append(s.updateScoreArgs(member, score, timestamp), opts.flags())
+	args[6] = staleCheck
+	var cmd *redis.Cmd
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		cmd = updateWithOptsScript.Run(ctx, c, s.scriptKeys(key), args...)
+		return cmd
+	})
+	result, err := cmd.Int()
+	if errors.Is(err, redis.Nil) {
+		return false, fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
+	}
+	if err != nil {
+		return false, err
+	}
+	if result == 0 {
+		return false, nil
+	}
+	s.invalidateCached(key, playerID)
+	notify()
+	return true, nil
+}
+
+// ResetPlayerScore 把已在排行榜上的玩家的原始分数重置为 0 并保留其排名条目, 例如新赛季保留玩家资料的场景
+// 时间戳取当前时间 (开启 WithServerTimestamps 时为 Redis 服务器时间); 玩家不在排行榜上时返回 ErrPlayerNotFound, 不会新建
+// 0 分的组合分数为时间戳部分本身, 落在 [0, scoreMultiplier) 内, 因此总是排在所有正分之后、所有负分之前
+// 0 不在 WithScoreBounds 的区间内时按 SetScore 的规则截断或返回 ErrScoreOutOfRange; 重置不受 WithRejectStaleTimestamps 影响
+func (s *LeaderboardService) ResetPlayerScore(ctx context.Context, playerID string) (err error) {
+	defer s.observePlayer(&ctx, "ResetPlayerScore", playerID)(&err)
+	if err := s.requireRedis("ResetPlayerScore"); err != nil {
+		return err
+	}
+	timestamp := s.now()
+	if s.serverTimestamps {
+		if timestamp, err = s.resolveTimestamp(ctx, 0); err != nil {
+			return err
+		}
+	}
+	// 已存储的时间戳可能不早于当前时间 (同一秒内的更新, 或调用方传入的未来时间戳), 重置时不检查时间戳是否过旧
+	changed, err := s.updateWithOpts(ctx, playerID, 0, timestamp, UpdateOpts{XX: true}, 0)
+	if err != nil || changed {
+		return err
+	}
+	// 不检查过旧时, 未写入只可能是玩家不存在, 或分数和时间戳都与当前值相同 (已经是重置后的状态)
+	member, err := s.member(playerID)
+	if err != nil {
+		return err
+	}
+	if err := s.rdb.ZScore(ctx, s.key(), member).Err(); err != nil {
+		if errors.Is(err, redis.Nil) {
+			return fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidConfig 表示服务配置无法保证组合分数被 float64 精确表示, 或包含未知的选项取值
+var ErrInvalidConfig = errors.New("invalid leaderboard config")
+
+// maxExactInteger 是 float64 能连续精确表示的最大整数 2^53
+const maxExactInteger = 1 << 53
+
+// ValidateConfig 检查配置是否会在写入时损坏数据, 建议在 NewLeaderboardService 之后、开始写入之前调用
+// 依次检查枚举选项是否有效、分数区间与时间戳部分组合后是否仍在 float64 的精确整数范围内,
+// 以及当前时间能否按 TimestampUnit 编码; 所有问题合并在返回的错误中, 均可通过 errors.Is 匹配 ErrInvalidConfig
+func (s *LeaderboardService) ValidateConfig() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrInvalidConfig, fmt.Sprintf(format, args...)))
+	}
+
+	if s.order != Descending && s.order != Ascending {
+		invalid("unknown sort order %d", s.order)
+	}
+	if s.tiebreakMode < TiebreakEarliest || s.tiebreakMode > TiebreakPlayerID {
+		invalid("unknown tiebreak mode %d", s.tiebreakMode)
+	}
+	if s.timestampUnit != TimestampSeconds && s.timestampUnit != TimestampMilliseconds {
+		invalid("unknown timestamp unit %d", s.timestampUnit)
+	}
+	if s.window < WindowAllTime || s.window > WindowMonthly {
+		invalid("unknown window %d", s.window)
+	}
+
+	if s.minScore > s.maxScore {
+		invalid("score bounds [%d, %d] are empty", s.minScore, s.maxScore)
+	}
+	// 组合分数的取值范围为 [minScore*scoreMultiplier, maxScore*scoreMultiplier + scoreMultiplier-1]
+	multiplier := int64(scoreMultiplier)
+	if s.maxScore > (maxExactInteger-(multiplier-1))/multiplier {
+		invalid("max score %d with timestamp part up to %d exceeds float64 exact integer range 2^53", s.maxScore, multiplier-1)
+	}
+	if s.minScore < -maxExactInteger/multiplier {
+		invalid("min score %d exceeds float64 exact integer range -2^53", s.minScore)
+	}
+
+	if s.tiebreakMode != TiebreakPlayerID {
+		if err := s.checkTimestamp(s.now()); err != nil {
+			invalid("current time cannot be encoded in the timestamp part: %v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// versionedWriteScript 原子地写入 VersionedLeaderboard 中玩家的分数, 并在玩家升级到新版本时把他从旧版本的有序集合中移除
+// KEYS[1]: 玩家当前版本的哈希, KEYS[2]: 出现过的版本组成的有序集合, 各版本的有序集合由 ARGV[1] 加版本号拼出
+// ARGV: 版本 key 前缀, playerID, version, mode, value, tiebreak, scoreMultiplier, minScore, maxScore, clamp
+// mode 为 S (value 为新分数)、I (value 为增量) 或 D (删除玩家, 忽略 version 和 value)
+// 写入时返回 1; 玩家已在更新的版本上时不修改并返回 0; 分数超出区间且不截断时返回 nil; 删除时返回是否删除了玩家
+var versionedWriteScript = redis.NewScript(`
+local member = ARGV[2]
+local cur = redis.call('HGET', KEYS[1], member)
+local function leave(version)
+	local key = ARGV[1] .. version
+	redis.call('ZREM', key, member)
+	if redis.call('ZCARD', key) == 0 then
+		redis.call('ZREM', KEYS[2], version)
+	end
+end
+if ARGV[4] == 'D' then
+	if not cur then
+		return 0
+	end
+	leave(cur)
+	redis.call('HDEL', KEYS[1], member)
+	return 1
+end
+
+local version = tonumber(ARGV[3])
+if cur and tonumber(cur) > version then
+	return 0
+end
+local key = ARGV[1] .. ARGV[3]
+local multiplier = tonumber(ARGV[7])
+local newScore = tonumber(ARGV[5])
+if ARGV[4] == 'I' then
+	local old = nil
+	if cur and tonumber(cur) == version then
+		old = redis.call('ZSCORE', key, member)
+	end
+	if old then
+		old = tonumber(old)
+		local oldScore = math.floor(old / multiplier)
+		local part = old - oldScore * multiplier
+		if part < 0 then
+			oldScore = oldScore - 1
+		elseif part >= multiplier then
+			oldScore = oldScore + 1
+		end
+		newScore = oldScore + newScore
+	end
+end
+local minScore = tonumber(ARGV[8])
+local maxScore = tonumber(ARGV[9])
+if newScore < minScore or newScore > maxScore then
+	if ARGV[10] ~= '1' then
+		return false
+	end
+	newScore = math.min(math.max(newScore, minScore), maxScore)
+end
+if cur and tonumber(cur) < version then
+	leave(cur)
+end
+redis.call('ZADD', key, newScore * multiplier + tonumber(ARGV[6]), member)
+redis.call('HSET', KEYS[1], member, ARGV[3])
+redis.call('ZADD', KEYS[2], version, ARGV[3])
+return 1
+`)
+
+// VersionRankInfo 是 VersionedLeaderboard 中玩家的排名信息, Version 为玩家分数所属的版本
+type VersionRankInfo struct {
+	RankInfo
+	Version int64 `json:"version"`
+}
+
+// VersionedLeaderboard 是按 "版本, 分数, 时间戳" 三级排序的排行榜, 例如平衡性补丁发布后旧版本的分数总是排在新版本之后
+// 组合分数只能容纳分数和时间戳两级, 因此每个版本单独使用一个有序集合 <key>:version:<version>,
+// 并用 <key>:player_versions 记录每名玩家所在的版本、<key>:versions 记录出现过的版本;
+// 全局排名 = 更新版本的总人数 + 玩家在本版本内的排名, 版本内的分数编码、排序方向和同分规则与 LeaderboardService 相同
+// 一名玩家只属于一个版本: 以更新的版本写入时, 旧版本的分数被丢弃, 新版本的分数从 0 开始累加; 以更旧的版本写入会被忽略
+// 写入脚本按前缀拼出版本 key, 不支持 Redis Cluster; 不支持 WithApproxRank、WithRejectStaleTimestamps 等依赖 Lua 脚本的功能
+type VersionedLeaderboard struct {
+	rdb *redis.Client
+	svc *LeaderboardService
+}
+
+// NewVersionedLeaderboard 创建按版本分层的排行榜, opts 与 NewLeaderboardService 相同, 用于设置 key、排序方向、时间窗口等
+func NewVersionedLeaderboard(rdb *redis.Client, opts ...Option) *VersionedLeaderboard {
+	return &VersionedLeaderboard{rdb: rdb, svc: newLeaderboardService(nil, opts...)}
+}
+
+// versionPrefix 返回各版本有序集合 key 的公共前缀
+func (b *VersionedLeaderboard) versionPrefix() string {
+	return b.svc.key() + ":version:"
+}
+
+// playerVersionsKey 返回记录玩家所在版本的哈希
+func (b *VersionedLeaderboard) playerVersionsKey() string {
+	return b.svc.key() + ":player_versions"
+}
+
+// versionsKey 返回出现过的版本组成的有序集合
+func (b *VersionedLeaderboard) versionsKey() string {
+	return b.svc.key() + ":versions"
+}
+
+// write 执行 versionedWriteScript, 返回脚本的结果
+func (b *VersionedLeaderboard) write(ctx context.Context, playerID string, version int64, mode string, value int64, timestamp int64) (int64, error) {
+	if mode != "D" {
+		if err := b.svc.checkTimestamp(timestamp); err != nil {
+			return 0, err
+		}
+	}
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return 0, err
+	}
+	clamp := 0
+	if b.svc.clampScores {
+		clamp = 1
+	}
+	result, err := versionedWriteScript.Run(ctx, b.rdb, []string{b.playerVersionsKey(), b.versionsKey()},
+		b.versionPrefix(), member, version, mode, value, b.svc.tiebreak(timestamp), scoreMultiplier,
+		b.svc.minScore, b.svc.maxScore, clamp).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
+	}
+	return result, err
+}
+
+// UpdateScore 在 version 上为玩家增加积分, 返回更新是否被应用; 玩家已在更新的版本上时返回 false
+// 玩家此前在更旧的版本上时, 旧分数被丢弃, 新版本的分数即为 incrScore
+func (b *VersionedLeaderboard) UpdateScore(ctx context.Context, playerID string, version int64, incrScore int64, timestamp int64) (bool, error) {
+	if !b.svc.clampScores {
+		if err := checkIncr(incrScore); err != nil {
+			return false, fmt.Errorf("player %s: %w", playerID, err)
+		}
+	}
+	result, err := b.write(ctx, playerID, version, "I", incrScore, timestamp)
+	return result == 1, err
+}
+
+// SetScore 直接将玩家在 version 上的积分设置为 score, 分数区间的处理与 LeaderboardService.SetScore 相同, 返回值与 UpdateScore 相同
+func (b *VersionedLeaderboard) SetScore(ctx context.Context, playerID string, version int64, score int64, timestamp int64) (bool, error) {
+	result, err := b.write(ctx, playerID, version, "S", score, timestamp)
+	return result == 1, err
+}
+
+// DeletePlayer 将玩家从排行榜中移除, 返回是否确实删除了玩家
+func (b *VersionedLeaderboard) DeletePlayer(ctx context.Context, playerID string) (bool, error) {
+	result, err := b.write(ctx, playerID, 0, "D", 0, 0)
+	return result == 1, err
+}
+
+// versions 返回出现过的版本, 从新到旧排列
+func (b *VersionedLeaderboard) versions(ctx context.Context) ([]int64, error) {
+	values, err := b.rdb.ZRevRange(ctx, b.versionsKey(), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, len(values))
+	for i, v := range values {
+		if versions[i], err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("malformed version %q: %w", v, err)
+		}
+	}
+	return versions, nil
+}
+
+// GetPlayerRank 查询玩家的全局排名, 玩家不在排行榜上时返回 ErrPlayerNotFound
+func (b *VersionedLeaderboard) GetPlayerRank(ctx context.Context, playerID string) (*VersionRankInfo, error) {
+	member, err := b.svc.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	value, err := b.rdb.HGet(ctx, b.playerVersionsKey(), member).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("player %s: malformed version %q", playerID, value)
+	}
+	newer, err := b.rdb.ZRangeByScore(ctx, b.versionsKey(), &redis.ZRangeBy{Min: "(" + value, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	key := b.versionPrefix() + value
+	pipe := b.rdb.Pipeline()
+	rankCmd := b.svc.rank(ctx, pipe, key, member)
+	scoreCmd := pipe.ZScore(ctx, key, member)
+	newerCmds := make([]*redis.IntCmd, len(newer))
+	for i, v := range newer {
+		newerCmds[i] = pipe.ZCard(ctx, b.versionPrefix()+v)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		if errors.Is(err, redis.Nil) {
+			// 读取期间玩家被删除或升级到了新版本
+			return nil, fmt.Errorf("%w: %s", ErrPlayerNotFound, playerID)
+		}
+		return nil, err
+	}
+	rank := rankCmd.Val() + 1
+	for _, cmd := range newerCmds {
+		rank += cmd.Val()
+	}
+	combinedScore := scoreCmd.Val()
+	if err := checkFinite(playerID, combinedScore); err != nil {
+		return nil, err
+	}
+	score, timestamp := b.svc.decodeScore(combinedScore)
+	return &VersionRankInfo{
+		RankInfo: RankInfo{PlayerID: playerID, Score: score, Rank: rank, Timestamp: timestamp, Found: true},
+		Version:  version,
+	}, nil
+}
+
+// GetTopN 获取全局前 n 名, n <= 0 时返回 ErrInvalidLimit
+// 从最新的版本开始依次读取, 凑满 n 名后停止, 不会读取更旧的版本
+func (b *VersionedLeaderboard) GetTopN(ctx context.Context, n int64) ([]VersionRankInfo, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidLimit, n)
+	}
+	versions, err := b.versions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rankings := make([]VersionRankInfo, 0)
+	for _, version := range versions {
+		remaining := n - int64(len(rankings))
+		if remaining <= 0 {
+			break
+		}
+		key := b.versionPrefix() + strconv.FormatInt(version, 10)
+		results, err := b.svc.rangeWithScores(ctx, b.rdb, key, 0, remaining-1).Result()
+		if err != nil {
+			return nil, err
+		}
+		infos, err := b.svc.toRankInfos(results, int64(len(rankings))+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			rankings = append(rankings, VersionRankInfo{RankInfo: info, Version: version})
+		}
+	}
+	return rankings, nil
+}
+
+// GetPlayerCount 返回所有版本的玩家总数
+func (b *VersionedLeaderboard) GetPlayerCount(ctx context.Context) (int64, error) {
+	return b.rdb.HLen(ctx, b.playerVersionsKey()).Result()
+}
+
+// ResetLeaderboard 删除所有版本的数据
+func (b *VersionedLeaderboard) ResetLeaderboard(ctx context.Context) error {
+	versions, err := b.versions(ctx)
+	if err != nil {
+		return err
+	}
+	keys := []string{b.playerVersionsKey(), b.versionsKey()}
+	for _, version := range versions {
+		keys = append(keys, b.versionPrefix()+strconv.FormatInt(version, 10))
+	}
+	return b.rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// recomputeBatchSize 是 RecomputeAll 每次 ZSCAN 的建议数量
+const recomputeBatchSize = 1000
+
+// updateMetricsScript 原子地累加玩家的原始指标, 并按权重重新计算分数写入排行榜
+// KEYS[1]: 排行榜 key, KEYS[2]: 玩家的指标哈希, KEYS[3] (可选): 分数桶哈希, 见 WithApproxRank
+// ARGV: playerID, tiebreak, scoreMultiplier, minScore, maxScore, clamp, bucketWidth, n,
+// 之后是 n 组 (指标名, 增量), 再之后是若干组 (指标名, 权重)
+// 分数为所有已存储指标与权重乘积之和, 没有权重的指标不计入分数
+// 成功返回 1, 发生截断返回 5; 分数超出区间且不截断时不写入任何数据并返回 nil
+var updateMetricsScript = redis.NewScript(`
+local multiplier = tonumber(ARGV[3])
+local function decode(combined)
+	local score = math.floor(combined / multiplier)
+	local part = combined - score * multiplier
+	if part < 0 then
+		score = score - 1
+	elseif part >= multiplier then
+		score = score + 1
+	end
+	return score
+end
+local n = tonumber(ARGV[8])
+local values = {}
+local stored = redis.call('HGETALL', KEYS[2])
+for i = 1, #stored, 2 do
+	values[stored[i]] = tonumber(stored[i + 1])
+end
+for i = 9, 8 + n * 2, 2 do
+	values[ARGV[i]] = (values[ARGV[i]] or 0) + tonumber(ARGV[i + 1])
+end
+local score = 0
+for i = 9 + n * 2, #ARGV, 2 do
+	score = score + (values[ARGV[i]] or 0) * tonumber(ARGV[i + 1])
+end
+
+local result = 1
+local minScore, maxScore = tonumber(ARGV[4]), tonumber(ARGV[5])
+if score < minScore or score > maxScore then
+	if ARGV[6] ~= '1' then
+		return false
+	end
+	score = math.min(math.max(score, minScore), maxScore)
+	result = 5
+end
+
+for i = 9, 8 + n * 2, 2 do
+	redis.call('HINCRBY', KEYS[2], ARGV[i], ARGV[i + 1])
+end
+if KEYS[3] then
+	local width = tonumber(ARGV[7])
+	local old = redis.call('ZSCORE', KEYS[1], ARGV[1])
+	if old then
+		redis.call('HINCRBY', KEYS[3], math.floor(decode(tonumber(old)) / width), -1)
+	end
+	redis.call('HINCRBY', KEYS[3], math.floor(score / width), 1)
+end
+redis.call('ZADD', KEYS[1], score * multiplier + tonumber(ARGV[2]), ARGV[1])
+return result
+`)
+
+// WithMetricWeights 设置 UpdateMetrics 计算分数所用的指标权重, 例如 {"kills": 10, "assists": 5}
+// 权重为整数, 需要小数权重时可以把所有权重同乘一个倍数; 运行中可以通过 SetMetricWeights 修改
+func WithMetricWeights(weights map[string]int64) Option {
+	return func(s *LeaderboardService) {
+		s.setMetricWeights(weights)
+	}
+}
+
+// SetMetricWeights 替换指标权重, 只影响之后的 UpdateMetrics; 已有玩家的分数需要调用 RecomputeAll 重新计算
+func (s *LeaderboardService) SetMetricWeights(weights map[string]int64) {
+	s.setMetricWeights(weights)
+}
+
+// setMetricWeights 保存权重的副本, 避免调用方之后修改传入的 map
+func (s *LeaderboardService) setMetricWeights(weights map[string]int64) {
+	copied := make(map[string]int64, len(weights))
+	for name, weight := range weights {
+		copied[name] = weight
+	}
+	s.metricWeights.Store(&copied)
+}
+
+// weights 返回当前的指标权重, 未设置时返回 nil
+func (s *LeaderboardService) weights() map[string]int64 {
+	if w := s.metricWeights.Load(); w != nil {
+		return *w
+	}
+	return nil
+}
+
+// metricsKey 返回玩家原始指标哈希的 key, member 为编码后的成员
+func (s *LeaderboardService) metricsKey(key, member string) string {
+	return key + ":metrics:" + member
+}
+
+// weightedScore 按权重计算原始指标对应的分数
+func weightedScore(values map[string]int64, weights map[string]int64) int64 {
+	var score int64
+	for name, weight := range weights {
+		score += values[name] * weight
+	}
+	return score
+}
+
+// UpdateMetrics 为玩家累加原始指标 (例如击杀数、助攻数), 并以各指标与权重乘积之和作为新的分数
+// 原始指标保存在哈希 <key>:metrics:<playerID> 中, 以便权重修改后通过 RecomputeAll 重新计算;
+// 累加指标、计算分数和写入排行榜在同一个 Lua 脚本中完成, timestamp 的含义与 UpdateScore 相同
+// 分数超出 WithScoreBounds 的区间时按 UpdateScore 的规则截断或返回 ErrScoreOutOfRange, 后者不会写入任何指标
+func (s *LeaderboardService) UpdateMetrics(ctx context.Context, playerID string, metrics map[string]int64, timestamp int64) (err error) {
+	defer s.observePlayer(&ctx, "UpdateMetrics", playerID)(&err)
+	if err := s.requireRedis("UpdateMetrics"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if timestamp, err = s.resolveTimestamp(ctx, timestamp); err != nil {
+		return err
+	}
+	if err := s.checkTimestamp(timestamp); err != nil {
+		return err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return err
+	}
+	weights := s.weights()
+	clamp := 0
+	if s.clampScores {
+		clamp = 1
+	}
+	args := make([]interface{}, 0, 8+len(metrics)*2+len(weights)*2)
+	args = append(args, member, s.tiebreak(timestamp), scoreMultiplier,
+		s.minScore, s.maxScore, clamp, s.bucketWidth, len(metrics))
+	for name, incr := range metrics {
+		args = append(args, name, incr)
+	}
+	for name, weight := range weights {
+		args = append(args, name, weight)
+	}
+
+	key := s.key()
+	keys := []string{key, s.metricsKey(key, member)}
+	if s.bucketWidth > 0 {
+		keys = append(keys, s.bucketKey())
+	}
+	var cmd *redis.Cmd
+	s.writeWithExpiry(ctx, key, func(c redis.Cmdable) redis.Cmder {
+		cmd = updateMetricsScript.Run(ctx, c, keys, args...)
+		return cmd
+	})
+	err = cmd.Err()
+	if errors.Is(err, redis.Nil) {
+		return fmt.Errorf("%w: player %s", ErrScoreOutOfRange, playerID)
+	}
+	if err != nil {
+		return err
+	}
+	s.invalidateCached(key, playerID)
+	return nil
+}
+
+// RecomputeAll 按当前权重重新计算所有保存了原始指标的玩家分数, 时间戳部分保持不变, 用于修改权重之后
+// 通过 ZSCAN 遍历排行榜, 每批在一个 pipeline 中读取指标并写回分数, 没有原始指标的玩家保持原分数;
+// 重算期间的并发 UpdateMetrics 可能被旧权重的结果覆盖, 建议在低峰期执行
+// 超出分数区间且不截断的玩家不会被修改, 以 *ScoreUpdateError 的形式合并在返回的错误中
+func (s *LeaderboardService) RecomputeAll(ctx context.Context) (err error) {
+	defer s.observe(&ctx, "RecomputeAll")(&err)
+	if err := s.requireRedis("RecomputeAll"); err != nil {
+		return err
+	}
+	done, err := s.beginWrite(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	weights := s.weights()
+	key := s.key()
+	var errs []error
+	var cursor uint64
+	for {
+		var pairs []string
+		pairs, cursor, err = s.rdb.ZScan(ctx, key, cursor, "", recomputeBatchSize).Result()
+		if err != nil {
+			return err
+		}
+		if err := s.recomputeBatch(ctx, key, pairs, weights, &errs); err != nil {
+			return err
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if s.bucketWidth > 0 {
+		if err := s.rebuildRankBuckets(ctx); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// recomputeBatch 重新计算一批 ZSCAN 结果 (成员与组合分数交替排列) 的分数
+func (s *LeaderboardService) recomputeBatch(ctx context.Context, key string, pairs []string, weights map[string]int64, errs *[]error) error {
+	if len(pairs) == 0 {
+		return nil
+	}
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(pairs)/2)
+	for i := range cmds {
+		cmds[i] = pipe.HGetAll(ctx, s.metricsKey(key, pairs[i*2]))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	updates := make([]redis.Z, 0, len(cmds))
+	for i, cmd := range cmds {
+		if len(cmd.Val()) == 0 {
+			continue
+		}
+		member := pairs[i*2]
+		values := make(map[string]int64, len(cmd.Val()))
+		for name, value := range cmd.Val() {
+			values[name], _ = strconv.ParseInt(value, 10, 64)
+		}
+		score := weightedScore(values, weights)
+		if score < s.minScore || score > s.maxScore {
+			if !s.clampScores {
+				playerID, err := s.decodeMember(member)
+				if err != nil {
+					playerID = member
+				}
+				*errs = append(*errs, &ScoreUpdateError{PlayerID: playerID, Err: ErrScoreOutOfRange})
+				continue
+			}
+			score = min(max(score, s.minScore), s.maxScore)
+		}
+		combined, err := strconv.ParseFloat(pairs[i*2+1], 64)
+		if err != nil {
+			return err
+		}
+		if err := checkFinite(member, combined); err != nil {
+			return err
+		}
+		oldScore, _ := s.decodeScore(combined)
+		part := int64(combined) - oldScore*scoreMultiplier
+		updates = append(updates, redis.Z{Score: float64(score*scoreMultiplier + part), Member: member})
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	// 只更新仍在排行榜上的玩家, 避免把重算期间被删除的玩家加回来
+	return s.rdb.ZAddXX(ctx, key, updates...).Err()
+}
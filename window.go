@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WindowType 表示排行榜的时间窗口类型
+type WindowType int
+
+// allWindows 是 GetPlayerRankAllWindows 查询的全部窗口类型
+var allWindows = []WindowType{WindowAllTime, WindowDaily, WindowWeekly, WindowMonthly}
+
+const (
+	// WindowAllTime 总榜, 不随时间重置
+	WindowAllTime WindowType = iota
+	// WindowDaily 日榜
+	WindowDaily
+	// WindowWeekly 周榜, 每周的起始日由 WithWeekStart 配置
+	WindowWeekly
+	// WindowMonthly 月榜
+	WindowMonthly
+)
+
+func (w WindowType) String() string {
+	switch w {
+	case WindowDaily:
+		return "daily"
+	case WindowWeekly:
+		return "weekly"
+	case WindowMonthly:
+		return "monthly"
+	default:
+		return "alltime"
+	}
+}
+
+// WindowKey 根据窗口类型和时间推导出对应周期的排行榜 key
+// 周期按 UTC 划分, 例如 game:leaderboard:daily:2024-06-01;
+// 周榜以该周起始日 (由 weekStart 指定) 的日期作为后缀, 总榜直接返回 baseKey
+func WindowKey(baseKey string, window WindowType, t time.Time, weekStart time.Weekday) string {
+	t = t.UTC()
+	switch window {
+	case WindowDaily:
+		return fmt.Sprintf("%s:%s:%s", baseKey, window, t.Format("2006-01-02"))
+	case WindowWeekly:
+		offset := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return fmt.Sprintf("%s:%s:%s", baseKey, window, t.AddDate(0, 0, -offset).Format("2006-01-02"))
+	case WindowMonthly:
+		return fmt.Sprintf("%s:%s:%s", baseKey, window, t.Format("2006-01"))
+	default:
+		return baseKey
+	}
+}
+
+// windowEnd 返回时间 t 所在周期结束 (即下一周期开始) 的 UTC 时间, 总榜返回零值
+func windowEnd(window WindowType, t time.Time, weekStart time.Weekday) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch window {
+	case WindowDaily:
+		return day.AddDate(0, 0, 1)
+	case WindowWeekly:
+		offset := (int(t.Weekday()) - int(weekStart) + 7) % 7
+		return day.AddDate(0, 0, 7-offset)
+	case WindowMonthly:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
+
+// WithWindow 让服务读写当前时间所在周期的排行榜
+func WithWindow(window WindowType) Option {
+	return func(s *LeaderboardService) {
+		s.window = window
+	}
+}
+
+// WithWeekStart 设置周榜的起始日, 默认为周一
+func WithWeekStart(day time.Weekday) Option {
+	return func(s *LeaderboardService) {
+		s.weekStart = day
+	}
+}
+
+// GetTopNForWindow 获取时间 t 所在周期排行榜的前 N 名玩家, 可用于查询历史周期
+func (s *LeaderboardService) GetTopNForWindow(ctx context.Context, window WindowType, t time.Time, n int64) (_ []RankInfo, err error) {
+	defer s.observe(&ctx, "GetTopNForWindow")(&err)
+	return s.displayRankings(s.topN(ctx, WindowKey(s.baseKey, window, t, s.weekStart), n))
+}
+
+// GetPlayerRankAllWindows 在一次往返中查询玩家在时间 t 所在的总榜、日榜、周榜和月榜中的排名, 例如用于玩家资料页
+// 返回的 map 包含每个窗口类型, 玩家不在某个窗口的排行榜上时该项的 Found 为 false, 不视为错误
+func (s *LeaderboardService) GetPlayerRankAllWindows(ctx context.Context, playerID string, t time.Time) (_ map[WindowType]*RankInfo, err error) {
+	defer s.observePlayer(&ctx, "GetPlayerRankAllWindows", playerID)(&err)
+	if err := s.requireRedis("GetPlayerRankAllWindows"); err != nil {
+		return nil, err
+	}
+	member, err := s.member(playerID)
+	if err != nil {
+		return nil, err
+	}
+	pipe := s.reader.Pipeline()
+	rankCmds := make([]*redis.IntCmd, len(allWindows))
+	scoreCmds := make([]*redis.FloatCmd, len(allWindows))
+	for i, window := range allWindows {
+		key := WindowKey(s.baseKey, window, t, s.weekStart)
+		rankCmds[i] = s.rank(ctx, pipe, key, member)
+		scoreCmds[i] = pipe.ZScore(ctx, key, member)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, err
+	}
+
+	ranks := make(map[WindowType]*RankInfo, len(allWindows))
+	for i, window := range allWindows {
+		rank, err := rankCmds[i].Result()
+		if errors.Is(err, redis.Nil) {
+			ranks[window] = &RankInfo{PlayerID: playerID}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		combinedScore, err := scoreCmds[i].Result()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkFinite(playerID, combinedScore); err != nil {
+			return nil, err
+		}
+		score, timestamp := s.decodeScore(combinedScore)
+		ranks[window], _ = s.displayRank(&RankInfo{PlayerID: playerID, Score: score, Rank: rank + 1, Timestamp: timestamp, Found: true}, nil)
+	}
+	return ranks, nil
+}